@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 
 	"mrs_sendemail_be/internal/config"
 	"mrs_sendemail_be/internal/handlers"
@@ -14,6 +18,9 @@ import (
 )
 
 func main() {
+	checkTemplates := flag.Bool("check-templates", false, "validate every template with sample data and exit")
+	flag.Parse()
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -22,11 +29,46 @@ func main() {
 
 	// Initialize services
 	redisService := services.NewRedisService(cfg)
-	smtpService := services.NewSMTPService(cfg)
+	brandingService := services.NewBrandingService(cfg, redisService)
+	templateService := services.NewTemplateService(cfg, redisService)
+	trackingService := services.NewTrackingService(cfg, redisService)
+	smtpService := services.NewSMTPService(cfg, brandingService, templateService, trackingService)
+	assertionService := services.NewLoginAssertionService(cfg)
+	tokenSigner, err := services.NewActivationTokenSigner(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load activation signing keys: %v", err)
+	}
+	totpService, err := services.NewTOTPService(cfg, redisService)
+	if err != nil {
+		log.Fatalf("Failed to load TOTP encryption keys: %v", err)
+	}
+	receiptSigner, err := services.NewReceiptSigner(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load receipt signing keys: %v", err)
+	}
+	channelService, err := services.NewChannelService(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load delivery channels: %v", err)
+	}
+
+	ctx := context.Background()
+
+	// Chế độ kiểm tra template (--check-templates): render mọi template rồi thoát, không khởi động server
+	if *checkTemplates {
+		issues := smtpService.LintTemplates(ctx)
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+		if len(issues) > 0 {
+			log.Printf("Template check failed with %d issue(s)", len(issues))
+			os.Exit(1)
+		}
+		log.Println("✓ All templates are valid")
+		return
+	}
 
 	// Test connections at startup
 	log.Println("Testing service connections...")
-	ctx := context.Background()
 	if err := redisService.Ping(ctx); err != nil {
 		log.Printf("Warning: Redis connection failed: %v", err)
 	} else {
@@ -39,11 +81,46 @@ func main() {
 		log.Println("✓ SMTP connection successful")
 	}
 
+	// Không khởi động khi có template lỗi, tránh chỉ phát hiện khi người dùng thật nhận email
+	if issues := smtpService.LintTemplates(ctx); len(issues) > 0 {
+		for _, issue := range issues {
+			log.Printf("Template error: %s", issue)
+		}
+		log.Fatalf("Refusing to start: %d template issue(s), run with --check-templates to list them", len(issues))
+	}
+	log.Println("✓ Templates validated")
+
 	// Initialize handlers
-	healthHandler := handlers.NewHealthHandler(redisService, smtpService)
-	generateHandler := handlers.NewGenerateHandler(cfg, redisService, smtpService)
-	verifyHandler := handlers.NewVerifyHandler(redisService)
-	activationHandler := handlers.NewActivationHandler(cfg, redisService, smtpService)
+	if err := handlers.RegisterValidators(cfg); err != nil {
+		log.Fatalf("Failed to register request validators: %v", err)
+	}
+	log.Printf("Activation actions: %s", strings.Join(cfg.ActionNames(), ", "))
+	log.Printf("Activation token mode: %s", cfg.Tokens.Mode)
+	log.Printf("Code delivery channels: %s", strings.Join(append([]string{config.ChannelEmail}, channelService.Names()...), ", "))
+	if !assertionService.Enabled() {
+		log.Println("Warning: LOGIN_ASSERTION_SECRET is not set, magic-link login cannot be verified")
+	}
+	if !totpService.Enabled() {
+		log.Println("Warning: TOTP_ENCRYPTION_KEYS is not set, authenticator endpoints are disabled")
+	}
+	if !receiptSigner.Enabled() {
+		log.Println("Warning: RECEIPT_SIGNING_KEY_ID is not set, verification receipts are not issued")
+	}
+	healthHandler := handlers.NewHealthHandler(redisService, smtpService, templateService)
+	generateHandler := handlers.NewGenerateHandler(cfg, redisService, smtpService, channelService)
+	verifyHandler := handlers.NewVerifyHandler(cfg, redisService, receiptSigner)
+	activationHandler := handlers.NewActivationHandler(cfg, redisService, smtpService, assertionService, tokenSigner, receiptSigner)
+	templateHandler := handlers.NewTemplateHandler(templateService)
+	experimentHandler := handlers.NewExperimentHandler(redisService)
+	trackingHandler := handlers.NewTrackingHandler(trackingService)
+	invitationHandler := handlers.NewInvitationHandler(cfg, redisService)
+	totpHandler := handlers.NewTOTPHandler(cfg, redisService, totpService)
+	receiptHandler := handlers.NewReceiptHandler(receiptSigner)
+
+	// Lắng nghe thay đổi template từ các instance khác để làm mới cache
+	go templateService.WatchChanges(context.Background())
+	// Reload template khi file trong TEMPLATE_DIR thay đổi
+	go templateService.WatchTemplateDir(context.Background())
 
 	// Setup Gin router
 	if gin.Mode() == gin.ReleaseMode {
@@ -59,7 +136,7 @@ func main() {
 	// CORS middleware (cho phép cross-origin requests)
 	router.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Content-Type, x-api-key")
 
 		if c.Request.Method == "OPTIONS" {
@@ -73,6 +150,13 @@ func main() {
 	// Public routes (không cần API key)
 	router.GET("/health", healthHandler.HealthCheck)
 
+	// Public key kiểm tra receipt xác thực
+	router.GET("/.well-known/jwks.json", receiptHandler.JWKS)
+
+	// Tracking mở email/click link kích hoạt (link nằm trong email nên không yêu cầu API key)
+	router.GET("/track/open/:id", trackingHandler.Open)
+	router.GET("/track/click/:id", trackingHandler.Click)
+
 	// Protected routes (cần API key)
 	protected := router.Group("/")
 	protected.Use(middleware.APIKeyAuth(cfg))
@@ -93,14 +177,46 @@ func main() {
 		activationGroup.POST("/generate-activation", activationHandler.GenerateActivation)
 		activationGroup.POST("/resend-activation", activationHandler.ResendActivation)
 
-		// Verify activation endpoint (chỉ cần API key, không cần rate limiting)
+		// Verify/revoke activation endpoints (chỉ cần API key, không cần rate limiting)
 		protected.POST("/verify-activation", activationHandler.VerifyActivation)
+		protected.POST("/revoke-activation", activationHandler.RevokeActivation)
+
+		// Xác thực hai bước: validate khi tải trang (không tiêu thụ token), consume khi người dùng gửi form
+		protected.POST("/activation/validate", activationHandler.ValidateActivation)
+		protected.POST("/activation/consume", activationHandler.ConsumeActivation)
+
+		// Ứng dụng authenticator (TOTP): đăng ký, xác nhận, xác thực và recovery code
+		totpGroup := protected.Group("/totp")
+		totpGroup.POST("/enroll", totpHandler.Enroll)
+		totpGroup.POST("/confirm", totpHandler.Confirm)
+		totpGroup.POST("/verify", totpHandler.Verify)
+		totpGroup.POST("/recovery-codes", totpHandler.RecoveryCodes)
+		totpGroup.POST("/disable", totpHandler.Disable)
+
+		// Quản lý lời mời theo tổ chức (cần quyền invitations)
+		invitationGroup := protected.Group("/invitations")
+		invitationGroup.Use(middleware.RequirePermission(cfg, config.PermissionInvitations))
+		invitationGroup.GET("", invitationHandler.List)
+		invitationGroup.POST("/revoke", invitationHandler.Revoke)
+
+		// Admin endpoints quản lý template (cần quyền templates)
+		adminGroup := protected.Group("/admin")
+		adminGroup.Use(middleware.RequirePermission(cfg, config.PermissionManageTemplates))
+		adminGroup.GET("/templates", templateHandler.List)
+		adminGroup.POST("/templates", templateHandler.Create)
+		adminGroup.PUT("/templates", templateHandler.Update)
+		adminGroup.GET("/templates/versions", templateHandler.Versions)
+		adminGroup.POST("/templates/rollback", templateHandler.Rollback)
+		adminGroup.GET("/templates/revision", templateHandler.Revision)
+		adminGroup.GET("/experiments/stats", experimentHandler.Stats)
+		adminGroup.GET("/tracking/:id", trackingHandler.Events)
 	}
 
 	// Start server
 	address := cfg.Server.Host + ":" + cfg.Server.Port
 	log.Printf("Starting server on %s", address)
 	log.Printf("Health check: GET http://%s/health", address)
+	log.Printf("Receipt keys: GET http://%s/.well-known/jwks.json", address)
 	log.Printf("=== Legacy Endpoints ===")
 	log.Printf("Generate code: POST http://%s/generate", address)
 	log.Printf("Verify code: POST http://%s/verify", address)
@@ -108,6 +224,14 @@ func main() {
 	log.Printf("Generate activation: POST http://%s/generate-activation", address)
 	log.Printf("Verify activation: POST http://%s/verify-activation", address)
 	log.Printf("Resend activation: POST http://%s/resend-activation", address)
+	log.Printf("Revoke email change: POST http://%s/revoke-activation", address)
+	log.Printf("Two-phase activation: POST http://%s/activation/validate, /activation/consume", address)
+	log.Printf("TOTP: POST http://%s/totp/enroll, /totp/confirm, /totp/verify, /totp/recovery-codes, /totp/disable", address)
+	log.Printf("Invitations: GET http://%s/invitations, POST http://%s/invitations/revoke", address, address)
+	log.Printf("=== Admin Endpoints ===")
+	log.Printf("Templates: GET/POST/PUT http://%s/admin/templates", address)
+	log.Printf("A/B stats: GET http://%s/admin/experiments/stats", address)
+	log.Printf("Tracking events: GET http://%s/admin/tracking/:id", address)
 
 	if err := router.Run(address); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
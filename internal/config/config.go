@@ -1,7 +1,14 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -15,6 +22,16 @@ type Config struct {
 	Security  SecurityConfig
 	RateLimit RateLimitConfig
 	Code      CodeConfig
+	I18n      I18nConfig
+	Branding  BrandingConfig
+	Templates TemplatesConfig
+	Tracking  TrackingConfig
+	Actions   map[string]ActionConfig // Các action của activation link theo tên
+	Login     LoginConfig
+	Tokens    TokenConfig
+	TOTP      TOTPConfig
+	Receipts  ReceiptConfig
+	Channels  map[string]ChannelConfig // Kênh gửi mã ngoài email (SMS, Zalo, Telegram) theo tên
 }
 
 type ServerConfig struct {
@@ -38,18 +55,286 @@ type SMTPConfig struct {
 }
 
 type SecurityConfig struct {
-	APIKeys []string
+	APIKeys     []string
+	Permissions map[string][]string // Quyền bổ sung theo API key
+	HashSecrets []string            // Khóa HMAC băm mã xác thực và token trước khi lưu, khóa đầu tiên là khóa hiện tại
+	Tenants     map[string]string   // Tenant theo API key, các key cùng tenant dùng chung mã xác thực
+}
+
+// TenantFor trả về tenant của API key: tenant khai báo trong API_KEY_TENANTS,
+// mặc định là dấu vân tay của key (không lưu key gốc vào Redis)
+func (c SecurityConfig) TenantFor(apiKey string) string {
+	if tenant := c.Tenants[apiKey]; tenant != "" {
+		return tenant
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return "key-" + hex.EncodeToString(sum[:8])
+}
+
+// Các quyền có thể cấp cho API key qua API_KEY_PERMISSIONS ("*" = mọi quyền)
+const (
+	PermissionManageTemplates = "templates"
+	PermissionSubjectOverride = "subject"     // Cho phép gửi field subject để ghi đè tiêu đề email
+	PermissionInvitations     = "invitations" // Cho phép liệt kê và hủy lời mời theo tổ chức
+)
+
+// HasPermission kiểm tra API key có được cấp quyền hay không
+func (c SecurityConfig) HasPermission(apiKey, permission string) bool {
+	for _, granted := range c.Permissions[apiKey] {
+		if granted == permission || granted == "*" {
+			return true
+		}
+	}
+	return false
 }
 
 type RateLimitConfig struct {
-	EmailPerHour int
-	IPPerHour    int
+	EmailPerHour       int
+	IPPerHour          int
+	VerifyEmailPerHour int // Số lần gọi /verify tối đa mỗi giờ theo email
+	VerifyIPPerHour    int // Số lần gọi /verify tối đa mỗi giờ theo IP
 }
 
 type CodeConfig struct {
 	ExpireMinutes     int
-	Length            int
+	MaxAttempts       int // Số lần nhập mã tối đa, hết lượt mã bị hủy
 	DefaultSystemName string
+	Format            CodeFormat            // Định dạng mặc định (CODE_FORMAT, CODE_LENGTH, ...)
+	Formats           map[string]CodeFormat // Định dạng riêng theo "system:purpose" ("*" = mọi system/purpose)
+}
+
+// Kiểu mã xác thực (CODE_FORMAT, type trong CODE_FORMATS_FILE)
+const (
+	CodeTypeNumeric      = "numeric"      // Chỉ gồm chữ số
+	CodeTypeAlphanumeric = "alphanumeric" // Chữ hoa và chữ số, bỏ các ký tự dễ nhầm (0/O, 1/I/L)
+)
+
+const (
+	numericAlphabet     = "0123456789"
+	unambiguousAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+)
+
+// CodeFormat là định dạng của mã xác thực. Mã được so khớp không phân biệt hoa thường,
+// khoảng trắng và dấu "-" trong mã người dùng nhập được bỏ qua.
+type CodeFormat struct {
+	Type      string `json:"type"`       // CodeTypeNumeric hoặc CodeTypeAlphanumeric
+	Alphabet  string `json:"alphabet"`   // Bộ ký tự riêng, thay cho bộ ký tự của type
+	Length    int    `json:"length"`     // Số ký tự của mã, không tính ký tự phân nhóm
+	GroupSize int    `json:"group_size"` // Số ký tự mỗi nhóm khi hiển thị trong email, 0 = không chia nhóm
+	Separator string `json:"separator"`  // Ký tự phân nhóm: "-" hoặc " "
+}
+
+// Characters trả về bộ ký tự dùng để sinh mã (chữ hoa)
+func (f CodeFormat) Characters() string {
+	if f.Alphabet != "" {
+		return strings.ToUpper(f.Alphabet)
+	}
+	if f.Type == CodeTypeAlphanumeric {
+		return unambiguousAlphabet
+	}
+	return numericAlphabet
+}
+
+// FormatFor trả về định dạng mã của system và mục đích, ưu tiên "system:purpose",
+// sau đó "*:purpose", "system:*", "*:*" rồi định dạng mặc định. Key trong file chỉ có system
+// ("system", "*") đã được loadCodeFormats chuẩn hóa thành "system:*", "*:*"
+func (c CodeConfig) FormatFor(system, purpose string) CodeFormat {
+	for _, key := range []string{system + ":" + purpose, "*:" + purpose, system + ":*", "*:*"} {
+		if format, ok := c.Formats[key]; ok {
+			return format
+		}
+	}
+	return c.Format
+}
+
+type I18nConfig struct {
+	DefaultLocale string
+	SystemLocales map[string]string // Locale mặc định theo tên system
+}
+
+// LocaleFor trả về locale mặc định của system, fallback về DefaultLocale
+func (c I18nConfig) LocaleFor(system string) string {
+	if locale, ok := c.SystemLocales[system]; ok && locale != "" {
+		return locale
+	}
+	return c.DefaultLocale
+}
+
+type BrandingConfig struct {
+	ProfilesFile string // File JSON chứa branding profile theo tên system
+	PrimaryColor string // Màu chủ đạo mặc định
+}
+
+type TemplatesConfig struct {
+	Dir            string   // Thư mục chứa template email, rỗng = không dùng
+	ReloadInterval int      // Chu kỳ kiểm tra thay đổi trong thư mục (giây)
+	MaxBodyKB      int      // Kích thước tối đa của nội dung HTML (Gmail cắt email lớn hơn ~102KB)
+	LintSystems    []string // Các system được kiểm tra template khi khởi động, ngoài các system đã biết
+}
+
+type TrackingConfig struct {
+	Enabled       bool     // Bật theo dõi mở email và click link kích hoạt
+	BaseURL       string   // URL public của service, dùng để tạo link tracking
+	OptOutSystems []string // Các system không theo dõi (quyền riêng tư)
+	RetentionDays int      // Thời gian lưu sự kiện tracking (ngày)
+}
+
+// TrackingEnabled kiểm tra tracking có được bật cho system hay không
+func (c TrackingConfig) TrackingEnabled(system string) bool {
+	if !c.Enabled || c.BaseURL == "" {
+		return false
+	}
+	for _, optOut := range c.OptOutSystems {
+		if strings.TrimSpace(optOut) == system {
+			return false
+		}
+	}
+	return true
+}
+
+// ActionConfig khai báo một luồng activation link (registration, password_reset, ...)
+type ActionConfig struct {
+	Path           string `json:"path"`            // Đường dẫn trang frontend nhận token, ví dụ /activate.html
+	Template       string `json:"template"`        // Template email sử dụng, mặc định trùng tên action
+	TTLMinutes     int    `json:"ttl_minutes"`     // Thời gian hiệu lực của token (phút)
+	MaxSends       int    `json:"max_sends"`       // Số lần gửi email tối đa cho một token
+	ResendInterval int    `json:"resend_interval"` // Khoảng cách tối thiểu giữa hai lần gửi (giây)
+	SingleUse      bool   `json:"single_use"`      // Token bị xóa sau khi xác thực thành công
+	Assertion      bool   `json:"assertion"`       // Trả về login assertion đã ký khi xác thực thành công
+	ChangesEmail   bool   `json:"changes_email"`   // Đổi email: link gửi tới newEmail, email hiện tại nhận thông báo kèm link hủy
+	NoticeTemplate string `json:"notice_template"` // Template email thông báo gửi tới email hiện tại (khi changes_email)
+	RevokePath     string `json:"revoke_path"`     // Đường dẫn trang frontend hủy yêu cầu đổi email (khi changes_email)
+	Invitation     bool   `json:"invitation"`      // Lời mời: token lưu người mời, tổ chức, vai trò và được liệt kê theo tổ chức
+}
+
+type LoginConfig struct {
+	AssertionSecret string // Khóa HMAC-SHA256 ký login assertion, dùng chung với auth service
+	AssertionTTL    int    // Thời gian hiệu lực của login assertion (giây)
+	Issuer          string // Giá trị "iss" của login assertion
+}
+
+// Cách phát hành activation token (ACTIVATION_TOKEN_MODE)
+const (
+	TokenModeStored = "stored" // UUID ngẫu nhiên, phải tồn tại trong Redis khi xác thực
+	TokenModeSigned = "signed" // Token Ed25519 tự chứa email/action/system, xác thực được khi Redis mất dữ liệu
+)
+
+type TokenConfig struct {
+	Mode         string            // TokenModeStored hoặc TokenModeSigned
+	SigningKeyID string            // kid của khóa ký token mới
+	SigningKeys  map[string]string // Seed Ed25519 (base64, 32 byte) theo kid, khóa cũ giữ lại để xác thực token đã phát hành
+	Issuer       string            // Giá trị "iss" của token
+	SessionTTL   int               // Thời gian hiệu lực của session handle cấp bởi /activation/validate (giây)
+}
+
+type ReceiptConfig struct {
+	SigningKeyID string            // kid của khóa ký receipt mới, rỗng = không phát hành receipt
+	SigningKeys  map[string]string // Seed Ed25519 (base64, 32 byte) theo kid, public key được công bố qua JWKS
+	TTL          int               // Thời gian hiệu lực của receipt (giây)
+	Issuer       string            // Giá trị "iss" của receipt
+	Audience     string            // Giá trị "aud" của receipt, rỗng = không có
+}
+
+type TOTPConfig struct {
+	Issuer          string            // Tên hiển thị trong ứng dụng authenticator
+	Digits          int               // Số chữ số của mã (6-8)
+	Period          int               // Chu kỳ đổi mã (giây)
+	Skew            int               // Số chu kỳ lệch cho phép trước/sau thời điểm hiện tại (đồng hồ điện thoại sai giờ)
+	EnrollTTL       int               // Thời gian hoàn tất đăng ký sau khi quét QR (phút)
+	RecoveryCodes   int               // Số recovery code sinh mỗi lần
+	EncryptionKeyID string            // kid của khóa mã hóa secret mới
+	EncryptionKeys  map[string]string // Khóa AES-256 (base64, 32 byte) theo kid, khóa cũ giữ lại để giải mã secret đã lưu
+}
+
+// ChannelEmail là kênh gửi mã mặc định qua SMTP, không khai báo trong CHANNELS_FILE
+const ChannelEmail = "email"
+
+// Loại provider HTTP của kênh gửi mã
+const (
+	ProviderWebhook  = "webhook"  // SMS gateway nhận POST JSON {"to", "message"}
+	ProviderZaloZNS  = "zalo_zns" // Zalo Notification Service, gửi theo template đã duyệt
+	ProviderTelegram = "telegram" // Telegram Bot API (sendMessage)
+)
+
+// ChannelConfig khai báo một kênh gửi mã xác thực qua HTTP provider
+type ChannelConfig struct {
+	Provider         string            `json:"provider"`            // ProviderWebhook, ProviderZaloZNS hoặc ProviderTelegram
+	URL              string            `json:"url"`                 // Endpoint của provider (Telegram: base URL của Bot API)
+	Token            string            `json:"token"`               // Bearer token (webhook), access token (Zalo) hoặc bot token (Telegram)
+	TemplateID       string            `json:"template_id"`         // ID template ZNS đã được duyệt (zalo_zns)
+	Templates        map[string]string `json:"templates"`           // Nội dung tin nhắn theo locale (text/template), mặc định dùng catalog
+	TemplateData     map[string]string `json:"template_data"`       // Tham số template ZNS (text/template), mặc định {"otp": "{{.Code}}"}
+	RateLimitPerHour int               `json:"rate_limit_per_hour"` // Số tin tối đa mỗi giờ cho một người nhận, 0 = không giới hạn
+	TimeoutSeconds   int               `json:"timeout_seconds"`     // Thời gian chờ provider phản hồi
+}
+
+// RecipientField trả về field của request chứa người nhận: "phone" (E.164) hoặc "chatId" (Telegram)
+func (c ChannelConfig) RecipientField() string {
+	if c.Provider == ProviderTelegram {
+		return "chatId"
+	}
+	return "phone"
+}
+
+// defaultActions là các action dựng sẵn, có thể ghi đè hoặc bổ sung qua ACTIONS_FILE
+var defaultActions = map[string]ActionConfig{
+	"registration":   {Path: "/activate.html", Template: "registration", TTLMinutes: 30, MaxSends: 3, ResendInterval: 60, SingleUse: true},
+	"password_reset": {Path: "/reset-password.html", Template: "password_reset", TTLMinutes: 30, MaxSends: 3, ResendInterval: 60, SingleUse: true},
+	"verification":   {Path: "/verify.html", Template: "verification", TTLMinutes: 30, MaxSends: 3, ResendInterval: 60, SingleUse: true},
+	"login":          {Path: "/login.html", Template: "login", TTLMinutes: 10, MaxSends: 3, ResendInterval: 60, SingleUse: true, Assertion: true},
+	"email_change": {
+		Path: "/confirm-email.html", Template: "email_change", TTLMinutes: 60, MaxSends: 3, ResendInterval: 60, SingleUse: true,
+		ChangesEmail: true, NoticeTemplate: "email_change_notice", RevokePath: "/revoke-email-change.html",
+	},
+	"invitation": {Path: "/accept-invite.html", Template: "invitation", TTLMinutes: 7 * 24 * 60, MaxSends: 3, ResendInterval: 60, SingleUse: true, Invitation: true},
+}
+
+var actionNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Action trả về cấu hình của action, false nếu action không được khai báo
+func (c *Config) Action(name string) (ActionConfig, bool) {
+	action, ok := c.Actions[name]
+	return action, ok
+}
+
+// ActionNames trả về tên các action đã khai báo, sắp xếp theo tên
+func (c *Config) ActionNames() []string {
+	names := make([]string, 0, len(c.Actions))
+	for name := range c.Actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TemplateActions trả về các action có template email: "code", template và template thông báo của mọi action
+func (c *Config) TemplateActions() []string {
+	seen := map[string]bool{"code": true}
+	actions := []string{"code"}
+	for _, name := range c.ActionNames() {
+		action := c.Actions[name]
+		templates := []string{action.Template}
+		if action.ChangesEmail {
+			templates = append(templates, action.NoticeTemplate)
+		}
+		for _, template := range templates {
+			if !seen[template] {
+				seen[template] = true
+				actions = append(actions, template)
+			}
+		}
+	}
+	return actions
+}
+
+// IsNoticeTemplate kiểm tra template có phải template thông báo đổi email của action nào không
+func (c *Config) IsNoticeTemplate(template string) bool {
+	for _, action := range c.Actions {
+		if action.ChangesEmail && action.NoticeTemplate == template {
+			return true
+		}
+	}
+	return false
 }
 
 func Load() (*Config, error) {
@@ -75,22 +360,362 @@ func Load() (*Config, error) {
 			FromName: getEnv("SMTP_FROM_NAME", "Fix4Home System"),
 		},
 		Security: SecurityConfig{
-			APIKeys: getEnvAsSlice("API_KEYS", []string{}),
+			APIKeys:     getEnvAsSlice("API_KEYS", []string{}),
+			Permissions: getEnvAsListMap("API_KEY_PERMISSIONS"),
+			HashSecrets: getEnvAsSlice("TOKEN_HASH_SECRETS", []string{}),
+			Tenants:     getEnvAsMap("API_KEY_TENANTS", map[string]string{}),
 		},
 		RateLimit: RateLimitConfig{
-			EmailPerHour: getEnvAsInt("RATE_LIMIT_EMAIL_PER_HOUR", 5),
-			IPPerHour:    getEnvAsInt("RATE_LIMIT_IP_PER_HOUR", 30),
+			EmailPerHour:       getEnvAsInt("RATE_LIMIT_EMAIL_PER_HOUR", 5),
+			IPPerHour:          getEnvAsInt("RATE_LIMIT_IP_PER_HOUR", 30),
+			VerifyEmailPerHour: getEnvAsInt("RATE_LIMIT_VERIFY_EMAIL_PER_HOUR", 20),
+			VerifyIPPerHour:    getEnvAsInt("RATE_LIMIT_VERIFY_IP_PER_HOUR", 60),
 		},
 		Code: CodeConfig{
 			ExpireMinutes:     getEnvAsInt("CODE_EXPIRE_MINUTES", 30),
-			Length:            getEnvAsInt("CODE_LENGTH", 6),
+			MaxAttempts:       getEnvAsInt("CODE_MAX_ATTEMPTS", 5),
 			DefaultSystemName: getEnv("DEFAULT_SYSTEM_NAME", "Fix4Home"),
+			Format: CodeFormat{
+				Type:      getEnv("CODE_FORMAT", CodeTypeNumeric),
+				Length:    getEnvAsInt("CODE_LENGTH", 6),
+				GroupSize: getEnvAsInt("CODE_GROUP_SIZE", 0),
+				Separator: getEnv("CODE_GROUP_SEPARATOR", "-"),
+			},
+		},
+		I18n: I18nConfig{
+			DefaultLocale: getEnv("DEFAULT_LOCALE", "vi"),
+			SystemLocales: getEnvAsMap("SYSTEM_LOCALES", map[string]string{}),
+		},
+		Branding: BrandingConfig{
+			ProfilesFile: getEnv("BRANDING_PROFILES_FILE", ""),
+			PrimaryColor: getEnv("BRANDING_PRIMARY_COLOR", "#007bff"),
+		},
+		Templates: TemplatesConfig{
+			Dir:            getEnv("TEMPLATE_DIR", ""),
+			ReloadInterval: getEnvAsInt("TEMPLATE_RELOAD_INTERVAL", 5),
+			MaxBodyKB:      getEnvAsInt("TEMPLATE_MAX_BODY_KB", 100),
+			LintSystems:    getEnvAsSlice("TEMPLATE_LINT_SYSTEMS", []string{}),
+		},
+		Tracking: TrackingConfig{
+			Enabled:       getEnvAsBool("TRACKING_ENABLED", false),
+			BaseURL:       strings.TrimRight(getEnv("TRACKING_BASE_URL", ""), "/"),
+			OptOutSystems: getEnvAsSlice("TRACKING_OPT_OUT_SYSTEMS", []string{}),
+			RetentionDays: getEnvAsInt("TRACKING_RETENTION_DAYS", 30),
 		},
+		Login: LoginConfig{
+			AssertionSecret: getEnv("LOGIN_ASSERTION_SECRET", ""),
+			AssertionTTL:    getEnvAsInt("LOGIN_ASSERTION_TTL", 300),
+			Issuer:          getEnv("LOGIN_ASSERTION_ISSUER", "mrs_sendemail_be"),
+		},
+		Tokens: TokenConfig{
+			Mode:         getEnv("ACTIVATION_TOKEN_MODE", TokenModeStored),
+			SigningKeyID: getEnv("ACTIVATION_SIGNING_KEY_ID", ""),
+			SigningKeys:  getEnvAsMap("ACTIVATION_SIGNING_KEYS", map[string]string{}),
+			Issuer:       getEnv("ACTIVATION_TOKEN_ISSUER", "mrs_sendemail_be"),
+			SessionTTL:   getEnvAsInt("ACTIVATION_SESSION_TTL", 900),
+		},
+		Receipts: ReceiptConfig{
+			SigningKeyID: getEnv("RECEIPT_SIGNING_KEY_ID", ""),
+			SigningKeys:  getEnvAsMap("RECEIPT_SIGNING_KEYS", map[string]string{}),
+			TTL:          getEnvAsInt("RECEIPT_TTL", 300),
+			Issuer:       getEnv("RECEIPT_ISSUER", "mrs_sendemail_be"),
+			Audience:     getEnv("RECEIPT_AUDIENCE", ""),
+		},
+		TOTP: TOTPConfig{
+			Issuer:          getEnv("TOTP_ISSUER", getEnv("SMTP_FROM_NAME", "Fix4Home System")),
+			Digits:          getEnvAsInt("TOTP_DIGITS", 6),
+			Period:          getEnvAsInt("TOTP_PERIOD", 30),
+			Skew:            getEnvAsInt("TOTP_SKEW", 1),
+			EnrollTTL:       getEnvAsInt("TOTP_ENROLL_TTL_MINUTES", 10),
+			RecoveryCodes:   getEnvAsInt("TOTP_RECOVERY_CODES", 10),
+			EncryptionKeyID: getEnv("TOTP_ENCRYPTION_KEY_ID", ""),
+			EncryptionKeys:  getEnvAsMap("TOTP_ENCRYPTION_KEYS", map[string]string{}),
+		},
+	}
+
+	// Mã xác thực và token chỉ được lưu dưới dạng HMAC, không có khóa thì không khởi động
+	hashSecrets, err := parseHashSecrets(config.Security.HashSecrets)
+	if err != nil {
+		return nil, err
+	}
+	config.Security.HashSecrets = hashSecrets
+
+	actions, err := loadActions(getEnv("ACTIONS_FILE", ""))
+	if err != nil {
+		return nil, err
+	}
+	config.Actions = actions
+
+	if err := validateCodeFormat("CODE_FORMAT", config.Code.Format); err != nil {
+		return nil, err
+	}
+	formats, err := loadCodeFormats(getEnv("CODE_FORMATS_FILE", ""), config.Code.Format)
+	if err != nil {
+		return nil, err
 	}
+	config.Code.Formats = formats
+
+	if err := validateTOTP(config.TOTP); err != nil {
+		return nil, err
+	}
+	if config.Tokens.SessionTTL <= 0 {
+		return nil, fmt.Errorf("ACTIVATION_SESSION_TTL must be positive")
+	}
+	if err := validateSigningKeys(config.Tokens.SigningKeys, config.Receipts.SigningKeys); err != nil {
+		return nil, err
+	}
+
+	channels, err := loadChannels(getEnv("CHANNELS_FILE", ""))
+	if err != nil {
+		return nil, err
+	}
+	config.Channels = channels
 
 	return config, nil
 }
 
+// parseHashSecrets bỏ khoảng trắng quanh các khóa băm và bỏ qua phần tử rỗng, cần ít nhất một khóa
+func parseHashSecrets(secrets []string) ([]string, error) {
+	result := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			result = append(result, secret)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("TOKEN_HASH_SECRETS is not set")
+	}
+	return result, nil
+}
+
+// validateSigningKeys từ chối khóa dùng chung giữa activation token và receipt (cùng kid hoặc cùng seed),
+// để token của loại này không bao giờ kiểm tra được bằng khóa của loại kia
+func validateSigningKeys(activation, receipts map[string]string) error {
+	seeds := make(map[string]string, len(activation))
+	for kid, value := range activation {
+		if _, ok := receipts[kid]; ok {
+			return fmt.Errorf("signing key %q is declared in both ACTIVATION_SIGNING_KEYS and RECEIPT_SIGNING_KEYS", kid)
+		}
+		seeds[signingKeySeed(value)] = kid
+	}
+	for kid, value := range receipts {
+		if other, ok := seeds[signingKeySeed(value)]; ok {
+			return fmt.Errorf("RECEIPT_SIGNING_KEYS key %q reuses the seed of ACTIVATION_SIGNING_KEYS key %q", kid, other)
+		}
+	}
+	return nil
+}
+
+// signingKeySeed trả về seed Ed25519 của khóa base64 (private key 64 byte bắt đầu bằng seed) để so sánh.
+// Khóa không đọc được giữ nguyên, lỗi được báo khi services tải khóa.
+func signingKeySeed(value string) string {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		if raw, err = base64.RawURLEncoding.DecodeString(value); err != nil {
+			return value
+		}
+	}
+	if len(raw) > 32 {
+		raw = raw[:32]
+	}
+	return string(raw)
+}
+
+// loadChannels đọc file JSON dạng {"<channel>": {...}}. Giá trị url và token được thay biến môi trường
+// (${ZALO_ACCESS_TOKEN}) để không phải ghi secret vào file.
+func loadChannels(path string) (map[string]ChannelConfig, error) {
+	channels := make(map[string]ChannelConfig)
+	if path == "" {
+		return channels, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read channels file: %w", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse channels file: %w", err)
+	}
+
+	for name, entry := range raw {
+		channel := ChannelConfig{RateLimitPerHour: 5, TimeoutSeconds: 10}
+		if err := json.Unmarshal(entry, &channel); err != nil {
+			return nil, fmt.Errorf("failed to parse channel %q: %w", name, err)
+		}
+		channel.URL = strings.TrimRight(os.ExpandEnv(channel.URL), "/")
+		channel.Token = os.ExpandEnv(channel.Token)
+		if channel.Provider == ProviderZaloZNS && len(channel.TemplateData) == 0 {
+			channel.TemplateData = map[string]string{"otp": "{{.Code}}"}
+		}
+		if err := validateChannel(name, channel); err != nil {
+			return nil, err
+		}
+		channels[name] = channel
+	}
+
+	return channels, nil
+}
+
+func validateChannel(name string, channel ChannelConfig) error {
+	switch {
+	case !actionNamePattern.MatchString(name) || name == ChannelEmail:
+		return fmt.Errorf("invalid channel name %q", name)
+	case channel.Provider != ProviderWebhook && channel.Provider != ProviderZaloZNS && channel.Provider != ProviderTelegram:
+		return fmt.Errorf("channel %q: provider must be %q, %q or %q", name, ProviderWebhook, ProviderZaloZNS, ProviderTelegram)
+	case !strings.HasPrefix(channel.URL, "http://") && !strings.HasPrefix(channel.URL, "https://"):
+		return fmt.Errorf("channel %q: url must be an http(s) URL", name)
+	case channel.Provider != ProviderWebhook && channel.Token == "":
+		return fmt.Errorf("channel %q: token is required", name)
+	case channel.Provider == ProviderZaloZNS && channel.TemplateID == "":
+		return fmt.Errorf("channel %q: template_id is required", name)
+	case channel.RateLimitPerHour < 0:
+		return fmt.Errorf("channel %q: rate_limit_per_hour must not be negative", name)
+	case channel.TimeoutSeconds <= 0:
+		return fmt.Errorf("channel %q: timeout_seconds must be positive", name)
+	}
+	return nil
+}
+
+func validateTOTP(totp TOTPConfig) error {
+	switch {
+	case totp.Digits < 6 || totp.Digits > 8:
+		return fmt.Errorf("TOTP_DIGITS must be between 6 and 8")
+	case totp.Period < 15 || totp.Period > 120:
+		return fmt.Errorf("TOTP_PERIOD must be between 15 and 120 seconds")
+	case totp.Skew < 0 || totp.Skew > 5:
+		return fmt.Errorf("TOTP_SKEW must be between 0 and 5")
+	case totp.EnrollTTL <= 0:
+		return fmt.Errorf("TOTP_ENROLL_TTL_MINUTES must be positive")
+	case totp.RecoveryCodes < 1 || totp.RecoveryCodes > 20:
+		return fmt.Errorf("TOTP_RECOVERY_CODES must be between 1 and 20")
+	}
+	return nil
+}
+
+// loadCodeFormats đọc file JSON dạng {"<system>:<purpose>": {...}}, "*" thay cho mọi system/purpose,
+// key chỉ có system áp dụng cho mọi purpose. Field không khai báo lấy theo định dạng mặc định.
+func loadCodeFormats(path string, defaultFormat CodeFormat) (map[string]CodeFormat, error) {
+	formats := make(map[string]CodeFormat)
+	if path == "" {
+		return formats, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read code formats file: %w", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse code formats file: %w", err)
+	}
+
+	for key, entry := range raw {
+		format := defaultFormat
+		if err := json.Unmarshal(entry, &format); err != nil {
+			return nil, fmt.Errorf("failed to parse code format %q: %w", key, err)
+		}
+		if err := validateCodeFormat(fmt.Sprintf("code format %q", key), format); err != nil {
+			return nil, err
+		}
+		if !strings.Contains(key, ":") {
+			key += ":*"
+		}
+		formats[key] = format
+	}
+
+	return formats, nil
+}
+
+func validateCodeFormat(name string, format CodeFormat) error {
+	characters := format.Characters()
+	switch {
+	case format.Type != CodeTypeNumeric && format.Type != CodeTypeAlphanumeric:
+		return fmt.Errorf("%s: type must be %q or %q", name, CodeTypeNumeric, CodeTypeAlphanumeric)
+	case format.Length < 4 || format.Length > 32:
+		return fmt.Errorf("%s: length must be between 4 and 32", name)
+	case format.GroupSize < 0 || format.GroupSize > format.Length:
+		return fmt.Errorf("%s: group_size must be between 0 and length", name)
+	case format.GroupSize > 0 && format.Separator != "-" && format.Separator != " ":
+		return fmt.Errorf("%s: separator must be \"-\" or \" \"", name)
+	case len(characters) < 2:
+		return fmt.Errorf("%s: alphabet needs at least 2 characters", name)
+	}
+
+	seen := make(map[rune]bool)
+	for _, char := range characters {
+		if char > 127 || char <= ' ' || char == '-' || seen[char] {
+			return fmt.Errorf("%s: alphabet must be distinct ASCII characters (case-insensitive) without spaces or \"-\"", name)
+		}
+		seen[char] = true
+	}
+	return nil
+}
+
+// loadActions đọc file JSON dạng {"<action>": {...}} và merge lên các action dựng sẵn.
+// Field không khai báo giữ giá trị của action dựng sẵn cùng tên, hoặc giá trị mặc định với action mới.
+func loadActions(path string) (map[string]ActionConfig, error) {
+	actions := make(map[string]ActionConfig, len(defaultActions))
+	for name, action := range defaultActions {
+		actions[name] = action
+	}
+	if path == "" {
+		return actions, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read actions file: %w", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse actions file: %w", err)
+	}
+
+	for name, entry := range raw {
+		action, exists := actions[name]
+		if !exists {
+			action = ActionConfig{
+				Path: "/verify.html", Template: name, TTLMinutes: 30, MaxSends: 3, ResendInterval: 60, SingleUse: true,
+				NoticeTemplate: name + "_notice", RevokePath: "/revoke.html",
+			}
+		}
+		if err := json.Unmarshal(entry, &action); err != nil {
+			return nil, fmt.Errorf("failed to parse action %q: %w", name, err)
+		}
+		if err := validateAction(name, action); err != nil {
+			return nil, err
+		}
+		actions[name] = action
+	}
+
+	return actions, nil
+}
+
+func validateAction(name string, action ActionConfig) error {
+	switch {
+	case !actionNamePattern.MatchString(name) || name == "code":
+		return fmt.Errorf("invalid action name %q", name)
+	case !actionNamePattern.MatchString(action.Template) || action.Template == "code":
+		return fmt.Errorf("action %q: invalid template %q", name, action.Template)
+	case !strings.HasPrefix(action.Path, "/"):
+		return fmt.Errorf("action %q: path must start with /", name)
+	case action.TTLMinutes <= 0:
+		return fmt.Errorf("action %q: ttl_minutes must be positive", name)
+	case action.MaxSends <= 0:
+		return fmt.Errorf("action %q: max_sends must be positive", name)
+	case action.ResendInterval < 0:
+		return fmt.Errorf("action %q: resend_interval must not be negative", name)
+	case action.ChangesEmail && (!actionNamePattern.MatchString(action.NoticeTemplate) || action.NoticeTemplate == "code" || action.NoticeTemplate == action.Template):
+		return fmt.Errorf("action %q: invalid notice_template %q", name, action.NoticeTemplate)
+	case action.ChangesEmail && !strings.HasPrefix(action.RevokePath, "/"):
+		return fmt.Errorf("action %q: revoke_path must start with /", name)
+	case action.ChangesEmail && action.Invitation:
+		return fmt.Errorf("action %q: changes_email and invitation cannot be combined", name)
+	}
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -107,9 +732,49 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsSlice(key string, defaultValue []string) []string {
 	if value := os.Getenv(key); value != "" {
 		return strings.Split(value, ",")
 	}
 	return defaultValue
 }
+
+// getEnvAsMap đọc biến môi trường dạng "key1:value1,key2:value2"
+func getEnvAsMap(key string, defaultValue map[string]string) map[string]string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		result[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return result
+}
+
+// getEnvAsListMap đọc biến môi trường dạng "key1:a|b,key2:c"
+func getEnvAsListMap(key string) map[string][]string {
+	result := make(map[string][]string)
+	for name, value := range getEnvAsMap(key, map[string]string{}) {
+		for _, item := range strings.Split(value, "|") {
+			if item = strings.TrimSpace(item); item != "" {
+				result[name] = append(result[name], item)
+			}
+		}
+	}
+	return result
+}
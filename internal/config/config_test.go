@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadHashSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "unset", value: "", wantErr: true},
+		{name: "whitespace only", value: "   ", wantErr: true},
+		{name: "blank entries", value: " , ,", wantErr: true},
+		{name: "trimmed", value: " new-secret , old-secret ", want: []string{"new-secret", "old-secret"}},
+		{name: "empty entries dropped", value: "new-secret,,old-secret,", want: []string{"new-secret", "old-secret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TOKEN_HASH_SECRETS", tt.value)
+
+			cfg, err := Load()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "TOKEN_HASH_SECRETS") {
+					t.Fatalf("Load() error = %v, want TOKEN_HASH_SECRETS error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if strings.Join(cfg.Security.HashSecrets, "|") != strings.Join(tt.want, "|") {
+				t.Fatalf("HashSecrets = %q, want %q", cfg.Security.HashSecrets, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatForPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "formats.json")
+	data := `{
+		"MyApp:login": {"length": 10},
+		"*:login": {"length": 9},
+		"MyApp": {"length": 8},
+		"*": {"length": 7}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	defaultFormat := CodeFormat{Type: CodeTypeNumeric, Length: 6}
+	formats, err := loadCodeFormats(path, defaultFormat)
+	if err != nil {
+		t.Fatalf("loadCodeFormats: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		remove  []string // Key bị bỏ khỏi cấu hình trước khi tra cứu
+		system  string
+		purpose string
+		want    int
+	}{
+		{name: "system:purpose", system: "MyApp", purpose: "login", want: 10},
+		{name: "*:purpose", remove: []string{"MyApp:login"}, system: "MyApp", purpose: "login", want: 9},
+		{name: "*:purpose for other system", system: "Other", purpose: "login", want: 9},
+		{name: "system", system: "MyApp", purpose: "signup", want: 8},
+		{name: "*", system: "Other", purpose: "signup", want: 7},
+		{name: "* without purpose", system: "Other", purpose: "", want: 7},
+		{name: "default", remove: []string{"*:*"}, system: "Other", purpose: "signup", want: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := CodeConfig{Format: defaultFormat, Formats: make(map[string]CodeFormat)}
+			for key, format := range formats {
+				code.Formats[key] = format
+			}
+			for _, key := range tt.remove {
+				delete(code.Formats, key)
+			}
+
+			if got := code.FormatFor(tt.system, tt.purpose).Length; got != tt.want {
+				t.Fatalf("FormatFor(%q, %q).Length = %d, want %d", tt.system, tt.purpose, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsSharedSigningKeys(t *testing.T) {
+	seed := func(fill byte) string {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, 32))
+	}
+	privateKey := base64.RawURLEncoding.EncodeToString(append(bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{7}, 32)...))
+
+	tests := []struct {
+		name       string
+		activation string
+		receipts   string
+		wantErr    bool
+	}{
+		{name: "distinct keys", activation: "k1:" + seed(1), receipts: "r1:" + seed(2)},
+		{name: "same kid", activation: "k1:" + seed(1), receipts: "k1:" + seed(2), wantErr: true},
+		{name: "same seed", activation: "k1:" + seed(1), receipts: "r1:" + seed(1), wantErr: true},
+		{name: "same seed as private key", activation: "k1:" + seed(1), receipts: "r2:" + seed(2) + ",r1:" + privateKey, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TOKEN_HASH_SECRETS", "test-secret")
+			t.Setenv("ACTIVATION_SIGNING_KEYS", tt.activation)
+			t.Setenv("RECEIPT_SIGNING_KEYS", tt.receipts)
+
+			_, err := Load()
+			if tt.wantErr && (err == nil || !strings.Contains(err.Error(), "RECEIPT_SIGNING_KEYS")) {
+				t.Fatalf("Load() error = %v, want shared signing key error", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+		})
+	}
+}
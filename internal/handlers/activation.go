@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"crypto/subtle"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/i18n"
 	"mrs_sendemail_be/internal/models"
 	"mrs_sendemail_be/internal/services"
 	"mrs_sendemail_be/internal/utils"
@@ -14,16 +18,22 @@ import (
 )
 
 type ActivationHandler struct {
-	config       *config.Config
-	redisService *services.RedisService
-	smtpService  *services.SMTPService
+	config           *config.Config
+	redisService     *services.RedisService
+	smtpService      *services.SMTPService
+	assertionService *services.LoginAssertionService
+	tokenSigner      *services.ActivationTokenSigner
+	receiptSigner    *services.ReceiptSigner
 }
 
-func NewActivationHandler(config *config.Config, redisService *services.RedisService, smtpService *services.SMTPService) *ActivationHandler {
+func NewActivationHandler(config *config.Config, redisService *services.RedisService, smtpService *services.SMTPService, assertionService *services.LoginAssertionService, tokenSigner *services.ActivationTokenSigner, receiptSigner *services.ReceiptSigner) *ActivationHandler {
 	return &ActivationHandler{
-		config:       config,
-		redisService: redisService,
-		smtpService:  smtpService,
+		config:           config,
+		redisService:     redisService,
+		smtpService:      smtpService,
+		assertionService: assertionService,
+		tokenSigner:      tokenSigner,
+		receiptSigner:    receiptSigner,
 	}
 }
 
@@ -45,6 +55,7 @@ func (h *ActivationHandler) GenerateActivation(c *gin.Context) {
 	}
 
 	req := reqBody.(models.GenerateActivationRequest)
+	action, _ := h.config.Action(req.Action) // Action đã được kiểm tra khi bind request
 
 	clientIP, _ := c.Get("client_ip")
 
@@ -53,33 +64,83 @@ func (h *ActivationHandler) GenerateActivation(c *gin.Context) {
 	if system == "" {
 		system = h.config.Code.DefaultSystemName
 	}
+	locale := resolveLocale(c, h.config, req.Locale, system)
+
+	// Action đổi email cần địa chỉ mới khác địa chỉ hiện tại, action khác không nhận newEmail
+	if action.ChangesEmail && (req.NewEmail == "" || strings.EqualFold(req.NewEmail, req.Email)) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: i18n.T(locale, "api.activation.new_email"),
+		})
+		return
+	}
+	if !action.ChangesEmail && req.NewEmail != "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: i18n.T(locale, "api.activation.new_email_unused"),
+		})
+		return
+	}
+
+	// Action lời mời cần người mời, tổ chức và vai trò; mỗi tổ chức có lời mời riêng cho cùng một email
+	if action.Invitation != (req.Invitation != nil) {
+		key := "api.activation.invitation_required"
+		if !action.Invitation {
+			key = "api.activation.invitation_unused"
+		}
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: i18n.T(locale, key),
+		})
+		return
+	}
+	scope, tenant := "", ""
+	if req.Invitation != nil {
+		tenant = h.config.Security.TenantFor(c.GetString("api_key"))
+		scope = services.InvitationScope(tenant, req.Invitation.OrganizationID)
+	}
+
+	// Kiểm tra customData theo schema của template
+	if problems := h.smtpService.ValidateCustomData(c.Request.Context(), system, req.Action, locale, req.CustomData); len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid Custom Data",
+			Message: i18n.T(locale, "api.custom_data.invalid", strings.Join(problems, ", ")),
+			Fields:  problems,
+		})
+		return
+	}
+
+	// Tiêu đề ghi đè chỉ dành cho API key có quyền "subject"
+	if !checkSubjectOverride(c, h.config, h.smtpService, system, req.Action, locale, req.Subject) {
+		return
+	}
 
 	now := time.Now().Unix()
 
 	// Kiểm tra xem có thể gửi lại activation email không
-	canResend, nextResendAt, err := h.redisService.CheckActivationResendLimit(c.Request.Context(), req.Email, req.Action)
+	canResend, nextResendAt, err := h.redisService.CheckActivationResendLimit(c.Request.Context(), req.Email, req.Action, scope, action.MaxSends, int64(action.ResendInterval))
 	if !canResend {
 		var message string
 		var response models.ActivationResponse
 
 		if err.Error() == "maximum resend limit reached" {
-			message = "Đã đạt giới hạn tối đa 3 lần gửi email. Vui lòng thử lại sau."
+			message = i18n.T(locale, "api.activation.max_sends", action.MaxSends)
 			response = models.ActivationResponse{
 				Success:   false,
 				Message:   message,
 				CanResend: false,
-				SendCount: 3,
-				MaxSends:  3,
+				SendCount: action.MaxSends,
+				MaxSends:  action.MaxSends,
 			}
 		} else {
-			message = "Vui lòng chờ 60 giây trước khi gửi lại email."
+			message = i18n.T(locale, "api.activation.wait", action.ResendInterval)
 			response = models.ActivationResponse{
 				Success:      false,
 				Message:      message,
 				CanResend:    false,
 				NextResendAt: nextResendAt,
 				SendCount:    0, // Will be updated below
-				MaxSends:     3,
+				MaxSends:     action.MaxSends,
 			}
 		}
 
@@ -88,65 +149,126 @@ func (h *ActivationHandler) GenerateActivation(c *gin.Context) {
 	}
 
 	// Kiểm tra xem đã có token cho email và action này chưa
-	existingToken, err := h.redisService.GetActivationTokenByEmail(c.Request.Context(), req.Email, req.Action)
-
-	var token *models.ActivationToken
-
-	if err != nil {
-		// Không có token cũ, tạo token mới
-		tokenStr, err := utils.GenerateActivationToken()
-		if err != nil {
-			log.Printf("Error generating activation token: %v", err)
+	existingToken, err := h.redisService.GetActivationTokenByEmail(c.Request.Context(), req.Email, req.Action, scope)
+
+	// Đổi sang địa chỉ khác với yêu cầu đang chờ: hủy token cũ để link đã gửi tới địa chỉ trước
+	// không xác nhận được địa chỉ mới. Số lần gửi được giữ lại để không vượt giới hạn bằng cách đổi địa chỉ.
+	previousSends := 0
+	if err == nil && action.ChangesEmail && !strings.EqualFold(existingToken.NewEmail, req.NewEmail) {
+		if err := h.redisService.DeleteActivationToken(c.Request.Context(), existingToken); err != nil {
+			log.Printf("Error deleting pending email change token for %s: %v", req.Email, err)
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 				Error:   "Internal Server Error",
-				Message: "Failed to generate activation token",
+				Message: i18n.T(locale, "api.activation.update_failed"),
 			})
 			return
 		}
+		previousSends = existingToken.SendCount
+		existingToken = nil
+	}
 
+	var token *models.ActivationToken
+
+	if existingToken == nil {
+		// Không có token cũ, tạo yêu cầu mới (token được phát hành sau khi đủ thông tin để ký)
 		token = &models.ActivationToken{
-			Token:      tokenStr,
 			Email:      req.Email,
 			Action:     req.Action,
 			System:     system,
+			Locale:     locale,
+			Variant:    h.smtpService.ChooseVariant(c.Request.Context(), system, req.Action, locale),
 			CreatedAt:  now,
-			ExpiresAt:  now + (30 * 60), // 30 minutes
-			SendCount:  1,
+			ExpiresAt:  now + int64(action.TTLMinutes*60),
+			SendCount:  previousSends + 1,
 			LastSentAt: now,
+			Invitation: req.Invitation,
+			Tenant:     tenant,
+		}
+
+		if action.ChangesEmail {
+			token.NewEmail = req.NewEmail
+			if token.RevokeKey, err = utils.GenerateActivationToken(); err != nil {
+				log.Printf("Error generating revoke token: %v", err)
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+					Error:   "Internal Server Error",
+					Message: i18n.T(locale, "api.activation.generate_failed"),
+				})
+				return
+			}
 		}
 	} else {
-		// Sử dụng lại token cũ, cập nhật send count
+		// Gửi lại yêu cầu đang chờ với token mới (chỉ hash của token được lưu), cập nhật send count
 		existingToken.SendCount++
 		existingToken.LastSentAt = now
+		existingToken.Locale = locale
+		if req.Invitation != nil {
+			// Mời lại: cập nhật người mời và vai trò theo lời mời mới nhất
+			existingToken.Invitation = req.Invitation
+		}
 		token = existingToken
 	}
 
-	// Tạo activation URL
-	activationURL := utils.GenerateActivationURL(req.BaseURL, req.Action, token.Token)
+	// Gắn token với trình duyệt yêu cầu: nonce chỉ trả về cho client, Redis lưu bản băm.
+	// Yêu cầu mới thay nonce cũ, chỉ trình duyệt yêu cầu gần nhất dùng được link.
+	var nonce string
+	if req.BindBrowser {
+		if nonce, err = utils.GenerateNonce(); err != nil {
+			log.Printf("Error generating browser nonce: %v", err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: i18n.T(locale, "api.activation.generate_failed"),
+			})
+			return
+		}
+		token.NonceHash = utils.HashNonce(nonce)
+	}
 
 	// Lưu/cập nhật token vào Redis
 	if existingToken == nil {
+		if token.Token, token.TokenID, err = h.issueToken(token); err != nil {
+			log.Printf("Error generating activation token: %v", err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: i18n.T(locale, "api.activation.generate_failed"),
+			})
+			return
+		}
 		if err := h.redisService.StoreActivationToken(c.Request.Context(), token); err != nil {
 			log.Printf("Error storing activation token to Redis: %v", err)
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 				Error:   "Internal Server Error",
-				Message: "Failed to store activation token",
+				Message: i18n.T(locale, "api.activation.store_failed"),
 			})
 			return
 		}
 	} else {
-		if err := h.redisService.UpdateActivationToken(c.Request.Context(), token); err != nil {
-			log.Printf("Error updating activation token in Redis: %v", err)
+		if !h.reissueToken(c, token, locale) {
+			return
+		}
+	}
+
+	// Tạo activation URL
+	activationURL := utils.GenerateActivationURL(req.BaseURL, action.Path, token.Token)
+
+	recipient, details := activationRecipient(token)
+
+	// Yêu cầu đổi email mới: thông báo kèm link hủy tới địa chỉ hiện tại trước khi gửi link xác nhận
+	if existingToken == nil && token.RevokeKey != "" {
+		revokeURL := utils.GenerateActivationURL(req.BaseURL, action.RevokePath, token.RevokeKey)
+		if err := h.smtpService.SendEmailChangeNotice(c.Request.Context(), details, revokeURL, req.Action, system, locale, req.CustomData); err != nil {
+			log.Printf("Error sending email change notice: %v", err)
+			_ = h.redisService.DeleteActivationToken(c.Request.Context(), token)
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 				Error:   "Internal Server Error",
-				Message: "Failed to update activation token",
+				Message: i18n.T(locale, "api.activation.notice_failed"),
 			})
 			return
 		}
 	}
 
 	// Gửi email
-	if err := h.smtpService.SendActivationEmail(req.Email, activationURL, req.Action, system, req.CustomData); err != nil {
+	messageID, err := h.smtpService.SendActivationEmail(c.Request.Context(), recipient, activationURL, req.Action, system, locale, req.Subject, token.Variant, token.ExpiresAt, details, req.CustomData)
+	if err != nil {
 		log.Printf("Error sending activation email: %v", err)
 
 		// Nếu là token mới và gửi email thất bại, xóa token
@@ -156,7 +278,7 @@ func (h *ActivationHandler) GenerateActivation(c *gin.Context) {
 
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "Internal Server Error",
-			Message: "Failed to send activation email",
+			Message: i18n.T(locale, "api.activation.send_failed"),
 		})
 		return
 	}
@@ -167,20 +289,28 @@ func (h *ActivationHandler) GenerateActivation(c *gin.Context) {
 		_ = h.redisService.IncrementIPRateLimit(c.Request.Context(), clientIPStr)
 	}
 
+	// Thống kê A/B theo variant
+	if existingToken == nil {
+		h.recordVariantStat(c.Request.Context(), token, services.VariantStatIssued)
+	}
+	h.recordVariantStat(c.Request.Context(), token, services.VariantStatSent)
+
 	// Log thành công
-	log.Printf("Activation email sent successfully to %s for action %s (send count: %d)", req.Email, req.Action, token.SendCount)
+	log.Printf("Activation email sent successfully to %s for action %s (send count: %d)", recipient, req.Action, token.SendCount)
 
 	// Tính toán next resend time
-	nextResendTime := token.LastSentAt + 60
+	nextResendTime := token.LastSentAt + int64(action.ResendInterval)
 
 	// Trả về response thành công
 	response := models.ActivationResponse{
 		Success:      true,
-		Message:      "Activation email sent successfully",
-		CanResend:    token.SendCount < 3,
+		Message:      i18n.T(locale, "api.activation.sent"),
+		CanResend:    token.SendCount < action.MaxSends,
 		NextResendAt: nextResendTime,
 		SendCount:    token.SendCount,
-		MaxSends:     3,
+		MaxSends:     action.MaxSends,
+		MessageID:    messageID,
+		Nonce:        nonce,
 	}
 
 	// Chỉ trả về token trong development mode
@@ -191,8 +321,71 @@ func (h *ActivationHandler) GenerateActivation(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// VerifyActivation xác thực activation token
+// VerifyActivation xác thực activation token: kiểm tra và tiêu thụ token trong một bước,
+// cùng xử lý với /activation/consume
 func (h *ActivationHandler) VerifyActivation(c *gin.Context) {
+	h.ConsumeActivation(c)
+}
+
+// ValidateActivation kiểm tra activation token mà không tiêu thụ token, trả về thông tin của yêu cầu.
+// Trang đặt lại mật khẩu gọi khi tải trang, token chỉ bị tiêu thụ khi người dùng gửi form (/activation/consume).
+// Với issueSession, trả về session handle ngắn hạn mà /activation/consume phải gửi kèm token.
+func (h *ActivationHandler) ValidateActivation(c *gin.Context) {
+	var req models.ValidateActivationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	token, ok := h.lookupToken(c, req.Token, req.Locale)
+	if !ok {
+		return
+	}
+	locale := h.tokenLocale(c, req.Locale, token)
+	if !h.checkToken(c, req.Token, req.Nonce, locale, token) {
+		return
+	}
+
+	data := activationData(token)
+	data["expires_at"] = token.ExpiresAt
+	if req.IssueSession {
+		// Handle hết hạn sau ACTIVATION_SESSION_TTL hoặc khi token hết hạn, tùy thời điểm nào đến trước
+		sessionExpiresAt := time.Now().Unix() + int64(h.config.Tokens.SessionTTL)
+		if sessionExpiresAt > token.ExpiresAt {
+			sessionExpiresAt = token.ExpiresAt
+		}
+
+		handle, err := utils.GenerateActivationToken()
+		if err == nil {
+			err = h.redisService.StoreActivationSession(c.Request.Context(), token, handle, sessionExpiresAt)
+		}
+		if err != nil {
+			log.Printf("Error creating activation session for %s: %v", token.Email, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: i18n.T(locale, "api.activation.session_failed"),
+			})
+			return
+		}
+		data["session"] = handle
+		data["session_expires_at"] = sessionExpiresAt
+	}
+
+	log.Printf("Activation token validated for email %s with action %s", token.Email, token.Action)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": i18n.T(locale, "api.activation.valid"),
+		"data":    data,
+	})
+}
+
+// ConsumeActivation tiêu thụ token đã kiểm tra bằng /activation/validate và trả về kết quả xác thực
+// giống /verify-activation. Khi validate đã cấp session handle, request phải gửi kèm đúng handle.
+func (h *ActivationHandler) ConsumeActivation(c *gin.Context) {
 	var req models.VerifyActivationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
@@ -202,52 +395,319 @@ func (h *ActivationHandler) VerifyActivation(c *gin.Context) {
 		return
 	}
 
+	token, ok := h.lookupToken(c, req.Token, req.Locale)
+	if !ok {
+		return
+	}
+	h.completeVerification(c, req, token)
+}
+
+// lookupToken tìm token đã ký (theo chữ ký và denylist) hoặc token lưu trong Redis,
+// trả về false và ghi response lỗi nếu không tìm thấy
+func (h *ActivationHandler) lookupToken(c *gin.Context, rawToken, requestedLocale string) (*models.ActivationToken, bool) {
+	// Token đã ký được xác thực bằng chữ ký và denylist, không cần bản ghi trong Redis
+	if h.tokenSigner.IsSigned(rawToken) {
+		return h.lookupSignedToken(c, rawToken, requestedLocale)
+	}
+
 	// Lấy activation token từ Redis
-	token, err := h.redisService.GetActivationToken(c.Request.Context(), req.Token)
+	token, err := h.redisService.GetActivationToken(c.Request.Context(), rawToken)
 	if err != nil {
-		log.Printf("Error getting activation token %s: %v", req.Token, err)
+		log.Printf("Error getting activation token %s: %v", utils.TokenFingerprint(rawToken), err)
+		locale := resolveLocale(c, h.config, requestedLocale, h.config.Code.DefaultSystemName)
+		if used, _ := h.redisService.IsActivationTokenUsed(c.Request.Context(), rawToken); used {
+			h.respondTokenUsed(c, locale, utils.TokenFingerprint(rawToken))
+			return nil, false
+		}
+		if revoked, _ := h.redisService.IsActivationTokenRevoked(c.Request.Context(), rawToken); revoked {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Token Revoked",
+				Message: i18n.T(locale, "api.activation.revoked"),
+			})
+			return nil, false
+		}
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Error:   "Invalid or Expired Token",
-			Message: "Activation token not found or has expired",
+			Message: i18n.T(locale, "api.activation.not_found"),
 		})
-		return
+		return nil, false
+	}
+
+	return token, true
+}
+
+// lookupSignedToken kiểm tra chữ ký và denylist của token đã ký. Bản ghi trong Redis (nếu còn) được dùng
+// để xóa yêu cầu khi xác thực, khi Redis mất dữ liệu token vẫn xác thực được từ claims.
+func (h *ActivationHandler) lookupSignedToken(c *gin.Context, rawToken, requestedLocale string) (*models.ActivationToken, bool) {
+	locale := resolveLocale(c, h.config, requestedLocale, h.config.Code.DefaultSystemName)
+
+	token, err := h.tokenSigner.Parse(rawToken)
+	if err != nil {
+		log.Printf("Rejected signed activation token: %v", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid or Expired Token",
+			Message: i18n.T(locale, "api.activation.not_found"),
+		})
+		return nil, false
 	}
 
+	denial, err := h.redisService.GetActivationTokenDenial(c.Request.Context(), token.TokenID)
+	if err != nil {
+		log.Printf("Error checking denylist for activation token %s: %v", token.TokenID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: i18n.T(locale, "api.activation.update_failed"),
+		})
+		return nil, false
+	}
+	switch denial {
+	case "":
+	case services.TokenDenialUsed:
+		h.respondTokenUsed(c, locale, token.TokenID)
+		return nil, false
+	case services.TokenDenialRevoked:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Token Revoked",
+			Message: i18n.T(locale, "api.activation.revoked"),
+		})
+		return nil, false
+	default:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid or Expired Token",
+			Message: i18n.T(locale, "api.activation.not_found"),
+		})
+		return nil, false
+	}
+
+	if stored, err := h.redisService.GetActivationToken(c.Request.Context(), rawToken); err == nil {
+		stored.TokenID = token.TokenID
+		return stored, true
+	}
+	return token, true
+}
+
+// tokenLocale trả về locale của response: locale trong request, mặc định locale lúc tạo token
+func (h *ActivationHandler) tokenLocale(c *gin.Context, requestedLocale string, token *models.ActivationToken) string {
+	if requestedLocale == "" {
+		requestedLocale = token.Locale
+	}
+	return resolveLocale(c, h.config, requestedLocale, token.System)
+}
+
+// checkToken kiểm tra hạn dùng và trình duyệt của token đã tìm thấy, trả về false và ghi response lỗi nếu không hợp lệ
+func (h *ActivationHandler) checkToken(c *gin.Context, rawToken, nonce, locale string, token *models.ActivationToken) bool {
 	// Kiểm tra xem token đã hết hạn chưa
 	now := time.Now().Unix()
 	if now > token.ExpiresAt {
-		log.Printf("Activation token %s has expired", req.Token)
-		// Xóa token đã hết hạn
-		_ = h.redisService.DeleteActivationToken(c.Request.Context(), token)
+		log.Printf("Activation token %s has expired", utils.TokenFingerprint(rawToken))
+		// Xóa token đã hết hạn (token đã ký không còn bản ghi thì không có gì để xóa)
+		if token.TokenHash != "" {
+			_ = h.redisService.DeleteActivationToken(c.Request.Context(), token)
+		}
 
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Error:   "Expired Token",
-			Message: "Activation token has expired",
+			Message: i18n.T(locale, "api.activation.expired"),
+		})
+		return false
+	}
+
+	// Token gắn với trình duyệt: nonce phải khớp với nonce trả về khi generate
+	if token.NonceHash != "" && subtle.ConstantTimeCompare([]byte(utils.HashNonce(nonce)), []byte(token.NonceHash)) != 1 {
+		log.Printf("Browser nonce mismatch for activation token %s", utils.TokenFingerprint(rawToken))
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "Browser Mismatch",
+			Message: i18n.T(locale, "api.activation.browser_mismatch"),
+		})
+		return false
+	}
+
+	return true
+}
+
+// completeVerification kiểm tra token đã tìm thấy và session handle (nếu có), tiêu thụ token và trả về kết quả xác thực
+func (h *ActivationHandler) completeVerification(c *gin.Context, req models.VerifyActivationRequest, token *models.ActivationToken) {
+	locale := h.tokenLocale(c, req.Locale, token)
+	if !h.checkToken(c, req.Token, req.Nonce, locale, token) {
+		return
+	}
+
+	// Token đã được cấp session handle qua /activation/validate: chỉ request mang đúng handle mới tiêu thụ được token
+	matched, err := h.redisService.MatchActivationSession(c.Request.Context(), token, req.Session)
+	if err != nil {
+		log.Printf("Error checking activation session for %s: %v", token.Email, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: i18n.T(locale, "api.activation.update_failed"),
+		})
+		return
+	}
+	if !matched {
+		log.Printf("Activation session mismatch for token %s", utils.TokenFingerprint(req.Token))
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "Invalid Session",
+			Message: i18n.T(locale, "api.activation.session_invalid"),
 		})
 		return
 	}
 
-	// Token hợp lệ, xóa khỏi Redis để tránh sử dụng lại
-	if err := h.redisService.DeleteActivationToken(c.Request.Context(), token); err != nil {
-		log.Printf("Error deleting activation token %s: %v", req.Token, err)
-		// Không trả lỗi ở đây vì việc xác thực đã thành công
+	action, known := h.config.Action(token.Action)
+	if action.Assertion && !h.assertionService.Enabled() {
+		// Không tiêu thụ token khi chưa thể cấp assertion
+		log.Printf("Cannot verify %s token %s: %v", token.Action, utils.TokenFingerprint(req.Token), services.ErrAssertionsDisabled)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: i18n.T(locale, "api.activation.assertion_failed"),
+		})
+		return
 	}
 
+	// Token hợp lệ, xóa khỏi Redis để tránh sử dụng lại (trừ action cho phép dùng nhiều lần tới khi hết hạn).
+	// Khi nhiều request dùng cùng link đồng thời, chỉ một request xác thực thành công.
+	if !known || action.SingleUse {
+		consumed, err := h.redisService.ConsumeActivationToken(c.Request.Context(), token)
+		if err != nil {
+			log.Printf("Error consuming activation token %s: %v", utils.TokenFingerprint(req.Token), err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: i18n.T(locale, "api.activation.update_failed"),
+			})
+			return
+		}
+		if !consumed {
+			h.respondTokenUsed(c, locale, utils.TokenFingerprint(req.Token))
+			return
+		}
+	}
+
+	data := activationData(token)
+	if action.Assertion {
+		assertion, expiresAt, err := h.assertionService.Sign(token)
+		if err != nil {
+			log.Printf("Error signing login assertion for %s: %v", token.Email, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: i18n.T(locale, "api.activation.assertion_failed"),
+			})
+			return
+		}
+		data["assertion"] = assertion
+		data["assertion_expires_at"] = expiresAt
+	}
+	if h.receiptSigner.Enabled() {
+		// Receipt ký bằng khóa công bố qua JWKS, service phía sau kiểm tra được mà không cần gọi lại API
+		receipt, expiresAt, err := h.receiptSigner.Sign(models.VerificationReceiptClaims{
+			Email:    token.Email,
+			NewEmail: token.NewEmail,
+			System:   token.System,
+			Action:   token.Action,
+			Tenant:   h.config.Security.TenantFor(c.GetString("api_key")),
+		})
+		if err != nil {
+			// Token đã được tiêu thụ, vẫn trả về kết quả xác thực nhưng không có receipt
+			log.Printf("Error signing verification receipt for %s: %v", token.Email, err)
+		} else {
+			data["receipt"] = receipt
+			data["receipt_expires_at"] = expiresAt
+		}
+	}
+
+	h.recordVariantStat(c.Request.Context(), token, services.VariantStatConverted)
+
 	// Log thành công
 	log.Printf("Activation successful for email %s with action %s", token.Email, token.Action)
 
 	// Trả về response thành công với thông tin token
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Activation successful",
+		"message": i18n.T(locale, "api.activation.verified"),
+		"data":    data,
+	})
+}
+
+// activationData trả về thông tin của yêu cầu trong response xác thực
+func activationData(token *models.ActivationToken) gin.H {
+	data := gin.H{
+		"email":  token.Email,
+		"action": token.Action,
+		"system": token.System,
+	}
+	if token.NewEmail != "" {
+		// Đổi email: user service cập nhật old_email thành new_email
+		data["old_email"] = token.Email
+		data["new_email"] = token.NewEmail
+	}
+	if token.Invitation != nil {
+		data["invitation"] = token.Invitation
+	}
+	return data
+}
+
+// RevokeActivation hủy yêu cầu đổi email bằng link hủy gửi tới địa chỉ hiện tại
+func (h *ActivationHandler) RevokeActivation(c *gin.Context) {
+	var req models.RevokeActivationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	token, err := h.redisService.GetActivationTokenByRevokeKey(c.Request.Context(), req.Token)
+	if err != nil {
+		log.Printf("Error getting activation token for revoke token %s: %v", utils.TokenFingerprint(req.Token), err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid or Expired Token",
+			Message: i18n.T(resolveLocale(c, h.config, req.Locale, h.config.Code.DefaultSystemName), "api.activation.not_found"),
+		})
+		return
+	}
+
+	locale := req.Locale
+	if locale == "" {
+		locale = token.Locale
+	}
+	locale = resolveLocale(c, h.config, locale, token.System)
+
+	revoked, err := h.redisService.RevokeActivationToken(c.Request.Context(), token)
+	if err != nil {
+		log.Printf("Error revoking email change token for %s: %v", token.Email, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: i18n.T(locale, "api.activation.revoke_failed"),
+		})
+		return
+	}
+	if !revoked {
+		// Địa chỉ mới đã được xác nhận trước khi hủy
+		h.respondTokenUsed(c, locale, token.TokenHash)
+		return
+	}
+
+	log.Printf("Email change from %s to %s revoked", token.Email, token.NewEmail)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": i18n.T(locale, "api.activation.revoke_done"),
 		"data": gin.H{
-			"email":  token.Email,
-			"action": token.Action,
-			"system": token.System,
+			"email":     token.Email,
+			"new_email": token.NewEmail,
+			"action":    token.Action,
+			"system":    token.System,
 		},
 	})
 }
 
+// respondTokenUsed trả về lỗi khi link đã được sử dụng, tokenRef là jti, hash hoặc fingerprint của token (không phải token gốc)
+func (h *ActivationHandler) respondTokenUsed(c *gin.Context, locale, tokenRef string) {
+	log.Printf("Rejected reuse of activation token %s", tokenRef)
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Error:   "Token Already Used",
+		Message: i18n.T(locale, "api.activation.used"),
+	})
+}
+
 // ResendActivation gửi lại activation email
 func (h *ActivationHandler) ResendActivation(c *gin.Context) {
 	// Lấy request từ context (đã được validate bởi middleware)
@@ -266,31 +726,51 @@ func (h *ActivationHandler) ResendActivation(c *gin.Context) {
 	}
 
 	req := reqBody.(models.ResendActivationRequest)
+	action, _ := h.config.Action(req.Action) // Action đã được kiểm tra khi bind request
+
+	// Lời mời được tìm theo tổ chức trong tenant của API key
+	scope := ""
+	if action.Invitation {
+		scope = services.InvitationScope(h.config.Security.TenantFor(c.GetString("api_key")), req.OrganizationID)
+	}
+
+	// Locale ưu tiên theo request, sau đó là locale đã dùng khi generate
+	requestedLocale := req.Locale
+	if requestedLocale == "" {
+		if existing, err := h.redisService.GetActivationTokenByEmail(c.Request.Context(), req.Email, req.Action, scope); err == nil {
+			requestedLocale = existing.Locale
+		}
+	}
+	system := req.System
+	if system == "" {
+		system = h.config.Code.DefaultSystemName
+	}
+	locale := resolveLocale(c, h.config, requestedLocale, system)
 
 	// Kiểm tra xem có thể gửi lại không
-	canResend, nextResendAt, err := h.redisService.CheckActivationResendLimit(c.Request.Context(), req.Email, req.Action)
+	canResend, nextResendAt, err := h.redisService.CheckActivationResendLimit(c.Request.Context(), req.Email, req.Action, scope, action.MaxSends, int64(action.ResendInterval))
 	if !canResend {
 		var message string
 		var response models.ActivationResponse
 
 		if err.Error() == "maximum resend limit reached" {
-			message = "Đã đạt giới hạn tối đa 3 lần gửi email."
+			message = i18n.T(locale, "api.activation.max_sends", action.MaxSends)
 			response = models.ActivationResponse{
 				Success:   false,
 				Message:   message,
 				CanResend: false,
-				SendCount: 3,
-				MaxSends:  3,
+				SendCount: action.MaxSends,
+				MaxSends:  action.MaxSends,
 			}
 		} else {
-			message = "Vui lòng chờ 60 giây trước khi gửi lại email."
+			message = i18n.T(locale, "api.activation.wait", action.ResendInterval)
 			response = models.ActivationResponse{
 				Success:      false,
 				Message:      message,
 				CanResend:    false,
 				NextResendAt: nextResendAt,
 				SendCount:    0, // Will be updated if we can get existing token
-				MaxSends:     3,
+				MaxSends:     action.MaxSends,
 			}
 		}
 
@@ -299,11 +779,11 @@ func (h *ActivationHandler) ResendActivation(c *gin.Context) {
 	}
 
 	// Lấy token hiện tại
-	existingToken, err := h.redisService.GetActivationTokenByEmail(c.Request.Context(), req.Email, req.Action)
+	existingToken, err := h.redisService.GetActivationTokenByEmail(c.Request.Context(), req.Email, req.Action, scope)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Error:   "No Active Token",
-			Message: "No activation token found for this email and action",
+			Message: i18n.T(locale, "api.activation.no_active"),
 		})
 		return
 	}
@@ -312,28 +792,16 @@ func (h *ActivationHandler) ResendActivation(c *gin.Context) {
 	now := time.Now().Unix()
 	existingToken.SendCount++
 	existingToken.LastSentAt = now
+	existingToken.Locale = locale
 
-	// Tạo activation URL
-	// BaseURL sẽ được set từ config hoặc request khi gửi email
-
-	// Cập nhật token trong Redis
-	if err := h.redisService.UpdateActivationToken(c.Request.Context(), existingToken); err != nil {
-		log.Printf("Error updating activation token in Redis: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Internal Server Error",
-			Message: "Failed to update activation token",
-		})
+	// Cập nhật token trong Redis, link gửi lại dùng token mới và link cũ hết hiệu lực
+	if !h.reissueToken(c, existingToken, locale) {
 		return
 	}
 
 	// Gửi lại email (sử dụng baseURL từ request hoặc config)
-	system := existingToken.System
-	if system == "" {
-		if req.System != "" {
-			system = req.System
-		} else {
-			system = h.config.Code.DefaultSystemName
-		}
+	if existingToken.System != "" {
+		system = existingToken.System
 	}
 
 	// Sử dụng baseURL từ request, nếu không có thì dùng default từ config
@@ -342,32 +810,92 @@ func (h *ActivationHandler) ResendActivation(c *gin.Context) {
 		// Default to localhost for development if not provided
 		baseURL = "http://localhost:3000"
 	}
-	fullActivationURL := utils.GenerateActivationURL(baseURL, req.Action, existingToken.Token)
+	fullActivationURL := utils.GenerateActivationURL(baseURL, action.Path, existingToken.Token)
 
-	if err := h.smtpService.SendActivationEmail(req.Email, fullActivationURL, req.Action, system, nil); err != nil {
+	recipient, details := activationRecipient(existingToken)
+	messageID, err := h.smtpService.SendActivationEmail(c.Request.Context(), recipient, fullActivationURL, req.Action, system, locale, "", existingToken.Variant, existingToken.ExpiresAt, details, nil)
+	if err != nil {
 		log.Printf("Error resending activation email: %v", err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "Internal Server Error",
-			Message: "Failed to resend activation email",
+			Message: i18n.T(locale, "api.activation.resend_failed"),
 		})
 		return
 	}
 
+	h.recordVariantStat(c.Request.Context(), existingToken, services.VariantStatSent)
+
 	// Log thành công
-	log.Printf("Activation email resent successfully to %s for action %s (send count: %d)", req.Email, req.Action, existingToken.SendCount)
+	log.Printf("Activation email resent successfully to %s for action %s (send count: %d)", recipient, req.Action, existingToken.SendCount)
 
 	// Tính toán next resend time
-	nextResendTime := existingToken.LastSentAt + 60
+	nextResendTime := existingToken.LastSentAt + int64(action.ResendInterval)
 
 	// Trả về response thành công
 	response := models.ActivationResponse{
 		Success:      true,
-		Message:      "Activation email resent successfully",
-		CanResend:    existingToken.SendCount < 3,
+		Message:      i18n.T(locale, "api.activation.resent"),
+		CanResend:    existingToken.SendCount < action.MaxSends,
 		NextResendAt: nextResendTime,
 		SendCount:    existingToken.SendCount,
-		MaxSends:     3,
+		MaxSends:     action.MaxSends,
+		MessageID:    messageID,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
+
+// issueToken phát hành token cho yêu cầu: token đã ký (kèm jti) khi ACTIVATION_TOKEN_MODE=signed,
+// ngược lại là UUID ngẫu nhiên
+func (h *ActivationHandler) issueToken(token *models.ActivationToken) (string, string, error) {
+	if h.tokenSigner.Enabled() {
+		return h.tokenSigner.Sign(token)
+	}
+	tokenStr, err := utils.GenerateActivationToken()
+	return tokenStr, "", err
+}
+
+// reissueToken thay token của yêu cầu đang chờ bằng token mới trước khi gửi lại email,
+// trả về false và ghi response lỗi nếu không thành công
+func (h *ActivationHandler) reissueToken(c *gin.Context, token *models.ActivationToken, locale string) bool {
+	newToken, newTokenID, err := h.issueToken(token)
+	if err != nil {
+		log.Printf("Error generating activation token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: i18n.T(locale, "api.activation.generate_failed"),
+		})
+		return false
+	}
+
+	if err := h.redisService.ReissueActivationToken(c.Request.Context(), token, newToken, newTokenID); err != nil {
+		log.Printf("Error updating activation token in Redis: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: i18n.T(locale, "api.activation.update_failed"),
+		})
+		return false
+	}
+	return true
+}
+
+// activationRecipient trả về địa chỉ nhận link của token (địa chỉ mới với yêu cầu đổi email)
+// và thông tin riêng của luồng để hiển thị trong email
+func activationRecipient(token *models.ActivationToken) (string, services.ActivationDetails) {
+	details := services.ActivationDetails{Invitation: token.Invitation}
+	if token.NewEmail == "" {
+		return token.Email, details
+	}
+	details.OldEmail, details.NewEmail = token.Email, token.NewEmail
+	return token.NewEmail, details
+}
+
+// recordVariantStat tăng bộ đếm A/B của variant đã dùng cho token (bỏ qua nếu token không có variant)
+func (h *ActivationHandler) recordVariantStat(ctx context.Context, token *models.ActivationToken, counter string) {
+	if token.Variant == "" {
+		return
+	}
+	if err := h.redisService.IncrementVariantStat(ctx, token.System, token.Action, token.Variant, counter); err != nil {
+		log.Printf("Error recording %s stat for variant %s: %v", counter, token.Variant, err)
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestConfig trả về cấu hình mặc định trỏ tới Redis giả lập
+func newTestConfig(t *testing.T, mr *miniredis.Miniredis) *config.Config {
+	t.Helper()
+	t.Setenv("TOKEN_HASH_SECRETS", "test-secret")
+	t.Setenv("REDIS_HOST", mr.Host())
+	t.Setenv("REDIS_PORT", mr.Port())
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	return cfg
+}
+
+func newActivationTestRouter(t *testing.T) (*gin.Engine, *services.RedisService) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	cfg := newTestConfig(t, mr)
+	redisService := services.NewRedisService(cfg)
+	tokenSigner, err := services.NewActivationTokenSigner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiptSigner, err := services.NewReceiptSigner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewActivationHandler(cfg, redisService, nil, services.NewLoginAssertionService(cfg), tokenSigner, receiptSigner)
+	router := gin.New()
+	router.POST("/verify-activation", handler.VerifyActivation)
+	router.POST("/activation/validate", handler.ValidateActivation)
+	router.POST("/activation/consume", handler.ConsumeActivation)
+	return router, redisService
+}
+
+func storeTestActivationToken(t *testing.T, redisService *services.RedisService, raw string) {
+	t.Helper()
+	now := time.Now().Unix()
+	token := &models.ActivationToken{
+		Token:     raw,
+		Email:     "user@example.com",
+		Action:    "password_reset",
+		System:    "Fix4Home",
+		Locale:    "en",
+		CreatedAt: now,
+		ExpiresAt: now + 1800,
+	}
+	if err := redisService.StoreActivationToken(context.Background(), token); err != nil {
+		t.Fatalf("StoreActivationToken: %v", err)
+	}
+}
+
+func postJSON(t *testing.T, router http.Handler, path string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("%s: invalid JSON response %q", path, rec.Body.String())
+	}
+	return rec.Code, out
+}
+
+func TestValidateActivationDoesNotConsume(t *testing.T) {
+	router, redisService := newActivationTestRouter(t)
+	storeTestActivationToken(t, redisService, "token-1")
+
+	for i := 0; i < 2; i++ {
+		code, out := postJSON(t, router, "/activation/validate", gin.H{"token": "token-1"})
+		if code != http.StatusOK {
+			t.Fatalf("validate #%d: got %d %v", i+1, code, out)
+		}
+		data := out["data"].(map[string]interface{})
+		if data["email"] != "user@example.com" || data["action"] != "password_reset" {
+			t.Fatalf("validate #%d: unexpected data %v", i+1, data)
+		}
+		if _, ok := data["session"]; ok {
+			t.Fatalf("validate #%d: session issued without issueSession", i+1)
+		}
+	}
+
+	if code, out := postJSON(t, router, "/activation/consume", gin.H{"token": "token-1"}); code != http.StatusOK {
+		t.Fatalf("consume: got %d %v", code, out)
+	}
+	if code, out := postJSON(t, router, "/activation/validate", gin.H{"token": "token-1"}); code != http.StatusBadRequest || out["error"] != "Token Already Used" {
+		t.Fatalf("validate after consume: got %d %v", code, out)
+	}
+}
+
+func TestConsumeActivationRequiresSession(t *testing.T) {
+	router, redisService := newActivationTestRouter(t)
+	storeTestActivationToken(t, redisService, "token-2")
+
+	code, out := postJSON(t, router, "/activation/validate", gin.H{"token": "token-2", "issueSession": true})
+	if code != http.StatusOK {
+		t.Fatalf("validate: got %d %v", code, out)
+	}
+	session, _ := out["data"].(map[string]interface{})["session"].(string)
+	if session == "" {
+		t.Fatalf("validate: no session in %v", out)
+	}
+
+	rejected := []struct {
+		name string
+		path string
+		body gin.H
+	}{
+		{"consume without session", "/activation/consume", gin.H{"token": "token-2"}},
+		{"consume with wrong session", "/activation/consume", gin.H{"token": "token-2", "session": "wrong"}},
+		{"verify-activation without session", "/verify-activation", gin.H{"token": "token-2"}},
+	}
+	for _, tc := range rejected {
+		if code, out := postJSON(t, router, tc.path, tc.body); code != http.StatusForbidden || out["error"] != "Invalid Session" {
+			t.Fatalf("%s: got %d %v", tc.name, code, out)
+		}
+	}
+
+	// Token vẫn dùng được sau các request bị từ chối
+	if code, out := postJSON(t, router, "/activation/consume", gin.H{"token": "token-2", "session": session}); code != http.StatusOK {
+		t.Fatalf("consume with session: got %d %v", code, out)
+	}
+	if code, out := postJSON(t, router, "/activation/consume", gin.H{"token": "token-2", "session": session}); code != http.StatusBadRequest {
+		t.Fatalf("second consume: got %d %v", code, out)
+	}
+}
+
+func TestValidateActivationReissueInvalidatesOldSession(t *testing.T) {
+	router, redisService := newActivationTestRouter(t)
+	storeTestActivationToken(t, redisService, "token-3")
+
+	sessionFor := func() string {
+		code, out := postJSON(t, router, "/activation/validate", gin.H{"token": "token-3", "issueSession": true})
+		if code != http.StatusOK {
+			t.Fatalf("validate: got %d %v", code, out)
+		}
+		return out["data"].(map[string]interface{})["session"].(string)
+	}
+	first := sessionFor()
+	second := sessionFor()
+
+	if code, out := postJSON(t, router, "/activation/consume", gin.H{"token": "token-3", "session": first}); code != http.StatusForbidden {
+		t.Fatalf("consume with replaced session: got %d %v", code, out)
+	}
+	if code, out := postJSON(t, router, "/activation/consume", gin.H{"token": "token-3", "session": second}); code != http.StatusOK {
+		t.Fatalf("consume with current session: got %d %v", code, out)
+	}
+}
+
+func TestActivationLogsDoNotContainRawTokens(t *testing.T) {
+	router, redisService := newActivationTestRouter(t)
+	storeTestActivationToken(t, redisService, "raw-token-used")
+	storeTestActivationToken(t, redisService, "raw-token-session")
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	// Token đã dùng, session không khớp và token không tồn tại đều ghi log
+	postJSON(t, router, "/activation/consume", gin.H{"token": "raw-token-used"})
+	postJSON(t, router, "/verify-activation", gin.H{"token": "raw-token-used"})
+	postJSON(t, router, "/activation/validate", gin.H{"token": "raw-token-session", "issueSession": true})
+	postJSON(t, router, "/activation/consume", gin.H{"token": "raw-token-session", "session": "wrong"})
+	postJSON(t, router, "/verify-activation", gin.H{"token": "raw-token-unknown"})
+
+	if logs.Len() == 0 {
+		t.Fatal("expected log output")
+	}
+	if strings.Contains(logs.String(), "raw-token-") {
+		t.Fatalf("raw token written to logs:\n%s", logs.String())
+	}
+}
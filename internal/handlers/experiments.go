@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExperimentHandler struct {
+	redisService *services.RedisService
+}
+
+func NewExperimentHandler(redisService *services.RedisService) *ExperimentHandler {
+	return &ExperimentHandler{
+		redisService: redisService,
+	}
+}
+
+// Stats trả về số token tạo ra, email gửi đi và tỉ lệ kích hoạt theo từng variant A/B của system/action
+func (h *ExperimentHandler) Stats(c *gin.Context) {
+	system := c.Query("system")
+	action := c.Query("action")
+	if system == "" || action == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: "system and action are required",
+		})
+		return
+	}
+
+	counters, err := h.redisService.GetVariantStats(c.Request.Context(), system, action)
+	if err != nil {
+		log.Printf("Error getting variant stats for %s/%s: %v", system, action, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: "Failed to load variant stats",
+		})
+		return
+	}
+
+	stats := make([]models.VariantStats, 0, len(counters))
+	for variant, counter := range counters {
+		entry := models.VariantStats{
+			Variant:   variant,
+			Issued:    counter[services.VariantStatIssued],
+			Sent:      counter[services.VariantStatSent],
+			Converted: counter[services.VariantStatConverted],
+		}
+		if entry.Issued > 0 {
+			entry.ConversionRate = float64(entry.Converted) / float64(entry.Issued)
+		}
+		stats = append(stats, entry)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Variant < stats[j].Variant
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    stats,
+	})
+}
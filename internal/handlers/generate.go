@@ -3,8 +3,10 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"strings"
 
 	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/i18n"
 	"mrs_sendemail_be/internal/models"
 	"mrs_sendemail_be/internal/services"
 	"mrs_sendemail_be/internal/utils"
@@ -13,20 +15,22 @@ import (
 )
 
 type GenerateHandler struct {
-	config       *config.Config
-	redisService *services.RedisService
-	smtpService  *services.SMTPService
+	config         *config.Config
+	redisService   *services.RedisService
+	smtpService    *services.SMTPService
+	channelService *services.ChannelService
 }
 
-func NewGenerateHandler(config *config.Config, redisService *services.RedisService, smtpService *services.SMTPService) *GenerateHandler {
+func NewGenerateHandler(config *config.Config, redisService *services.RedisService, smtpService *services.SMTPService, channelService *services.ChannelService) *GenerateHandler {
 	return &GenerateHandler{
-		config:       config,
-		redisService: redisService,
-		smtpService:  smtpService,
+		config:         config,
+		redisService:   redisService,
+		smtpService:    smtpService,
+		channelService: channelService,
 	}
 }
 
-// Generate sinh mã xác thực và gửi email
+// Generate sinh mã xác thực và gửi qua email hoặc kênh được chọn (SMS, Zalo, Telegram)
 func (h *GenerateHandler) Generate(c *gin.Context) {
 	// Lấy request từ context (đã được validate bởi middleware)
 	reqBody, exists := c.Get("request_body")
@@ -46,43 +50,101 @@ func (h *GenerateHandler) Generate(c *gin.Context) {
 	req := reqBody.(models.GenerateRequest)
 	clientIP, _ := c.Get("client_ip")
 
-	// Sinh mã xác thực
-	code, err := utils.GenerateVerificationCode(h.config.Code.Length)
+	// Sử dụng system name mặc định nếu không có
+	system := req.System
+	if system == "" {
+		system = h.config.Code.DefaultSystemName
+	}
+	locale := resolveLocale(c, h.config, req.Locale, system)
+
+	channel := req.Channel
+	if channel == "" {
+		channel = config.ChannelEmail
+	}
+
+	var recipient string
+	if channel == config.ChannelEmail {
+		// Kiểm tra customData theo schema của template
+		if problems := h.smtpService.ValidateCustomData(c.Request.Context(), system, services.TemplateActionCode, locale, req.CustomData); len(problems) > 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Invalid Custom Data",
+				Message: i18n.T(locale, "api.custom_data.invalid", strings.Join(problems, ", ")),
+				Fields:  problems,
+			})
+			return
+		}
+
+		// Tiêu đề ghi đè chỉ dành cho API key có quyền "subject"
+		if !checkSubjectOverride(c, h.config, h.smtpService, system, services.TemplateActionCode, locale, req.Subject) {
+			return
+		}
+	} else {
+		// customData và tiêu đề chỉ dùng cho template email, không gửi kèm tin nhắn của kênh
+		var fields []string
+		if len(req.CustomData) > 0 {
+			fields = append(fields, "customData")
+		}
+		if req.Subject != "" {
+			fields = append(fields, "subject")
+		}
+		if len(fields) > 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Bad Request",
+				Message: i18n.T(locale, "api.channel.email_only_fields", strings.Join(fields, ", "), channel),
+				Fields:  fields,
+			})
+			return
+		}
+
+		// Mã vẫn gắn với email, kênh chỉ thay đổi nơi nhận mã
+		var ok bool
+		if recipient, ok = h.channelRecipient(c, req, channel, locale); !ok {
+			return
+		}
+	}
+
+	// Sinh mã xác thực theo định dạng của system và mục đích
+	scope := codeScope(c, h.config, system, req.Purpose)
+	format := h.config.Code.FormatFor(system, scope.Purpose)
+	code, err := utils.GenerateVerificationCode(format.Characters(), format.Length)
 	if err != nil {
 		log.Printf("Error generating verification code: %v", err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "Internal Server Error",
-			Message: "Failed to generate verification code",
+			Message: i18n.T(locale, "api.code.generate_failed"),
 		})
 		return
 	}
 
-	// Sử dụng system name mặc định nếu không có
-	system := req.System
-	if system == "" {
-		system = h.config.Code.DefaultSystemName
-	}
-
-	// Lưu mã xác thực vào Redis
-	if err := h.redisService.StoreVerificationCode(c.Request.Context(), req.Email, code, system); err != nil {
+	// Lưu mã xác thực vào Redis theo tenant, system và mục đích
+	if err := h.redisService.StoreVerificationCode(c.Request.Context(), scope, req.Email, code); err != nil {
 		log.Printf("Error storing verification code to Redis: %v", err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "Internal Server Error",
-			Message: "Failed to store verification code",
+			Message: i18n.T(locale, "api.code.store_failed"),
 		})
 		return
 	}
 
-	// Gửi email
-	if err := h.smtpService.SendVerificationEmail(req.Email, code, system, req.CustomData); err != nil {
-		log.Printf("Error sending verification email: %v", err)
+	// Gửi mã, mã hiển thị theo nhóm nếu định dạng có group_size
+	displayCode := utils.FormatCode(code, format.GroupSize, format.Separator)
+	var sendErr error
+	failedKey := "api.code.send_failed"
+	if channel == config.ChannelEmail {
+		sendErr = h.smtpService.SendVerificationEmail(c.Request.Context(), req.Email, displayCode, system, locale, req.Subject, req.CustomData)
+	} else {
+		sendErr = h.channelService.SendCode(c.Request.Context(), channel, recipient, displayCode, system, locale)
+		failedKey = "api.channel.send_failed"
+	}
+	if sendErr != nil {
+		log.Printf("Error sending verification code via %s: %v", channel, sendErr)
 
-		// Xóa mã khỏi Redis nếu gửi email thất bại
-		_ = h.redisService.DeleteVerificationCode(c.Request.Context(), req.Email)
+		// Xóa mã khỏi Redis nếu gửi thất bại
+		_ = h.redisService.DeleteVerificationCode(c.Request.Context(), scope, req.Email)
 
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "Internal Server Error",
-			Message: "Failed to send verification email",
+			Message: i18n.T(locale, failedKey),
 		})
 		return
 	}
@@ -94,11 +156,65 @@ func (h *GenerateHandler) Generate(c *gin.Context) {
 	}
 
 	// Log thành công
-	log.Printf("Verification code sent successfully to %s from system %s", req.Email, system)
+	log.Printf("Verification code sent successfully to %s via %s from system %s (purpose %s)", req.Email, channel, system, scope.Purpose)
 
 	// Trả về response thành công
 	c.JSON(http.StatusOK, models.SuccessResponse{
 		Success: true,
-		Message: "Verification code sent successfully",
+		Message: i18n.T(locale, "api.code.sent"),
 	})
 }
+
+// channelRecipient lấy người nhận của kênh từ request (phone hoặc chatId) và tính lượt gửi vào rate limit
+// của người nhận trước khi gửi, trả về false và ghi response nếu không hợp lệ hoặc vượt giới hạn
+func (h *GenerateHandler) channelRecipient(c *gin.Context, req models.GenerateRequest, channel, locale string) (string, bool) {
+	channelConfig := h.config.Channels[channel]
+	field := channelConfig.RecipientField()
+
+	recipient := req.Phone
+	if field == "chatId" {
+		recipient = req.ChatID
+	}
+	if recipient == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: i18n.T(locale, "api.channel.recipient_required", field, channel),
+			Fields:  []string{field},
+		})
+		return "", false
+	}
+
+	if channelConfig.RateLimitPerHour > 0 {
+		count, err := h.redisService.IncrementChannelRateLimit(c.Request.Context(), channel, recipient)
+		if err != nil {
+			log.Printf("Error checking %s rate limit for %s: %v", channel, recipient, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to check channel rate limit",
+			})
+			return "", false
+		}
+		if count > int64(channelConfig.RateLimitPerHour) {
+			log.Printf("Channel rate limit exceeded for %s %s (%d per hour)", channel, recipient, count)
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Error:   "Rate Limit Exceeded",
+				Message: i18n.T(locale, "api.channel.rate_limited", channelConfig.RateLimitPerHour),
+			})
+			return "", false
+		}
+	}
+
+	return recipient, true
+}
+
+// codeScope trả về scope của mã xác thực: tenant của API key đã xác thực, system và mục đích (mặc định "default")
+func codeScope(c *gin.Context, cfg *config.Config, system, purpose string) models.CodeScope {
+	if purpose == "" {
+		purpose = models.DefaultCodePurpose
+	}
+	return models.CodeScope{
+		Tenant:  cfg.Security.TenantFor(c.GetString("api_key")),
+		System:  system,
+		Purpose: purpose,
+	}
+}
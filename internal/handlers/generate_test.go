@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// newGenerateTestRouter tạo router /generate với kênh "sms" (webhook) giới hạn limit tin mỗi giờ cho một số điện thoại,
+// trả về số request provider đã nhận
+func newGenerateTestRouter(t *testing.T, limit int) (*gin.Engine, *int64) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var sent int64
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&sent, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(provider.Close)
+
+	channelsFile := filepath.Join(t.TempDir(), "channels.json")
+	channels := fmt.Sprintf(`{"sms": {"provider": "webhook", "url": %q, "rate_limit_per_hour": %d}}`, provider.URL, limit)
+	if err := os.WriteFile(channelsFile, []byte(channels), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CHANNELS_FILE", channelsFile)
+
+	cfg := newTestConfig(t, miniredis.RunT(t))
+	if err := RegisterValidators(cfg); err != nil {
+		t.Fatal(err)
+	}
+	redisService := services.NewRedisService(cfg)
+	templateService := services.NewTemplateService(cfg, redisService)
+	smtpService := services.NewSMTPService(cfg, services.NewBrandingService(cfg, nil), templateService, nil)
+	channelService, err := services.NewChannelService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("api_key", testAPIKey) })
+	router.POST("/generate", NewGenerateHandler(cfg, redisService, smtpService, channelService).Generate)
+	return router, &sent
+}
+
+func TestGenerateChannelRejectsEmailOnlyFields(t *testing.T) {
+	router, sent := newGenerateTestRouter(t, 5)
+
+	tests := []struct {
+		name string
+		body gin.H
+	}{
+		{"customData", gin.H{"customData": gin.H{"name": "Bob"}}},
+		{"subject", gin.H{"subject": "Your code"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := gin.H{"email": "user@example.com", "channel": "sms", "phone": "+84901234567"}
+			for k, v := range tt.body {
+				body[k] = v
+			}
+			code, out := postJSON(t, router, "/generate", body)
+			fields, _ := out["fields"].([]interface{})
+			if code != http.StatusBadRequest || len(fields) != 1 || fields[0] != tt.name {
+				t.Fatalf("got %d %v", code, out)
+			}
+		})
+	}
+
+	if *sent != 0 {
+		t.Fatalf("provider received %d messages for rejected requests", *sent)
+	}
+}
+
+func TestGenerateChannelRateLimitHoldsUnderConcurrency(t *testing.T) {
+	const limit = 3
+	router, sent := newGenerateTestRouter(t, limit)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = map[int]int{}
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			code, _ := postJSON(t, router, "/generate", gin.H{
+				"email":   fmt.Sprintf("user%d@example.com", i),
+				"channel": "sms",
+				"phone":   "+84901234567",
+			})
+			mu.Lock()
+			results[code]++
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	if results[http.StatusOK] != limit || results[http.StatusTooManyRequests] != 10-limit {
+		t.Fatalf("status counts = %v, want %d sent and the rest rate limited", results, limit)
+	}
+	if atomic.LoadInt64(sent) != limit {
+		t.Fatalf("provider received %d messages, want %d", *sent, limit)
+	}
+}
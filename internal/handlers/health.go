@@ -9,14 +9,16 @@ import (
 )
 
 type HealthHandler struct {
-	redisService *services.RedisService
-	smtpService  *services.SMTPService
+	redisService    *services.RedisService
+	smtpService     *services.SMTPService
+	templateService *services.TemplateService
 }
 
-func NewHealthHandler(redisService *services.RedisService, smtpService *services.SMTPService) *HealthHandler {
+func NewHealthHandler(redisService *services.RedisService, smtpService *services.SMTPService, templateService *services.TemplateService) *HealthHandler {
 	return &HealthHandler{
-		redisService: redisService,
-		smtpService:  smtpService,
+		redisService:    redisService,
+		smtpService:     smtpService,
+		templateService: templateService,
 	}
 }
 
@@ -52,9 +54,17 @@ func (h *HealthHandler) HealthCheck(c *gin.Context) {
 		statusCode = http.StatusServiceUnavailable
 	}
 	
+	// /health là endpoint public: lỗi reload chứa đường dẫn và nội dung template,
+	// chỉ được ghi log và trả về qua /admin/templates/revision
+	templates := h.templateService.Revision()
+	if templates != nil {
+		templates.LastError = ""
+	}
+
 	response := models.HealthCheckResponse{
-		Status: status,
-		Checks: checks,
+		Status:    status,
+		Checks:    checks,
+		Templates: templates,
 	}
 	
 	c.JSON(statusCode, response)
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func TestHealthDoesNotExposeTemplateErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "registration.en.html"), []byte("<p>{{.Message</p>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEMPLATE_DIR", dir)
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", "1")
+
+	cfg := newTestConfig(t, miniredis.RunT(t))
+	redisService := services.NewRedisService(cfg)
+	templateService := services.NewTemplateService(cfg, redisService)
+	if err := templateService.LoadTemplateDir(); err == nil {
+		t.Fatal("LoadTemplateDir accepted an invalid template")
+	}
+	smtpService := services.NewSMTPService(cfg, services.NewBrandingService(cfg, nil), templateService, nil)
+
+	router := gin.New()
+	router.GET("/health", NewHealthHandler(redisService, smtpService, templateService).HealthCheck)
+	router.GET("/admin/templates/revision", NewTemplateHandler(templateService).Revision)
+
+	// Lỗi parse chứa đường dẫn và nội dung template
+	_, health := serveWithKey(t, router, http.MethodGet, "/health", "", nil)
+	if strings.Contains(string(health), "last_error") || strings.Contains(string(health), "registration.en.html") {
+		t.Fatalf("/health exposes the template error: %s", health)
+	}
+	if !strings.Contains(string(health), `"templates"`) {
+		t.Fatalf("/health has no template revision: %s", health)
+	}
+
+	status, admin := serveWithKey(t, router, http.MethodGet, "/admin/templates/revision", "", nil)
+	if status != http.StatusOK || !strings.Contains(string(admin), "registration.en.html") {
+		t.Fatalf("/admin/templates/revision: status %d, body %s", status, admin)
+	}
+}
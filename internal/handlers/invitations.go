@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultInvitationAction là action lời mời dùng khi request không chỉ định
+const defaultInvitationAction = "invitation"
+
+type InvitationHandler struct {
+	config       *config.Config
+	redisService *services.RedisService
+}
+
+func NewInvitationHandler(config *config.Config, redisService *services.RedisService) *InvitationHandler {
+	return &InvitationHandler{
+		config:       config,
+		redisService: redisService,
+	}
+}
+
+// List trả về các lời mời đang chờ chấp nhận của tổ chức trong tenant của API key, sắp xếp theo thời điểm hết hạn
+func (h *InvitationHandler) List(c *gin.Context) {
+	organizationID := c.Query("organizationId")
+	if organizationID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: "organizationId is required",
+		})
+		return
+	}
+
+	tenant := h.config.Security.TenantFor(c.GetString("api_key"))
+	tokens, err := h.redisService.ListInvitations(c.Request.Context(), tenant, organizationID)
+	if err != nil {
+		log.Printf("Error listing invitations for organization %s: %v", organizationID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: "Failed to load invitations",
+		})
+		return
+	}
+
+	invitations := make([]models.PendingInvitation, 0, len(tokens))
+	for _, token := range tokens {
+		invitations = append(invitations, models.PendingInvitation{
+			Email:      token.Email,
+			Action:     token.Action,
+			System:     token.System,
+			Invitation: token.Invitation,
+			CreatedAt:  token.CreatedAt,
+			ExpiresAt:  token.ExpiresAt,
+			SendCount:  token.SendCount,
+			LastSentAt: token.LastSentAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    invitations,
+	})
+}
+
+// Revoke hủy lời mời đang chờ của một email trong tổ chức, link đã gửi trả về "Token Revoked" khi xác thực
+func (h *InvitationHandler) Revoke(c *gin.Context) {
+	var req models.RevokeInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	actionName := req.Action
+	if actionName == "" {
+		actionName = defaultInvitationAction
+	}
+	if action, ok := h.config.Action(actionName); !ok || !action.Invitation {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: "action is not an invitation action",
+		})
+		return
+	}
+
+	scope := services.InvitationScope(h.config.Security.TenantFor(c.GetString("api_key")), req.OrganizationID)
+	token, err := h.redisService.GetActivationTokenByEmail(c.Request.Context(), req.Email, actionName, scope)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Not Found",
+			Message: "No pending invitation for this email and organization",
+		})
+		return
+	}
+
+	revoked, err := h.redisService.RevokeActivationToken(c.Request.Context(), token)
+	if err != nil {
+		log.Printf("Error revoking invitation for %s in organization %s: %v", req.Email, req.OrganizationID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: "Failed to revoke invitation",
+		})
+		return
+	}
+	if !revoked {
+		// Lời mời đã được chấp nhận trước khi hủy
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Conflict",
+			Message: "Invitation has already been accepted",
+		})
+		return
+	}
+
+	log.Printf("Invitation for %s in organization %s revoked", req.Email, req.OrganizationID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"email":      token.Email,
+			"action":     token.Action,
+			"invitation": token.Invitation,
+		},
+	})
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// newInvitationTestRouter tạo router /invitations, API key của request lấy từ header X-API-Key
+func newInvitationTestRouter(t *testing.T) (*gin.Engine, *services.RedisService, *config.Config) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	cfg := newTestConfig(t, mr)
+	redisService := services.NewRedisService(cfg)
+
+	handler := NewInvitationHandler(cfg, redisService)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("api_key", c.GetHeader("X-API-Key"))
+	})
+	router.GET("/invitations", handler.List)
+	router.POST("/invitations/revoke", handler.Revoke)
+	return router, redisService, cfg
+}
+
+// serveWithKey gửi request JSON với API key, trả về status và response
+func serveWithKey(t *testing.T, router http.Handler, method, path, apiKey string, body interface{}) (int, []byte) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", apiKey)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.Bytes()
+}
+
+func storeTestInvitation(t *testing.T, redisService *services.RedisService, tenant, raw string) {
+	t.Helper()
+	now := time.Now().Unix()
+	token := &models.ActivationToken{
+		Token:     raw,
+		Email:     "user@example.com",
+		Action:    "invitation",
+		System:    "Fix4Home",
+		Locale:    "en",
+		Tenant:    tenant,
+		CreatedAt: now,
+		ExpiresAt: now + 3600,
+		Invitation: &models.Invitation{
+			InviterName:      "Alice",
+			OrganizationID:   "org-1",
+			OrganizationName: "Acme",
+			Role:             "member",
+		},
+	}
+	if err := redisService.StoreActivationToken(context.Background(), token); err != nil {
+		t.Fatalf("StoreActivationToken: %v", err)
+	}
+}
+
+func TestInvitationsAreIsolatedByTenant(t *testing.T) {
+	router, redisService, cfg := newInvitationTestRouter(t)
+	tenantA, tenantB := cfg.Security.TenantFor("key-a"), cfg.Security.TenantFor("key-b")
+	storeTestInvitation(t, redisService, tenantA, "token-a")
+
+	list := func(apiKey string) int {
+		status, body := serveWithKey(t, router, http.MethodGet, "/invitations?organizationId=org-1", apiKey, nil)
+		var resp struct {
+			Data []models.PendingInvitation `json:"data"`
+		}
+		if err := json.Unmarshal(body, &resp); status != http.StatusOK || err != nil {
+			t.Fatalf("list with %s: status %d, body %s", apiKey, status, body)
+		}
+		return len(resp.Data)
+	}
+	if n := list("key-a"); n != 1 {
+		t.Fatalf("tenant A sees %d invitations, want 1", n)
+	}
+	if n := list("key-b"); n != 0 {
+		t.Fatalf("tenant B sees %d invitations of tenant A", n)
+	}
+
+	// Tenant B dùng cùng organizationId và email: lời mời mới không thay lời mời của tenant A
+	ctx := context.Background()
+	if _, err := redisService.GetActivationTokenByEmail(ctx, "user@example.com", "invitation", services.InvitationScope(tenantB, "org-1")); err == nil {
+		t.Fatal("tenant B finds the pending invitation of tenant A")
+	}
+	storeTestInvitation(t, redisService, tenantB, "token-b")
+	if n := list("key-a"); n != 1 {
+		t.Fatalf("tenant A sees %d invitations after tenant B invited, want 1", n)
+	}
+
+	revoke := models.RevokeInvitationRequest{OrganizationID: "org-1", Email: "user@example.com"}
+	if status, _ := serveWithKey(t, router, http.MethodPost, "/invitations/revoke", "key-b", revoke); status != http.StatusOK {
+		t.Fatalf("tenant B revoke: status %d, want 200", status)
+	}
+	if status, _ := serveWithKey(t, router, http.MethodPost, "/invitations/revoke", "key-b", revoke); status != http.StatusNotFound {
+		t.Fatalf("tenant B second revoke: status %d, want 404", status)
+	}
+	if _, err := redisService.GetActivationTokenByEmail(ctx, "user@example.com", "invitation", services.InvitationScope(tenantA, "org-1")); err != nil {
+		t.Fatalf("tenant B revoked the invitation of tenant A: %v", err)
+	}
+	if n := list("key-a"); n != 1 {
+		t.Fatalf("tenant A sees %d invitations after tenant B revoked its own, want 1", n)
+	}
+}
@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resolveLocale xác định locale cho request: field locale > Accept-Language > locale mặc định của system
+func resolveLocale(c *gin.Context, cfg *config.Config, requested, system string) string {
+	return i18n.Resolve(requested, c.GetHeader("Accept-Language"), cfg.I18n.LocaleFor(system))
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/services"
+	"mrs_sendemail_be/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testAssertionSecret = "assertion-secret"
+
+// storeTestLoginToken lưu token magic link (action login) gắn với trình duyệt có nonce
+func storeTestLoginToken(t *testing.T, redisService *services.RedisService, raw, nonce string) {
+	t.Helper()
+	now := time.Now().Unix()
+	token := &models.ActivationToken{
+		Token:     raw,
+		Email:     "user@example.com",
+		Action:    "login",
+		System:    "Fix4Home",
+		Locale:    "en",
+		NonceHash: utils.HashNonce(nonce),
+		CreatedAt: now,
+		ExpiresAt: now + 600,
+	}
+	if err := redisService.StoreActivationToken(context.Background(), token); err != nil {
+		t.Fatalf("StoreActivationToken: %v", err)
+	}
+}
+
+// parseTestAssertion kiểm tra chữ ký HS256 của login assertion bằng secret dùng chung và trả về claims
+func parseTestAssertion(t *testing.T, assertion string) models.LoginAssertionClaims {
+	t.Helper()
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		t.Fatalf("assertion %q is not a JWS", assertion)
+	}
+
+	var header map[string]string
+	headerJSON, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header["alg"] != "HS256" || header["typ"] != "JWT" {
+		t.Fatalf("assertion header = %s", headerJSON)
+	}
+
+	mac := hmac.New(sha256.New, []byte(testAssertionSecret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		t.Fatal("assertion signature does not match LOGIN_ASSERTION_SECRET")
+	}
+
+	var claims models.LoginAssertionClaims
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestLoginLinkRequiresNonceAndIsSingleUse(t *testing.T) {
+	t.Setenv("LOGIN_ASSERTION_SECRET", testAssertionSecret)
+	t.Setenv("LOGIN_ASSERTION_TTL", "120")
+	router, redisService := newActivationTestRouter(t)
+	storeTestLoginToken(t, redisService, "login-token", "browser-nonce")
+
+	rejected := []struct {
+		name string
+		body gin.H
+	}{
+		{"missing nonce", gin.H{"token": "login-token"}},
+		{"wrong nonce", gin.H{"token": "login-token", "nonce": "other-nonce"}},
+	}
+	for _, tc := range rejected {
+		if code, out := postJSON(t, router, "/verify-activation", tc.body); code != http.StatusForbidden || out["error"] != "Browser Mismatch" {
+			t.Fatalf("%s: got %d %v", tc.name, code, out)
+		}
+	}
+
+	// Link vẫn dùng được từ đúng trình duyệt sau các request bị từ chối
+	code, out := postJSON(t, router, "/verify-activation", gin.H{"token": "login-token", "nonce": "browser-nonce"})
+	if code != http.StatusOK {
+		t.Fatalf("verify with nonce: got %d %v", code, out)
+	}
+	data := out["data"].(map[string]interface{})
+	assertion, _ := data["assertion"].(string)
+	claims := parseTestAssertion(t, assertion)
+
+	now := time.Now().Unix()
+	if claims.Subject != "user@example.com" || claims.Audience != "Fix4Home" || claims.Issuer != "mrs_sendemail_be" ||
+		claims.Action != "login" || claims.ID == "" || !claims.BrowserBound ||
+		len(claims.AuthMethods) != 1 || claims.AuthMethods[0] != "email_link" {
+		t.Fatalf("assertion claims = %+v", claims)
+	}
+	if claims.ExpiresAt-claims.IssuedAt != 120 || claims.IssuedAt > now || claims.IssuedAt < now-5 {
+		t.Fatalf("assertion iat/exp = %d/%d, want a 120 second lifetime from now", claims.IssuedAt, claims.ExpiresAt)
+	}
+	if data["assertion_expires_at"] != float64(claims.ExpiresAt) {
+		t.Fatalf("assertion_expires_at = %v, want %d", data["assertion_expires_at"], claims.ExpiresAt)
+	}
+
+	if code, out := postJSON(t, router, "/verify-activation", gin.H{"token": "login-token", "nonce": "browser-nonce"}); code != http.StatusBadRequest || out["error"] != "Token Already Used" {
+		t.Fatalf("second verify: got %d %v", code, out)
+	}
+}
+
+func TestLoginLinkNotConsumedWithoutAssertions(t *testing.T) {
+	t.Setenv("LOGIN_ASSERTION_SECRET", "")
+	router, redisService := newActivationTestRouter(t)
+	storeTestLoginToken(t, redisService, "login-token", "browser-nonce")
+
+	for i := 0; i < 2; i++ {
+		code, out := postJSON(t, router, "/verify-activation", gin.H{"token": "login-token", "nonce": "browser-nonce"})
+		if code != http.StatusInternalServerError {
+			t.Fatalf("verify #%d without assertions: got %d %v", i+1, code, out)
+		}
+		if _, ok := out["data"]; ok {
+			t.Fatalf("verify #%d without assertions returned data %v", i+1, out)
+		}
+	}
+
+	if _, err := redisService.GetActivationToken(context.Background(), "login-token"); err != nil {
+		t.Fatalf("login token consumed although no assertion could be issued: %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReceiptHandler struct {
+	receiptSigner *services.ReceiptSigner
+}
+
+func NewReceiptHandler(receiptSigner *services.ReceiptSigner) *ReceiptHandler {
+	return &ReceiptHandler{
+		receiptSigner: receiptSigner,
+	}
+}
+
+// JWKS công bố public key dùng để kiểm tra receipt xác thực (danh sách rỗng khi chưa cấu hình khóa)
+func (h *ReceiptHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.receiptSigner.JWKS())
+}
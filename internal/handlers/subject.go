@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/i18n"
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkSubjectOverride kiểm tra quyền và cú pháp của tiêu đề ghi đè trong request.
+// Trả về false (đã ghi response lỗi) nếu không hợp lệ.
+func checkSubjectOverride(c *gin.Context, cfg *config.Config, smtpService *services.SMTPService, system, action, locale, subject string) bool {
+	if subject == "" {
+		return true
+	}
+
+	if !cfg.Security.HasPermission(c.GetString("api_key"), config.PermissionSubjectOverride) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "Forbidden",
+			Message: i18n.T(locale, "api.subject.forbidden"),
+		})
+		return false
+	}
+
+	if err := smtpService.ValidateSubject(c.Request.Context(), system, action, locale, subject); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid Subject",
+			Message: i18n.T(locale, "api.subject.invalid", err.Error()),
+		})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TemplateHandler struct {
+	templateService *services.TemplateService
+}
+
+func NewTemplateHandler(templateService *services.TemplateService) *TemplateHandler {
+	return &TemplateHandler{
+		templateService: templateService,
+	}
+}
+
+// Create tạo template mới cho system/action/locale
+func (h *TemplateHandler) Create(c *gin.Context) {
+	h.save(c, h.templateService.Create, http.StatusCreated)
+}
+
+// Update lưu version mới cho template đã tồn tại
+func (h *TemplateHandler) Update(c *gin.Context) {
+	h.save(c, h.templateService.Update, http.StatusOK)
+}
+
+func (h *TemplateHandler) save(c *gin.Context, save func(ctx context.Context, tmpl models.EmailTemplate) (*models.EmailTemplate, error), successStatus int) {
+	var req models.TemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	tmpl, err := save(c.Request.Context(), models.EmailTemplate{
+		System:   req.System,
+		Action:   req.Action,
+		Locale:   req.Locale,
+		HTML:     req.HTML,
+		Markdown: req.Markdown,
+		Subject:  req.Subject,
+		Variants: req.Variants,
+		Schema:   req.Schema,
+		Comment:  req.Comment,
+	})
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	log.Printf("Template %s/%s/%s saved as version %d", tmpl.System, tmpl.Action, tmpl.Locale, tmpl.Version)
+
+	c.JSON(successStatus, gin.H{
+		"success": true,
+		"data":    tmpl,
+	})
+}
+
+// List trả về version đang dùng của mọi template được quản lý
+func (h *TemplateHandler) List(c *gin.Context) {
+	templates, err := h.templateService.List(c.Request.Context())
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    templates,
+	})
+}
+
+// Versions trả về lịch sử version của một template
+func (h *TemplateHandler) Versions(c *gin.Context) {
+	versions, err := h.templateService.Versions(
+		c.Request.Context(),
+		c.Query("system"),
+		c.Query("action"),
+		c.Query("locale"),
+	)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    versions,
+	})
+}
+
+// Revision trả về bộ template đang dùng từ TEMPLATE_DIR kèm lỗi của lần reload gần nhất bị từ chối
+func (h *TemplateHandler) Revision(c *gin.Context) {
+	revision := h.templateService.Revision()
+	if revision == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Not Found",
+			Message: "TEMPLATE_DIR is not configured",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    revision,
+	})
+}
+
+// Rollback đặt lại một version cũ làm version đang dùng
+func (h *TemplateHandler) Rollback(c *gin.Context) {
+	var req models.TemplateRollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	tmpl, err := h.templateService.Rollback(c.Request.Context(), req.System, req.Action, req.Locale, req.Version)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	log.Printf("Template %s/%s/%s rolled back to version %d", tmpl.System, tmpl.Action, tmpl.Locale, tmpl.Version)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tmpl,
+	})
+}
+
+// respondTemplateError chuyển lỗi từ TemplateService thành response HTTP
+func respondTemplateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidTemplate):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid Template",
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrTemplateNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Not Found",
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrTemplateExists):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Conflict",
+			Message: err.Error(),
+		})
+	default:
+		log.Printf("Template management error: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: "Failed to process template request",
+		})
+	}
+}
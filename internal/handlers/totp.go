@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/i18n"
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// totpPurpose là purpose của scope TOTP, đăng ký được tách theo tenant (API key), system và email
+const totpPurpose = "totp"
+
+type TOTPHandler struct {
+	config       *config.Config
+	redisService *services.RedisService
+	totpService  *services.TOTPService
+}
+
+func NewTOTPHandler(config *config.Config, redisService *services.RedisService, totpService *services.TOTPService) *TOTPHandler {
+	return &TOTPHandler{
+		config:       config,
+		redisService: redisService,
+		totpService:  totpService,
+	}
+}
+
+// Enroll sinh secret TOTP mới, trả về otpauth:// URI và mã QR để quét bằng ứng dụng authenticator.
+// Đăng ký chỉ có hiệu lực sau khi được xác nhận qua /totp/confirm. Email đã có đăng ký phải gửi kèm
+// mã hiện tại hoặc recovery code.
+func (h *TOTPHandler) Enroll(c *gin.Context) {
+	var req models.TOTPEnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	scope := h.scope(c, req.System)
+	locale := resolveLocale(c, h.config, req.Locale, scope.System)
+	if req.Code != "" && req.RecoveryCode != "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: i18n.T(locale, "api.totp.code_required"),
+			Fields:  []string{"code", "recoveryCode"},
+		})
+		return
+	}
+
+	// Đăng ký lại cần mã hiện tại: cùng giới hạn với /totp/verify để chống dò mã
+	if !checkVerifyThrottle(c, h.config, h.redisService, req.Email, req.Locale) {
+		return
+	}
+
+	result, err := h.totpService.Enroll(c.Request.Context(), scope, req.Email, req.AccountName, req.Code, req.RecoveryCode)
+	if err != nil {
+		h.respondReauthError(c, err, locale, req.Email, req.RecoveryCode != "", "api.totp.enroll_failed")
+		return
+	}
+
+	log.Printf("TOTP enrollment started for %s with system %s", req.Email, scope.System)
+	c.JSON(http.StatusOK, models.TOTPEnrollResponse{
+		Success:    true,
+		Message:    i18n.T(locale, "api.totp.enrolled"),
+		Secret:     result.Secret,
+		OTPAuthURI: result.URI,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(result.QRCode),
+		ExpiresAt:  result.ExpiresAt,
+	})
+}
+
+// Confirm kích hoạt đăng ký đang chờ bằng mã đầu tiên từ ứng dụng, trả về recovery code (chỉ hiển thị một lần)
+func (h *TOTPHandler) Confirm(c *gin.Context) {
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	scope := h.scope(c, req.System)
+	locale := resolveLocale(c, h.config, req.Locale, scope.System)
+	if req.Code == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: i18n.T(locale, "api.totp.code_required"),
+			Fields:  []string{"code"},
+		})
+		return
+	}
+
+	if !checkVerifyThrottle(c, h.config, h.redisService, req.Email, req.Locale) {
+		return
+	}
+
+	recoveryCodes, err := h.totpService.Confirm(c.Request.Context(), scope, req.Email, req.Code)
+	if err != nil {
+		if errors.Is(err, services.ErrTOTPNotEnrolled) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "Enrollment Not Found",
+				Message: i18n.T(locale, "api.totp.no_pending"),
+			})
+			return
+		}
+		h.respondError(c, err, locale, req.Email, "api.totp.failed")
+		return
+	}
+
+	log.Printf("TOTP enrollment confirmed for %s with system %s", req.Email, scope.System)
+	c.JSON(http.StatusOK, models.TOTPRecoveryCodesResponse{
+		Success:       true,
+		Message:       i18n.T(locale, "api.totp.confirmed"),
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// Verify xác thực mã TOTP, hoặc recovery code khi người dùng mất thiết bị
+func (h *TOTPHandler) Verify(c *gin.Context) {
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	scope := h.scope(c, req.System)
+	locale := resolveLocale(c, h.config, req.Locale, scope.System)
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: i18n.T(locale, "api.totp.code_required"),
+			Fields:  []string{"code", "recoveryCode"},
+		})
+		return
+	}
+
+	// Giới hạn số lần xác thực theo IP và email để chống dò mã
+	if !checkVerifyThrottle(c, h.config, h.redisService, req.Email, req.Locale) {
+		return
+	}
+
+	if req.RecoveryCode != "" {
+		remaining, err := h.totpService.VerifyRecoveryCode(c.Request.Context(), scope, req.Email, req.RecoveryCode)
+		if err != nil {
+			h.respondReauthError(c, err, locale, req.Email, true, "api.totp.failed")
+			return
+		}
+
+		log.Printf("Recovery code used for %s with system %s (%d left)", req.Email, scope.System, remaining)
+		c.JSON(http.StatusOK, models.TOTPVerifyResponse{
+			Success:                true,
+			Message:                i18n.T(locale, "api.totp.verified"),
+			Method:                 models.TOTPMethodRecoveryCode,
+			RemainingRecoveryCodes: &remaining,
+		})
+		return
+	}
+
+	if err := h.totpService.Verify(c.Request.Context(), scope, req.Email, req.Code); err != nil {
+		h.respondError(c, err, locale, req.Email, "api.totp.failed")
+		return
+	}
+
+	log.Printf("TOTP verification successful for %s with system %s", req.Email, scope.System)
+	c.JSON(http.StatusOK, models.TOTPVerifyResponse{
+		Success: true,
+		Message: i18n.T(locale, "api.totp.verified"),
+		Method:  models.TOTPMethodCode,
+	})
+}
+
+// RecoveryCodes sinh bộ recovery code mới sau khi kiểm tra mã hiện tại hoặc recovery code, các code cũ không còn dùng được
+func (h *TOTPHandler) RecoveryCodes(c *gin.Context) {
+	req, scope, locale, ok := h.bindAccountRequest(c)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.totpService.RegenerateRecoveryCodes(c.Request.Context(), scope, req.Email, req.Code, req.RecoveryCode)
+	if err != nil {
+		h.respondReauthError(c, err, locale, req.Email, req.RecoveryCode != "", "api.totp.failed")
+		return
+	}
+
+	log.Printf("Recovery codes regenerated for %s with system %s", req.Email, scope.System)
+	c.JSON(http.StatusOK, models.TOTPRecoveryCodesResponse{
+		Success:       true,
+		Message:       i18n.T(locale, "api.totp.recovery_generated"),
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// Disable tắt xác thực bằng ứng dụng authenticator của email sau khi kiểm tra mã hiện tại hoặc recovery code
+func (h *TOTPHandler) Disable(c *gin.Context) {
+	req, scope, locale, ok := h.bindAccountRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := h.totpService.Disable(c.Request.Context(), scope, req.Email, req.Code, req.RecoveryCode); err != nil {
+		h.respondReauthError(c, err, locale, req.Email, req.RecoveryCode != "", "api.totp.failed")
+		return
+	}
+
+	log.Printf("TOTP disabled for %s with system %s", req.Email, scope.System)
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: i18n.T(locale, "api.totp.disabled_done"),
+	})
+}
+
+// bindAccountRequest đọc request của /totp/recovery-codes và /totp/disable: bắt buộc đúng một trong code
+// và recoveryCode, áp dụng giới hạn của /totp/verify. Trả về false và ghi response nếu không hợp lệ.
+func (h *TOTPHandler) bindAccountRequest(c *gin.Context) (models.TOTPAccountRequest, models.CodeScope, string, bool) {
+	var req models.TOTPAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+		})
+		return req, models.CodeScope{}, "", false
+	}
+
+	scope := h.scope(c, req.System)
+	locale := resolveLocale(c, h.config, req.Locale, scope.System)
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad Request",
+			Message: i18n.T(locale, "api.totp.code_required"),
+			Fields:  []string{"code", "recoveryCode"},
+		})
+		return req, scope, locale, false
+	}
+
+	if !checkVerifyThrottle(c, h.config, h.redisService, req.Email, req.Locale) {
+		return req, scope, locale, false
+	}
+	return req, scope, locale, true
+}
+
+func (h *TOTPHandler) scope(c *gin.Context, system string) models.CodeScope {
+	if system == "" {
+		system = h.config.Code.DefaultSystemName
+	}
+	return codeScope(c, h.config, system, totpPurpose)
+}
+
+// respondError chuyển lỗi của TOTPService thành response, lỗi không xác định trả về 500 với message failedKey
+func (h *TOTPHandler) respondError(c *gin.Context, err error, locale, email, failedKey string) {
+	switch {
+	case errors.Is(err, services.ErrTOTPDisabled):
+		log.Printf("Cannot handle TOTP request for %s: %v", email, err)
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Service Unavailable",
+			Message: i18n.T(locale, "api.totp.disabled"),
+		})
+	case errors.Is(err, services.ErrTOTPReauthRequired):
+		log.Printf("TOTP change without a current code rejected for %s", email)
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "Reauthentication Required",
+			Message: i18n.T(locale, "api.totp.reauth_required"),
+			Fields:  []string{"code", "recoveryCode"},
+		})
+	case errors.Is(err, services.ErrTOTPNotEnrolled):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Not Enrolled",
+			Message: i18n.T(locale, "api.totp.not_enrolled"),
+		})
+	case errors.Is(err, services.ErrTOTPInvalidCode):
+		log.Printf("Invalid TOTP code attempt for %s", email)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid Code",
+			Message: i18n.T(locale, "api.totp.invalid"),
+		})
+	case errors.Is(err, services.ErrTOTPCodeReused):
+		log.Printf("Reused TOTP code rejected for %s", email)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Code Already Used",
+			Message: i18n.T(locale, "api.totp.reused"),
+		})
+	default:
+		log.Printf("Error handling TOTP request for %s: %v", email, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: i18n.T(locale, failedKey),
+		})
+	}
+}
+
+// respondReauthError như respondError, recovery code không đúng được báo riêng với mã TOTP sai
+func (h *TOTPHandler) respondReauthError(c *gin.Context, err error, locale, email string, usedRecoveryCode bool, failedKey string) {
+	if usedRecoveryCode && errors.Is(err, services.ErrTOTPInvalidCode) {
+		log.Printf("Invalid recovery code attempt for %s", email)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid Recovery Code",
+			Message: i18n.T(locale, "api.totp.recovery_invalid"),
+		})
+		return
+	}
+	h.respondError(c, err, locale, email, failedKey)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// testTOTPCode tính mã TOTP 6 chữ số, chu kỳ 30 giây (RFC 6238) từ secret base32 trả về khi đăng ký
+func testTOTPCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// newTOTPTestRouter tạo router /totp với khóa mã hóa secret, giới hạn xác thực emailLimit lần mỗi giờ cho một email
+func newTOTPTestRouter(t *testing.T, emailLimit int) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	t.Setenv("TOTP_ENCRYPTION_KEY_ID", "k1")
+	t.Setenv("TOTP_ENCRYPTION_KEYS", "k1:"+base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	t.Setenv("RATE_LIMIT_VERIFY_EMAIL_PER_HOUR", fmt.Sprint(emailLimit))
+	cfg := newTestConfig(t, miniredis.RunT(t))
+	redisService := services.NewRedisService(cfg)
+	totpService, err := services.NewTOTPService(cfg, redisService)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewTOTPHandler(cfg, redisService, totpService)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("api_key", testAPIKey) })
+	router.POST("/totp/enroll", handler.Enroll)
+	router.POST("/totp/confirm", handler.Confirm)
+	router.POST("/totp/recovery-codes", handler.RecoveryCodes)
+	router.POST("/totp/disable", handler.Disable)
+	return router
+}
+
+func TestTOTPAccountChangesRequireCurrentCode(t *testing.T) {
+	router := newTOTPTestRouter(t, 6)
+	email := "user@example.com"
+
+	// Đăng ký lần đầu không cần mã
+	code, out := postJSON(t, router, "/totp/enroll", gin.H{"email": email})
+	if code != http.StatusOK {
+		t.Fatalf("first enroll: got %d %v", code, out)
+	}
+	secret := out["secret"].(string)
+	code, out = postJSON(t, router, "/totp/confirm", gin.H{"email": email, "code": testTOTPCode(t, secret, time.Now())})
+	if code != http.StatusOK {
+		t.Fatalf("confirm: got %d %v", code, out)
+	}
+	recoveryCodes := out["recovery_codes"].([]interface{})
+
+	requests := []struct {
+		name   string
+		path   string
+		body   gin.H
+		status int
+		error  string
+	}{
+		{"re-enroll without code", "/totp/enroll", gin.H{"email": email}, http.StatusForbidden, "Reauthentication Required"},
+		{"disable without code", "/totp/disable", gin.H{"email": email}, http.StatusBadRequest, "Bad Request"},
+		{"recovery codes with wrong recovery code", "/totp/recovery-codes", gin.H{"email": email, "recoveryCode": "ZZZZZ-ZZZZZ"}, http.StatusBadRequest, "Invalid Recovery Code"},
+		{"disable with wrong code", "/totp/disable", gin.H{"email": email, "code": "12345"}, http.StatusBadRequest, "Invalid Code"},
+		{"disable with recovery code", "/totp/disable", gin.H{"email": email, "recoveryCode": recoveryCodes[0]}, http.StatusOK, ""},
+		// Lượt thứ 7 tính vào giới hạn của email (không tính request thiếu mã bị từ chối trước khi kiểm tra)
+		{"throttled", "/totp/disable", gin.H{"email": email, "recoveryCode": recoveryCodes[1]}, http.StatusTooManyRequests, "Rate Limit Exceeded"},
+	}
+	for _, tc := range requests {
+		code, out := postJSON(t, router, tc.path, tc.body)
+		if code != tc.status || (tc.error != "" && out["error"] != tc.error) {
+			t.Fatalf("%s: got %d %v, want %d %s", tc.name, code, out, tc.status, tc.error)
+		}
+	}
+}
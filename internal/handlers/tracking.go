@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trackingPixel là ảnh GIF trong suốt 1x1
+var trackingPixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+type TrackingHandler struct {
+	trackingService *services.TrackingService
+}
+
+func NewTrackingHandler(trackingService *services.TrackingService) *TrackingHandler {
+	return &TrackingHandler{
+		trackingService: trackingService,
+	}
+}
+
+// Open ghi nhận email đã được mở và trả về ảnh 1x1 (luôn trả ảnh kể cả khi message không tồn tại)
+func (h *TrackingHandler) Open(c *gin.Context) {
+	h.trackingService.RecordOpen(c.Request.Context(), c.Param("id"))
+
+	c.Header("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+	c.Data(http.StatusOK, "image/gif", trackingPixel)
+}
+
+// Click ghi nhận click và chuyển hướng tới link kích hoạt thật
+func (h *TrackingHandler) Click(c *gin.Context) {
+	target, err := h.trackingService.RecordClick(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "This link has expired")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, target)
+}
+
+// Events trả về các sự kiện (sent, open, click) của một message
+func (h *TrackingHandler) Events(c *gin.Context) {
+	message, events, err := h.trackingService.Events(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Not Found",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"message": message,
+			"events":  events,
+		},
+	})
+}
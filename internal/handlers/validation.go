@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+
+	"mrs_sendemail_be/internal/config"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// RegisterValidators đăng ký các rule validate dùng trong binding của request:
+// activation_action chỉ chấp nhận action được khai báo trong cấu hình (ACTIONS_FILE),
+// code_purpose chỉ chấp nhận tên mục đích của mã xác thực (chữ thường, số, "_"),
+// delivery_channel chỉ chấp nhận "email" hoặc kênh được khai báo trong CHANNELS_FILE
+func RegisterValidators(cfg *config.Config) error {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return fmt.Errorf("unsupported binding validator engine %T", binding.Validator.Engine())
+	}
+
+	if err := engine.RegisterValidation("activation_action", func(field validator.FieldLevel) bool {
+		_, ok := cfg.Action(field.Field().String())
+		return ok
+	}); err != nil {
+		return err
+	}
+
+	if err := engine.RegisterValidation("code_purpose", func(field validator.FieldLevel) bool {
+		return codePurposePattern.MatchString(field.Field().String())
+	}); err != nil {
+		return err
+	}
+
+	return engine.RegisterValidation("delivery_channel", func(field validator.FieldLevel) bool {
+		name := field.Field().String()
+		_, ok := cfg.Channels[name]
+		return ok || name == config.ChannelEmail
+	})
+}
+
+var codePurposePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
@@ -4,19 +4,26 @@ import (
 	"log"
 	"net/http"
 
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/i18n"
 	"mrs_sendemail_be/internal/models"
 	"mrs_sendemail_be/internal/services"
+	"mrs_sendemail_be/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type VerifyHandler struct {
-	redisService *services.RedisService
+	config        *config.Config
+	redisService  *services.RedisService
+	receiptSigner *services.ReceiptSigner
 }
 
-func NewVerifyHandler(redisService *services.RedisService) *VerifyHandler {
+func NewVerifyHandler(config *config.Config, redisService *services.RedisService, receiptSigner *services.ReceiptSigner) *VerifyHandler {
 	return &VerifyHandler{
-		redisService: redisService,
+		config:        config,
+		redisService:  redisService,
+		receiptSigner: receiptSigner,
 	}
 }
 
@@ -31,39 +38,177 @@ func (h *VerifyHandler) Verify(c *gin.Context) {
 		return
 	}
 
+	// Giới hạn số lần xác thực theo IP và email để chống dò mã
+	if !checkVerifyThrottle(c, h.config, h.redisService, req.Email, req.Locale) {
+		return
+	}
+
+	// Mã chỉ dùng được với cùng tenant, system và mục đích lúc generate
+	system := req.System
+	if system == "" {
+		system = h.config.Code.DefaultSystemName
+	}
+	scope := codeScope(c, h.config, system, req.Purpose)
+
 	// Lấy mã xác thực từ Redis
-	storedCode, err := h.redisService.GetVerificationCode(c.Request.Context(), req.Email)
+	storedCode, err := h.redisService.GetVerificationCode(c.Request.Context(), scope, req.Email)
 	if err != nil {
+		locale := resolveLocale(c, h.config, req.Locale, system)
 		log.Printf("Error getting verification code for %s: %v", req.Email, err)
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Error:   "Invalid or Expired Code",
-			Message: "Verification code not found or has expired",
+			Message: i18n.T(locale, "api.code.not_found"),
+		})
+		return
+	}
+
+	locale := resolveLocale(c, h.config, req.Locale, storedCode.System)
+
+	// Ghi nhận lượt nhập trước khi so sánh để request song song không vượt quá giới hạn
+	attempts, err := h.redisService.RecordVerificationAttempt(c.Request.Context(), scope, req.Email)
+	if err != nil {
+		log.Printf("Error recording verification attempt for %s: %v", req.Email, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: "Failed to verify code",
 		})
 		return
 	}
 
-	// So sánh mã xác thực
-	if storedCode.Code != req.Code {
-		log.Printf("Invalid verification code attempt for %s", req.Email)
+	maxAttempts := int64(h.config.Code.MaxAttempts)
+	if maxAttempts > 0 && attempts > maxAttempts {
+		h.respondAttemptsExceeded(c, scope, req.Email, locale)
+		return
+	}
+
+	// So sánh mã xác thực với hash đã lưu (thời gian không đổi), bỏ qua hoa thường, khoảng trắng và dấu "-"
+	if !h.redisService.MatchVerificationCode(scope, storedCode, utils.NormalizeCode(req.Code)) {
+		log.Printf("Invalid verification code attempt for %s (%d/%d)", req.Email, attempts, maxAttempts)
+		if maxAttempts <= 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Invalid Code",
+				Message: i18n.T(locale, "api.code.invalid"),
+			})
+			return
+		}
+
+		remaining := int(maxAttempts - attempts)
+		if remaining == 0 {
+			h.respondAttemptsExceeded(c, scope, req.Email, locale)
+			return
+		}
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "Invalid Code",
-			Message: "The verification code provided is incorrect",
+			Error:             "Invalid Code",
+			Message:           i18n.T(locale, "api.code.invalid_remaining", remaining),
+			RemainingAttempts: &remaining,
 		})
 		return
 	}
 
-	// Mã xác thực đúng, xóa khỏi Redis để tránh sử dụng lại
-	if err := h.redisService.DeleteVerificationCode(c.Request.Context(), req.Email); err != nil {
-		log.Printf("Error deleting verification code for %s: %v", req.Email, err)
-		// Không trả lỗi ở đây vì việc xác thực đã thành công
+	// Mã xác thực đúng, xóa khỏi Redis để tránh sử dụng lại. Chỉ request xóa được mã mới xác thực
+	// thành công, request song song dùng cùng mã nhận lỗi như mã không tồn tại.
+	consumed, err := h.redisService.ConsumeVerificationCode(c.Request.Context(), scope, req.Email, storedCode)
+	if err != nil {
+		log.Printf("Error consuming verification code for %s: %v", req.Email, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: "Failed to verify code",
+		})
+		return
+	}
+	if !consumed {
+		log.Printf("Verification code for %s was already used", req.Email)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid or Expired Code",
+			Message: i18n.T(locale, "api.code.not_found"),
+		})
+		return
 	}
 
 	// Log thành công
-	log.Printf("Verification successful for %s with system %s", req.Email, storedCode.System)
+	log.Printf("Verification successful for %s with system %s (purpose %s)", req.Email, storedCode.System, scope.Purpose)
 
-	// Trả về response thành công
-	c.JSON(http.StatusOK, models.SuccessResponse{
+	response := models.VerifyResponse{
 		Success: true,
-		Message: "Verification successful",
+		Message: i18n.T(locale, "api.code.verified"),
+	}
+	if h.receiptSigner.Enabled() {
+		receipt, expiresAt, err := h.receiptSigner.Sign(models.VerificationReceiptClaims{
+			Email:   req.Email,
+			System:  storedCode.System,
+			Action:  models.ReceiptActionCode,
+			Purpose: scope.Purpose,
+			Tenant:  scope.Tenant,
+		})
+		if err != nil {
+			// Mã đã bị xóa, vẫn trả về kết quả xác thực nhưng không có receipt
+			log.Printf("Error signing verification receipt for %s: %v", req.Email, err)
+		} else {
+			response.Receipt, response.ReceiptExpiresAt = receipt, expiresAt
+		}
+	}
+
+	// Trả về response thành công
+	c.JSON(http.StatusOK, response)
+}
+
+// checkVerifyThrottle tăng bộ đếm xác thực theo IP và email, trả về false và ghi response nếu vượt giới hạn.
+// /verify và xác thực TOTP dùng chung bộ đếm.
+func checkVerifyThrottle(c *gin.Context, cfg *config.Config, redisService *services.RedisService, email, requestedLocale string) bool {
+	clientIP := utils.GetClientIP(
+		c.Request.RemoteAddr,
+		c.GetHeader("X-Forwarded-For"),
+		c.GetHeader("X-Real-IP"),
+	)
+
+	limits := []struct {
+		kind  string
+		value string
+		limit int
+	}{
+		{"ip", clientIP, cfg.RateLimit.VerifyIPPerHour},
+		{"email", email, cfg.RateLimit.VerifyEmailPerHour},
+	}
+
+	for _, l := range limits {
+		if l.limit <= 0 {
+			continue
+		}
+
+		count, err := redisService.IncrementVerifyRateLimit(c.Request.Context(), l.kind, l.value)
+		if err != nil {
+			log.Printf("Error checking verify rate limit for %s %s: %v", l.kind, l.value, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal Server Error",
+				Message: "Failed to check verify rate limit",
+			})
+			return false
+		}
+		if count > int64(l.limit) {
+			log.Printf("Verify rate limit exceeded for %s %s (%d per hour)", l.kind, l.value, count)
+			locale := resolveLocale(c, cfg, requestedLocale, cfg.Code.DefaultSystemName)
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Error:   "Rate Limit Exceeded",
+				Message: i18n.T(locale, "api.code.throttled"),
+			})
+			return false
+		}
+	}
+
+	return true
+}
+
+// respondAttemptsExceeded hủy mã xác thực đã hết lượt nhập, người dùng phải yêu cầu mã mới
+func (h *VerifyHandler) respondAttemptsExceeded(c *gin.Context, scope models.CodeScope, email, locale string) {
+	if err := h.redisService.DeleteVerificationCode(c.Request.Context(), scope, email); err != nil {
+		log.Printf("Error invalidating verification code for %s: %v", email, err)
+	}
+	log.Printf("Verification code for %s invalidated after too many failed attempts", email)
+
+	remaining := 0
+	c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+		Error:             "Too Many Attempts",
+		Message:           i18n.T(locale, "api.code.attempts_exceeded"),
+		RemainingAttempts: &remaining,
 	})
 }
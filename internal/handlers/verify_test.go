@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+const testAPIKey = "test-key"
+
+// newVerifyTestRouter tạo router /verify với receipt đã bật, API key lấy từ header X-API-Key (mặc định testAPIKey)
+func newVerifyTestRouter(t *testing.T) (*gin.Engine, *services.RedisService, *config.Config) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	t.Setenv("RECEIPT_SIGNING_KEY_ID", "r1")
+	t.Setenv("RECEIPT_SIGNING_KEYS", "r1:"+base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	mr := miniredis.RunT(t)
+	cfg := newTestConfig(t, mr)
+	if err := RegisterValidators(cfg); err != nil {
+		t.Fatal(err)
+	}
+	redisService := services.NewRedisService(cfg)
+	receiptSigner, err := services.NewReceiptSigner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewVerifyHandler(cfg, redisService, receiptSigner)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		apiKey := c.GetHeader("X-API-Key")
+		if apiKey == "" {
+			apiKey = testAPIKey
+		}
+		c.Set("api_key", apiKey)
+	})
+	router.POST("/verify", handler.Verify)
+	return router, redisService, cfg
+}
+
+// storeTestCode lưu mã cho email với system và purpose mặc định của tenant testAPIKey
+func storeTestCode(t *testing.T, redisService *services.RedisService, cfg *config.Config, email, code string) models.CodeScope {
+	t.Helper()
+	scope := models.CodeScope{
+		Tenant:  cfg.Security.TenantFor(testAPIKey),
+		System:  cfg.Code.DefaultSystemName,
+		Purpose: models.DefaultCodePurpose,
+	}
+	if err := redisService.StoreVerificationCode(context.Background(), scope, email, code); err != nil {
+		t.Fatalf("StoreVerificationCode: %v", err)
+	}
+	return scope
+}
+
+func TestVerifyConcurrentRequestsConsumeCodeOnce(t *testing.T) {
+	router, redisService, cfg := newVerifyTestRouter(t)
+	storeTestCode(t, redisService, cfg, "user@example.com", "123456")
+	body, _ := json.Marshal(models.VerifyRequest{Email: "user@example.com", Code: "123456"})
+
+	const requests = 5
+	statuses := make([]int, requests)
+	receipts := make([]string, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/verify", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			var resp models.VerifyResponse
+			_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+			statuses[i], receipts[i] = rec.Code, resp.Receipt
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded, issued := 0, 0
+	for i, status := range statuses {
+		switch status {
+		case http.StatusOK:
+			succeeded++
+		case http.StatusBadRequest:
+		default:
+			t.Fatalf("request %d: status %d", i, status)
+		}
+		if receipts[i] != "" {
+			issued++
+		}
+	}
+	if succeeded != 1 || issued != 1 {
+		t.Fatalf("%d concurrent verifications succeeded with %d receipts, want 1 and 1", succeeded, issued)
+	}
+
+	status, _ := postJSON(t, router, "/verify", models.VerifyRequest{Email: "user@example.com", Code: "123456"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("verify after the code was consumed: status %d, want 400", status)
+	}
+}
+
+func TestVerifyWrongCodesExhaustAttempts(t *testing.T) {
+	router, redisService, cfg := newVerifyTestRouter(t)
+	scope := storeTestCode(t, redisService, cfg, "user@example.com", "123456")
+	wrong := models.VerifyRequest{Email: "user@example.com", Code: "000000"}
+
+	maxAttempts := cfg.Code.MaxAttempts
+	for i := 1; i < maxAttempts; i++ {
+		status, resp := postJSON(t, router, "/verify", wrong)
+		if status != http.StatusBadRequest {
+			t.Fatalf("wrong code %d: status %d, want 400", i, status)
+		}
+		if remaining, _ := resp["remaining_attempts"].(float64); int(remaining) != maxAttempts-i {
+			t.Fatalf("wrong code %d: remaining_attempts = %v, want %d", i, resp["remaining_attempts"], maxAttempts-i)
+		}
+	}
+
+	status, resp := postJSON(t, router, "/verify", wrong)
+	if status != http.StatusTooManyRequests || resp["remaining_attempts"] != float64(0) {
+		t.Fatalf("last wrong code: status %d, body %v, want 429 with remaining_attempts 0", status, resp)
+	}
+	if _, err := redisService.GetVerificationCode(context.Background(), scope, "user@example.com"); err == nil {
+		t.Fatal("verification code still stored after attempts were exhausted")
+	}
+
+	// Mã đúng cũng không dùng được sau khi mã bị hủy
+	status, _ = postJSON(t, router, "/verify", models.VerifyRequest{Email: "user@example.com", Code: "123456"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("correct code after invalidation: status %d, want 400", status)
+	}
+}
+
+func TestVerifyThrottlesIPAcrossEmails(t *testing.T) {
+	t.Setenv("RATE_LIMIT_VERIFY_IP_PER_HOUR", "3")
+	router, _, _ := newVerifyTestRouter(t)
+
+	// Mỗi request dùng một email khác nhau nên chỉ giới hạn theo IP chặn được
+	emails := []string{"a@example.com", "b@example.com", "c@example.com"}
+	for _, email := range emails {
+		status, _ := postJSON(t, router, "/verify", models.VerifyRequest{Email: email, Code: "123456"})
+		if status != http.StatusBadRequest {
+			t.Fatalf("%s: status %d, want 400", email, status)
+		}
+	}
+
+	status, resp := postJSON(t, router, "/verify", models.VerifyRequest{Email: "d@example.com", Code: "123456"})
+	if status != http.StatusTooManyRequests || resp["error"] != "Rate Limit Exceeded" {
+		t.Fatalf("fourth email from the same IP: status %d, body %v, want 429", status, resp)
+	}
+}
+
+func TestVerifyCodeIsBoundToScope(t *testing.T) {
+	router, redisService, cfg := newVerifyTestRouter(t)
+	storeTestCode(t, redisService, cfg, "user@example.com", "123456")
+
+	// Mỗi trường hợp chỉ khác scope lúc generate ở một chiều
+	tests := []struct {
+		name   string
+		apiKey string
+		req    models.VerifyRequest
+	}{
+		{"other tenant", "other-key", models.VerifyRequest{Email: "user@example.com", Code: "123456"}},
+		{"other system", testAPIKey, models.VerifyRequest{Email: "user@example.com", Code: "123456", System: "OtherSystem"}},
+		{"other purpose", testAPIKey, models.VerifyRequest{Email: "user@example.com", Code: "123456", Purpose: "login"}},
+	}
+	for _, tt := range tests {
+		status, body := serveWithKey(t, router, http.MethodPost, "/verify", tt.apiKey, tt.req)
+		if status != http.StatusBadRequest {
+			t.Fatalf("%s: status %d, body %s, want 400", tt.name, status, body)
+		}
+	}
+
+	// Mã vẫn còn nguyên lượt nhập trong đúng scope
+	status, body := serveWithKey(t, router, http.MethodPost, "/verify", testAPIKey, models.VerifyRequest{
+		Email:   "user@example.com",
+		Code:    "123456",
+		System:  cfg.Code.DefaultSystemName,
+		Purpose: models.DefaultCodePurpose,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("original scope: status %d, body %s, want 200", status, body)
+	}
+}
@@ -0,0 +1,254 @@
+package i18n
+
+// catalogs chứa message theo từng locale, key được nhóm theo tiền tố "email." (nội dung email),
+// "channel." (tin nhắn SMS/chat) và "api." (response)
+var catalogs = map[string]map[string]string{
+	LocaleVI: {
+		// Nội dung chung
+		"email.greeting":       "Xin chào,",
+		"email.greeting_name":  "Xin chào %s,",
+		"email.security.title": "⚠️ Lưu ý bảo mật:",
+		"email.support":        "Nếu bạn gặp khó khăn, vui lòng liên hệ với đội ngũ hỗ trợ.",
+		"email.footer.sent":    "Email này được gửi tự động từ hệ thống %s",
+		"email.footer.noreply": "Vui lòng không trả lời email này.",
+		"email.footer.support": "Hỗ trợ:",
+		"email.link.expiry":    "Liên kết này sẽ hết hạn sau %d phút.",
+		"email.link.fallback":  "Nếu bạn không thể click vào nút trên, vui lòng copy và paste URL bên dưới vào trình duyệt:",
+		"email.link.once":      "Liên kết này chỉ sử dụng một lần và sẽ hết hạn sau %d phút",
+		"email.link.share":     "Không chia sẻ liên kết này với bất kỳ ai",
+		"email.link.ignore":    "Nếu bạn không yêu cầu email này, vui lòng bỏ qua",
+		"email.code.subject":   "Mã xác thực cho %s",
+		"email.code.title":     "Mã xác thực",
+		"email.code.heading":   "Mã xác thực đăng nhập",
+		"email.code.intro":     "Bạn đã yêu cầu mã xác thực để đăng nhập vào hệ thống %s.",
+		"email.code.label":     "Mã xác thực của bạn là:",
+		"email.code.validity":  "Mã này có hiệu lực trong vòng %d phút",
+		"email.code.share":     "Không chia sẻ mã này với bất kỳ ai",
+		"email.code.once":      "Mã chỉ sử dụng một lần và sẽ hết hạn sau %d phút",
+		"email.code.ignore":    "Nếu bạn không yêu cầu mã này, vui lòng bỏ qua email",
+		"email.code.support":   "Nếu bạn gặp khó khăn trong việc đăng nhập, vui lòng liên hệ với đội ngũ hỗ trợ.",
+
+		// Email kích hoạt
+		"email.registration.subject":        "Kích hoạt tài khoản %s",
+		"email.registration.title":          "Kích hoạt tài khoản",
+		"email.registration.message":        "Cảm ơn bạn đã đăng ký tài khoản. Vui lòng click vào nút bên dưới để kích hoạt tài khoản của bạn:",
+		"email.registration.button":         "Kích Hoạt Tài Khoản",
+		"email.registration.plan":           "Gói dịch vụ của bạn: %s",
+		"email.password_reset.subject":      "Đặt lại mật khẩu %s",
+		"email.password_reset.title":        "Đặt lại mật khẩu",
+		"email.password_reset.message":      "Bạn đã yêu cầu đặt lại mật khẩu. Click vào nút bên dưới để tạo mật khẩu mới:",
+		"email.password_reset.button":       "Đặt Lại Mật Khẩu",
+		"email.password_reset.temp_intro":   "Mật khẩu tạm thời của bạn là:",
+		"email.password_reset.temp_message": "Click vào nút bên dưới để kích hoạt mật khẩu này. Sau khi đăng nhập, bạn cần vào trang cài đặt để đổi mật khẩu mới:",
+		"email.password_reset.temp_button":  "Kích Hoạt Mật Khẩu Tạm Thời",
+		"email.verification.subject":        "Xác thực email cho %s",
+		"email.verification.title":          "Xác thực email",
+		"email.verification.message":        "Vui lòng click vào nút bên dưới để xác thực địa chỉ email của bạn:",
+		"email.verification.button":         "Xác Thực Email",
+		"email.login.subject":               "Đăng nhập vào %s",
+		"email.login.title":                 "Đăng nhập",
+		"email.login.message":               "Click vào nút bên dưới để đăng nhập, bạn không cần nhập mật khẩu:",
+		"email.login.button":                "Đăng Nhập",
+		"email.email_change.subject":        "Xác nhận email mới cho %s",
+		"email.email_change.title":          "Xác nhận email mới",
+		"email.email_change.message":        "Bạn đã yêu cầu đổi email đăng nhập sang địa chỉ này. Vui lòng click vào nút bên dưới để xác nhận:",
+		"email.email_change.button":         "Xác Nhận Email Mới",
+		"email.email_change_notice.subject": "Yêu cầu đổi email tài khoản %s",
+		"email.email_change_notice.title":   "Yêu cầu đổi email",
+		"email.email_change_notice.message": "Chúng tôi nhận được yêu cầu đổi email đăng nhập của tài khoản sang địa chỉ:",
+		"email.email_change_notice.revoke":  "Nếu bạn không thực hiện yêu cầu này, hãy hủy yêu cầu bằng nút bên dưới và đổi mật khẩu ngay. Nếu đúng là bạn, bạn không cần làm gì thêm.",
+		"email.email_change_notice.button":  "Hủy Yêu Cầu Đổi Email",
+		"email.email_change_notice.expiry":  "Bạn có thể hủy yêu cầu trong %d phút, trước khi địa chỉ mới được xác nhận.",
+		"email.invitation.subject":          "Lời mời tham gia %s",
+		"email.invitation.title":            "Lời mời tham gia",
+		"email.invitation.invited_by":       "%s đã mời bạn tham gia %s với vai trò %s.",
+		"email.invitation.message":          "Click vào nút bên dưới để chấp nhận lời mời:",
+		"email.invitation.button":           "Chấp Nhận Lời Mời",
+
+		// Response API
+		"api.code.sent":                      "Mã xác thực đã được gửi thành công",
+		"api.code.generate_failed":           "Không thể tạo mã xác thực",
+		"api.code.store_failed":              "Không thể lưu mã xác thực",
+		"api.code.send_failed":               "Không thể gửi email xác thực",
+		"api.code.not_found":                 "Mã xác thực không tồn tại hoặc đã hết hạn",
+		"api.code.invalid":                   "Mã xác thực không chính xác",
+		"api.code.invalid_remaining":         "Mã xác thực không chính xác, bạn còn %d lần thử",
+		"api.code.attempts_exceeded":         "Bạn đã nhập sai quá số lần cho phép, vui lòng yêu cầu mã mới",
+		"api.code.throttled":                 "Quá nhiều yêu cầu xác thực, vui lòng thử lại sau",
+		"api.code.verified":                  "Xác thực thành công",
+		"api.custom_data.invalid":            "customData thiếu hoặc sai kiểu: %s",
+		"api.subject.forbidden":              "API key không được phép ghi đè tiêu đề email",
+		"api.subject.invalid":                "Tiêu đề email không hợp lệ: %s",
+		"api.activation.sent":                "Đã gửi email kích hoạt thành công",
+		"api.activation.resent":              "Đã gửi lại email kích hoạt thành công",
+		"api.activation.verified":            "Kích hoạt thành công",
+		"api.activation.valid":               "Activation token hợp lệ",
+		"api.activation.session_failed":      "Không thể tạo phiên xác thực",
+		"api.activation.session_invalid":     "Phiên xác thực không hợp lệ hoặc đã hết hạn, vui lòng mở lại liên kết",
+		"api.activation.max_sends":           "Đã đạt giới hạn tối đa %d lần gửi email. Vui lòng thử lại sau.",
+		"api.activation.wait":                "Vui lòng chờ %d giây trước khi gửi lại email.",
+		"api.activation.generate_failed":     "Không thể tạo activation token",
+		"api.activation.store_failed":        "Không thể lưu activation token",
+		"api.activation.update_failed":       "Không thể cập nhật activation token",
+		"api.activation.send_failed":         "Không thể gửi email kích hoạt",
+		"api.activation.resend_failed":       "Không thể gửi lại email kích hoạt",
+		"api.activation.not_found":           "Activation token không tồn tại hoặc đã hết hạn",
+		"api.activation.expired":             "Activation token đã hết hạn",
+		"api.activation.used":                "Activation token đã được sử dụng",
+		"api.activation.browser_mismatch":    "Liên kết phải được mở trên trình duyệt đã yêu cầu đăng nhập",
+		"api.activation.assertion_failed":    "Không thể tạo login assertion",
+		"api.activation.no_active":           "Không tìm thấy activation token cho email và action này",
+		"api.activation.revoked":             "Yêu cầu đã bị hủy",
+		"api.activation.revoke_done":         "Đã hủy yêu cầu đổi email",
+		"api.activation.revoke_failed":       "Không thể hủy yêu cầu",
+		"api.activation.new_email":           "newEmail là bắt buộc và phải khác email hiện tại",
+		"api.activation.new_email_unused":    "newEmail chỉ dùng cho action đổi email",
+		"api.activation.notice_failed":       "Không thể gửi email thông báo tới địa chỉ hiện tại",
+		"api.activation.invitation_required": "invitation là bắt buộc với action lời mời",
+		"api.activation.invitation_unused":   "invitation chỉ dùng cho action lời mời",
+		"api.totp.disabled":                  "Xác thực bằng ứng dụng authenticator chưa được cấu hình",
+		"api.totp.enrolled":                  "Quét mã QR bằng ứng dụng authenticator rồi nhập mã để hoàn tất đăng ký",
+		"api.totp.enroll_failed":             "Không thể đăng ký ứng dụng authenticator",
+		"api.totp.confirmed":                 "Đã bật xác thực bằng ứng dụng authenticator, hãy lưu lại các recovery code",
+		"api.totp.no_pending":                "Không có đăng ký đang chờ hoặc đăng ký đã hết hạn, vui lòng đăng ký lại",
+		"api.totp.not_enrolled":              "Email chưa đăng ký ứng dụng authenticator",
+		"api.totp.code_required":             "Vui lòng nhập code hoặc recoveryCode",
+		"api.totp.reauth_required":           "Email đã đăng ký ứng dụng authenticator, vui lòng nhập mã hiện tại hoặc recovery code",
+		"api.totp.invalid":                   "Mã xác thực không chính xác",
+		"api.totp.reused":                    "Mã này đã được sử dụng, vui lòng chờ mã tiếp theo",
+		"api.totp.recovery_invalid":          "Recovery code không chính xác hoặc đã được sử dụng",
+		"api.totp.recovery_generated":        "Đã tạo recovery code mới, các recovery code cũ không còn hiệu lực",
+		"api.totp.verified":                  "Xác thực thành công",
+		"api.totp.disabled_done":             "Đã tắt xác thực bằng ứng dụng authenticator",
+		"api.totp.failed":                    "Không thể xử lý yêu cầu xác thực authenticator",
+		"api.channel.recipient_required":     "%s là bắt buộc khi gửi mã qua kênh %s",
+		"api.channel.rate_limited":           "Đã đạt giới hạn %d tin nhắn mỗi giờ cho người nhận này, vui lòng thử lại sau",
+		"api.channel.send_failed":            "Không thể gửi mã xác thực qua kênh đã chọn",
+		"api.channel.email_only_fields":      "%s chỉ dùng được khi gửi mã qua email, không dùng được với kênh %s",
+		"channel.code.message":               "%s là mã xác thực %s của bạn, hiệu lực trong %d phút. Không chia sẻ mã này với bất kỳ ai.",
+	},
+	LocaleEN: {
+		// Common content
+		"email.greeting":       "Hello,",
+		"email.greeting_name":  "Hello %s,",
+		"email.security.title": "⚠️ Security notice:",
+		"email.support":        "If you need help, please contact our support team.",
+		"email.footer.sent":    "This email was sent automatically by %s",
+		"email.footer.noreply": "Please do not reply to this email.",
+		"email.footer.support": "Support:",
+		"email.link.expiry":    "This link expires in %d minutes.",
+		"email.link.fallback":  "If the button does not work, copy and paste the URL below into your browser:",
+		"email.link.once":      "This link can only be used once and expires in %d minutes",
+		"email.link.share":     "Do not share this link with anyone",
+		"email.link.ignore":    "If you did not request this email, please ignore it",
+		"email.code.subject":   "Verification code for %s",
+		"email.code.title":     "Verification code",
+		"email.code.heading":   "Sign-in verification code",
+		"email.code.intro":     "You requested a verification code to sign in to %s.",
+		"email.code.label":     "Your verification code is:",
+		"email.code.validity":  "This code is valid for %d minutes",
+		"email.code.share":     "Do not share this code with anyone",
+		"email.code.once":      "The code can only be used once and expires in %d minutes",
+		"email.code.ignore":    "If you did not request this code, please ignore this email",
+		"email.code.support":   "If you have trouble signing in, please contact our support team.",
+
+		// Activation emails
+		"email.registration.subject":        "Activate your %s account",
+		"email.registration.title":          "Activate your account",
+		"email.registration.message":        "Thank you for signing up. Please click the button below to activate your account:",
+		"email.registration.button":         "Activate Account",
+		"email.registration.plan":           "Your plan: %s",
+		"email.password_reset.subject":      "Reset your %s password",
+		"email.password_reset.title":        "Reset your password",
+		"email.password_reset.message":      "You requested a password reset. Click the button below to create a new password:",
+		"email.password_reset.button":       "Reset Password",
+		"email.password_reset.temp_intro":   "Your temporary password is:",
+		"email.password_reset.temp_message": "Click the button below to activate this password. After signing in, go to the settings page to choose a new password:",
+		"email.password_reset.temp_button":  "Activate Temporary Password",
+		"email.verification.subject":        "Verify your email for %s",
+		"email.verification.title":          "Verify your email",
+		"email.verification.message":        "Please click the button below to verify your email address:",
+		"email.verification.button":         "Verify Email",
+		"email.login.subject":               "Sign in to %s",
+		"email.login.title":                 "Sign in",
+		"email.login.message":               "Click the button below to sign in, no password needed:",
+		"email.login.button":                "Sign In",
+		"email.email_change.subject":        "Confirm your new email for %s",
+		"email.email_change.title":          "Confirm your new email",
+		"email.email_change.message":        "You asked to change your sign-in email to this address. Click the button below to confirm:",
+		"email.email_change.button":         "Confirm New Email",
+		"email.email_change_notice.subject": "Email change requested for your %s account",
+		"email.email_change_notice.title":   "Email change requested",
+		"email.email_change_notice.message": "We received a request to change the sign-in email of your account to:",
+		"email.email_change_notice.revoke":  "If you did not make this request, cancel it with the button below and change your password right away. If it was you, no action is needed.",
+		"email.email_change_notice.button":  "Cancel Email Change",
+		"email.email_change_notice.expiry":  "You can cancel the request for %d minutes, until the new address is confirmed.",
+		"email.invitation.subject":          "You're invited to join %s",
+		"email.invitation.title":            "Invitation",
+		"email.invitation.invited_by":       "%s invited you to join %s as %s.",
+		"email.invitation.message":          "Click the button below to accept the invitation:",
+		"email.invitation.button":           "Accept Invitation",
+
+		// API responses
+		"api.code.sent":                      "Verification code sent successfully",
+		"api.code.generate_failed":           "Failed to generate verification code",
+		"api.code.store_failed":              "Failed to store verification code",
+		"api.code.send_failed":               "Failed to send verification email",
+		"api.code.not_found":                 "Verification code not found or has expired",
+		"api.code.invalid":                   "The verification code provided is incorrect",
+		"api.code.invalid_remaining":         "The verification code provided is incorrect, %d attempts left",
+		"api.code.attempts_exceeded":         "Too many incorrect attempts, please request a new code",
+		"api.code.throttled":                 "Too many verification attempts, please try again later",
+		"api.code.verified":                  "Verification successful",
+		"api.custom_data.invalid":            "Missing or invalid customData fields: %s",
+		"api.subject.forbidden":              "API key is not allowed to override the email subject",
+		"api.subject.invalid":                "Invalid email subject: %s",
+		"api.activation.sent":                "Activation email sent successfully",
+		"api.activation.resent":              "Activation email resent successfully",
+		"api.activation.verified":            "Activation successful",
+		"api.activation.valid":               "Activation token is valid",
+		"api.activation.session_failed":      "Failed to create activation session",
+		"api.activation.session_invalid":     "Activation session is invalid or has expired, please open the link again",
+		"api.activation.max_sends":           "Maximum of %d emails reached. Please try again later.",
+		"api.activation.wait":                "Please wait %d seconds before requesting another email.",
+		"api.activation.generate_failed":     "Failed to generate activation token",
+		"api.activation.store_failed":        "Failed to store activation token",
+		"api.activation.update_failed":       "Failed to update activation token",
+		"api.activation.send_failed":         "Failed to send activation email",
+		"api.activation.resend_failed":       "Failed to resend activation email",
+		"api.activation.not_found":           "Activation token not found or has expired",
+		"api.activation.expired":             "Activation token has expired",
+		"api.activation.used":                "Activation token has already been used",
+		"api.activation.browser_mismatch":    "This link must be opened in the browser that requested it",
+		"api.activation.assertion_failed":    "Failed to issue login assertion",
+		"api.activation.no_active":           "No activation token found for this email and action",
+		"api.activation.revoked":             "This request has been cancelled",
+		"api.activation.revoke_done":         "Email change request cancelled",
+		"api.activation.revoke_failed":       "Failed to cancel the request",
+		"api.activation.new_email":           "newEmail is required and must differ from the current email",
+		"api.activation.new_email_unused":    "newEmail is only supported by email change actions",
+		"api.activation.notice_failed":       "Failed to send the notice to the current email address",
+		"api.activation.invitation_required": "invitation is required by invitation actions",
+		"api.activation.invitation_unused":   "invitation is only supported by invitation actions",
+		"api.totp.disabled":                  "Authenticator app verification is not configured",
+		"api.totp.enrolled":                  "Scan the QR code with your authenticator app and enter a code to finish enrollment",
+		"api.totp.enroll_failed":             "Failed to enroll the authenticator app",
+		"api.totp.confirmed":                 "Authenticator app enabled, please store your recovery codes",
+		"api.totp.no_pending":                "No pending enrollment or the enrollment has expired, please enroll again",
+		"api.totp.not_enrolled":              "No authenticator app is enrolled for this email",
+		"api.totp.code_required":             "Please provide either code or recoveryCode",
+		"api.totp.reauth_required":           "An authenticator app is already enrolled for this email, please provide a current code or recovery code",
+		"api.totp.invalid":                   "The verification code provided is incorrect",
+		"api.totp.reused":                    "This code has already been used, please wait for the next one",
+		"api.totp.recovery_invalid":          "The recovery code is incorrect or has already been used",
+		"api.totp.recovery_generated":        "New recovery codes generated, previous recovery codes are no longer valid",
+		"api.totp.verified":                  "Verification successful",
+		"api.totp.disabled_done":             "Authenticator app disabled",
+		"api.totp.failed":                    "Failed to process the authenticator request",
+		"api.channel.recipient_required":     "%s is required to send the code via channel %s",
+		"api.channel.rate_limited":           "Limit of %d messages per hour reached for this recipient, please try again later",
+		"api.channel.send_failed":            "Failed to send the verification code via the selected channel",
+		"api.channel.email_only_fields":      "%s can only be used when sending the code by email, not via channel %s",
+		"channel.code.message":               "%s is your %s verification code. It expires in %d minutes. Do not share it with anyone.",
+	},
+}
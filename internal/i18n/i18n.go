@@ -0,0 +1,138 @@
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	LocaleVI = "vi"
+	LocaleEN = "en"
+
+	// DefaultLocale được dùng khi không xác định được locale nào khác
+	DefaultLocale = LocaleVI
+)
+
+// Localizer tra cứu message theo một locale cố định, dùng được trực tiếp trong template ({{.T "key"}})
+type Localizer struct {
+	Locale string
+}
+
+// NewLocalizer tạo Localizer cho locale, locale không hỗ trợ sẽ dùng DefaultLocale
+func NewLocalizer(locale string) Localizer {
+	if normalized := Normalize(locale); normalized != "" {
+		return Localizer{Locale: normalized}
+	}
+	return Localizer{Locale: DefaultLocale}
+}
+
+// T trả về message đã dịch và format với args
+func (l Localizer) T(key string, args ...interface{}) string {
+	return T(l.Locale, key, args...)
+}
+
+// T trả về message đã dịch theo locale, fallback về DefaultLocale rồi tới chính key
+func T(locale, key string, args ...interface{}) string {
+	message, ok := catalogs[locale][key]
+	if !ok {
+		message, ok = catalogs[DefaultLocale][key]
+	}
+	if !ok {
+		return key
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// Supported kiểm tra locale có catalog hay không
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Has kiểm tra key có trong catalog của DefaultLocale hay không
+func Has(key string) bool {
+	_, ok := catalogs[DefaultLocale][key]
+	return ok
+}
+
+// Locales trả về danh sách locale được hỗ trợ, sắp xếp theo tên
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Normalize chuẩn hóa locale (vd: "en-US" -> "en"), trả về rỗng nếu không được hỗ trợ
+func Normalize(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if locale == "" {
+		return ""
+	}
+
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		locale = locale[:i]
+	}
+
+	if !Supported(locale) {
+		return ""
+	}
+	return locale
+}
+
+// FromAcceptLanguage chọn locale được hỗ trợ có độ ưu tiên cao nhất trong header Accept-Language
+func FromAcceptLanguage(header string) string {
+	type candidate struct {
+		locale string
+		q      float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = value
+				}
+			}
+		}
+
+		if locale := Normalize(fields[0]); locale != "" && q > 0 {
+			candidates = append(candidates, candidate{locale: locale, q: q})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].locale
+}
+
+// Resolve chọn locale theo thứ tự: locale trong request > Accept-Language > mặc định của system > DefaultLocale
+func Resolve(requested, acceptLanguage, systemDefault string) string {
+	if locale := Normalize(requested); locale != "" {
+		return locale
+	}
+	if locale := FromAcceptLanguage(acceptLanguage); locale != "" {
+		return locale
+	}
+	if locale := Normalize(systemDefault); locale != "" {
+		return locale
+	}
+	return DefaultLocale
+}
@@ -44,4 +44,20 @@ func APIKeyAuth(config *config.Config) gin.HandlerFunc {
 		c.Set("api_key", apiKey)
 		c.Next()
 	}
-} 
\ No newline at end of file
+}
+
+// RequirePermission middleware kiểm tra API key (đã được APIKeyAuth xác thực) có quyền tương ứng
+func RequirePermission(config *config.Config, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.Security.HasPermission(c.GetString("api_key"), permission) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "Forbidden",
+				Message: "API key does not have permission: " + permission,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -4,13 +4,33 @@ package models
 type GenerateRequest struct {
 	Email      string                 `json:"email" binding:"required,email"`
 	System     string                 `json:"system,omitempty"`
+	Locale     string                 `json:"locale,omitempty"`                                       // "vi", "en" (optional, fallback to Accept-Language)
+	Subject    string                 `json:"subject,omitempty" binding:"max=200"`                    // Subject template override, requires "subject" permission
+	Purpose    string                 `json:"purpose,omitempty" binding:"omitempty,code_purpose"`     // e.g. "login", "signup"; codes of different purposes coexist (default "default")
+	Channel    string                 `json:"channel,omitempty" binding:"omitempty,delivery_channel"` // "email" (default) or a channel declared in CHANNELS_FILE
+	Phone      string                 `json:"phone,omitempty" binding:"omitempty,e164"`               // Recipient of SMS/Zalo channels in E.164 format, e.g. +84901234567
+	ChatID     string                 `json:"chatId,omitempty" binding:"max=64"`                      // Recipient of Telegram channels
 	CustomData map[string]interface{} `json:"customData,omitempty"`
 }
 
 // VerifyRequest represents request payload for /verify endpoint
 type VerifyRequest struct {
-	Email string `json:"email" binding:"required,email"`
-	Code  string `json:"code" binding:"required"`
+	Email   string `json:"email" binding:"required,email"`
+	Code    string `json:"code" binding:"required,max=64"`
+	System  string `json:"system,omitempty"`                                   // Must match the system the code was generated for
+	Purpose string `json:"purpose,omitempty" binding:"omitempty,code_purpose"` // Must match the purpose the code was generated for
+	Locale  string `json:"locale,omitempty"`
+}
+
+// DefaultCodePurpose is the purpose of verification codes generated without one
+const DefaultCodePurpose = "default"
+
+// CodeScope namespaces a verification code: codes are only redeemable by the same tenant (API key),
+// system and purpose they were generated for
+type CodeScope struct {
+	Tenant  string
+	System  string
+	Purpose string
 }
 
 // SuccessResponse represents successful API response
@@ -21,56 +41,130 @@ type SuccessResponse struct {
 
 // ErrorResponse represents error API response
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
+	Error             string   `json:"error"`
+	Message           string   `json:"message,omitempty"`
+	Fields            []string `json:"fields,omitempty"`             // Invalid or missing fields, if any
+	RemainingAttempts *int     `json:"remaining_attempts,omitempty"` // Attempts left before the verification code is invalidated
 }
 
 // HealthCheckResponse represents health check response
 type HealthCheckResponse struct {
-	Status string            `json:"status"`
-	Checks map[string]string `json:"checks"`
+	Status    string            `json:"status"`
+	Checks    map[string]string `json:"checks"`
+	Templates *TemplateRevision `json:"templates,omitempty"`
+}
+
+// TemplateRevision mô tả bộ template đang dùng từ thư mục template
+type TemplateRevision struct {
+	Revision  string `json:"revision"`
+	Files     int    `json:"files"`
+	LoadedAt  int64  `json:"loaded_at"`
+	LastError string `json:"last_error,omitempty"` // Lỗi của lần reload gần nhất bị từ chối
 }
 
 // VerificationCode represents stored verification code in Redis
 type VerificationCode struct {
-	Code      string `json:"code"`
+	CodeHash  string `json:"code_hash"` // HMAC of scope, email and code, the code itself is never stored
 	Email     string `json:"email"`
 	System    string `json:"system"`
+	Purpose   string `json:"purpose"`
 	CreatedAt int64  `json:"created_at"`
 }
 
 // ActivationToken represents stored activation token in Redis
 type ActivationToken struct {
-	Token      string `json:"token"`        // UUID token
-	Email      string `json:"email"`        // Email address
-	Action     string `json:"action"`       // "registration", "password_reset"
-	System     string `json:"system"`       // System name
-	CreatedAt  int64  `json:"created_at"`   // Unix timestamp
-	ExpiresAt  int64  `json:"expires_at"`   // Unix timestamp (30 minutes from creation)
-	SendCount  int    `json:"send_count"`   // Number of times email was sent (max 3)
-	LastSentAt int64  `json:"last_sent_at"` // Last time email was sent
+	Token      string      `json:"-"`                     // UUID token, only known when issued or looked up (never stored)
+	TokenHash  string      `json:"token_hash"`            // HMAC of Token, used as the Redis key
+	TokenID    string      `json:"token_id,omitempty"`    // "jti" of a signed token, key of its denylist entry
+	Email      string      `json:"email"`                 // Email address
+	Action     string      `json:"action"`                // Action name, e.g. "registration", "password_reset"
+	System     string      `json:"system"`                // System name
+	Locale     string      `json:"locale"`                // Locale used for emails
+	Variant    string      `json:"variant,omitempty"`     // A/B template variant used for this token
+	NonceHash  string      `json:"nonce_hash,omitempty"`  // SHA-256 of the browser-binding nonce, empty = not bound
+	NewEmail   string      `json:"new_email,omitempty"`   // Address being confirmed by an email change action (Email is the current address)
+	RevokeKey  string      `json:"-"`                     // Token of the revoke link sent to the current address of an email change (never stored)
+	RevokeHash string      `json:"revoke_hash,omitempty"` // HMAC of RevokeKey
+	Invitation *Invitation `json:"invitation,omitempty"`  // Inviter, organization and role of an invitation action
+	Tenant     string      `json:"tenant,omitempty"`      // Tenant of the API key that sent an invitation, scopes its organization
+	CreatedAt  int64       `json:"created_at"`            // Unix timestamp
+	ExpiresAt  int64       `json:"expires_at"`            // Unix timestamp (creation + action TTL)
+	SendCount  int         `json:"send_count"`            // Number of times email was sent (max = action max_sends)
+	LastSentAt int64       `json:"last_sent_at"`          // Last time email was sent
 }
 
 // GenerateActivationRequest represents request payload for /generate-activation endpoint
 type GenerateActivationRequest struct {
-	Email      string                 `json:"email" binding:"required,email"`
-	Action     string                 `json:"action" binding:"required"` // "registration", "password_reset"
-	System     string                 `json:"system,omitempty"`
-	BaseURL    string                 `json:"baseUrl" binding:"required"` // Frontend base URL
-	CustomData map[string]interface{} `json:"customData,omitempty"`
+	Email       string                 `json:"email" binding:"required,email"`
+	Action      string                 `json:"action" binding:"required,activation_action"` // Action declared in the action registry (ACTIONS_FILE)
+	System      string                 `json:"system,omitempty"`
+	BaseURL     string                 `json:"baseUrl" binding:"required"` // Frontend base URL
+	Locale      string                 `json:"locale,omitempty"`
+	Subject     string                 `json:"subject,omitempty" binding:"max=200"` // Subject template override, requires "subject" permission
+	CustomData  map[string]interface{} `json:"customData,omitempty"`
+	BindBrowser bool                   `json:"bindBrowser,omitempty"`                        // Return a nonce that must be presented on verify (same-browser binding)
+	NewEmail    string                 `json:"newEmail,omitempty" binding:"omitempty,email"` // New address, required by email change actions
+	Invitation  *Invitation            `json:"invitation,omitempty"`                         // Invitation metadata, required by invitation actions
+}
+
+// Invitation describes who invited the recipient into which organization, stored with the invitation token
+type Invitation struct {
+	InviterName      string `json:"inviterName" binding:"required,max=100"`
+	InviterEmail     string `json:"inviterEmail,omitempty" binding:"omitempty,email"`
+	OrganizationID   string `json:"organizationId" binding:"required,max=100"`
+	OrganizationName string `json:"organizationName" binding:"required,max=100"`
+	Role             string `json:"role" binding:"required,max=50"`
+}
+
+// PendingInvitation represents a pending invitation returned by GET /invitations
+type PendingInvitation struct {
+	Email      string      `json:"email"`
+	Action     string      `json:"action"`
+	System     string      `json:"system"`
+	Invitation *Invitation `json:"invitation"`
+	CreatedAt  int64       `json:"created_at"`
+	ExpiresAt  int64       `json:"expires_at"`
+	SendCount  int         `json:"send_count"`
+	LastSentAt int64       `json:"last_sent_at"`
+}
+
+// RevokeInvitationRequest represents request payload for /invitations/revoke endpoint
+type RevokeInvitationRequest struct {
+	OrganizationID string `json:"organizationId" binding:"required"`
+	Email          string `json:"email" binding:"required,email"`
+	Action         string `json:"action,omitempty"` // Invitation action, defaults to "invitation"
 }
 
 // VerifyActivationRequest represents request payload for /verify-activation endpoint
 type VerifyActivationRequest struct {
-	Token string `json:"token" binding:"required"`
+	Token   string `json:"token" binding:"required"`
+	Locale  string `json:"locale,omitempty"`
+	Nonce   string `json:"nonce,omitempty"`   // Required when the token was generated with bindBrowser
+	Session string `json:"session,omitempty"` // Required when /activation/validate issued a session handle for the token
+}
+
+// ValidateActivationRequest represents request payload for /activation/validate endpoint
+type ValidateActivationRequest struct {
+	Token        string `json:"token" binding:"required"`
+	Locale       string `json:"locale,omitempty"`
+	Nonce        string `json:"nonce,omitempty"`        // Required when the token was generated with bindBrowser
+	IssueSession bool   `json:"issueSession,omitempty"` // Issue a short-lived session handle that /activation/consume must present
+}
+
+// RevokeActivationRequest represents request payload for /revoke-activation endpoint
+type RevokeActivationRequest struct {
+	Token  string `json:"token" binding:"required"` // Token of the revoke link
+	Locale string `json:"locale,omitempty"`
 }
 
 // ResendActivationRequest represents request payload for /resend-activation endpoint
 type ResendActivationRequest struct {
-	Email   string `json:"email" binding:"required,email"`
-	Action  string `json:"action" binding:"required"` // "registration", "password_reset"
-	BaseURL string `json:"baseUrl,omitempty"`         // Frontend base URL (optional, defaults to config)
-	System  string `json:"system,omitempty"`          // System name (optional)
+	Email          string `json:"email" binding:"required,email"`
+	Action         string `json:"action" binding:"required,activation_action"` // Action declared in the action registry (ACTIONS_FILE)
+	BaseURL        string `json:"baseUrl,omitempty"`                           // Frontend base URL (optional, defaults to config)
+	System         string `json:"system,omitempty"`                            // System name (optional)
+	Locale         string `json:"locale,omitempty"`                            // Locale (optional, defaults to the one used at generate time)
+	OrganizationID string `json:"organizationId,omitempty"`                    // Organization of the invitation (invitation actions only)
 }
 
 // ActivationResponse represents successful activation generation response
@@ -81,5 +175,260 @@ type ActivationResponse struct {
 	CanResend    bool   `json:"can_resend"`               // Whether user can resend email
 	NextResendAt int64  `json:"next_resend_at,omitempty"` // Unix timestamp when next resend is allowed
 	SendCount    int    `json:"send_count"`               // Current send count
-	MaxSends     int    `json:"max_sends"`                // Maximum allowed sends (3)
+	MaxSends     int    `json:"max_sends"`                // Maximum allowed sends for the action
+	MessageID    string `json:"message_id,omitempty"`     // Tracking message ID (only when tracking is enabled)
+	Nonce        string `json:"nonce,omitempty"`          // Browser-binding nonce (only when bindBrowser is set)
+}
+
+// LoginAssertionClaims are the JWT claims of the login assertion returned when a magic link is verified
+type LoginAssertionClaims struct {
+	Issuer       string   `json:"iss"`
+	Subject      string   `json:"sub"` // Verified email address
+	Audience     string   `json:"aud"` // System name
+	IssuedAt     int64    `json:"iat"`
+	ExpiresAt    int64    `json:"exp"`
+	ID           string   `json:"jti"` // Unique assertion ID, lets the auth service reject replays
+	Action       string   `json:"act"` // Action of the verified token, e.g. "login"
+	AuthMethods  []string `json:"amr"`
+	BrowserBound bool     `json:"browser_bound"` // Whether the link was bound to the requesting browser
+}
+
+// ActivationTokenClaims are the claims of a signed (stateless) activation token
+type ActivationTokenClaims struct {
+	Issuer     string      `json:"iss"`
+	Subject    string      `json:"sub"` // Email address
+	IssuedAt   int64       `json:"iat"`
+	ExpiresAt  int64       `json:"exp"`
+	ID         string      `json:"jti"` // Unique token ID, key of the consumed/revoked denylist
+	Action     string      `json:"act"`
+	System     string      `json:"sys"`
+	Locale     string      `json:"loc,omitempty"`
+	Variant    string      `json:"var,omitempty"`
+	NonceHash  string      `json:"nh,omitempty"` // SHA-256 of the browser-binding nonce
+	NewEmail   string      `json:"new_email,omitempty"`
+	Invitation *Invitation `json:"inv,omitempty"`
+	Tenant     string      `json:"tnt,omitempty"` // Tenant of the API key that sent an invitation
+}
+
+// ReceiptActionCode is the action of receipts issued by /verify (verification codes)
+const ReceiptActionCode = "code"
+
+// VerificationReceiptClaims are the JWT claims of the signed receipt returned when /verify or /verify-activation succeeds.
+// Downstream services validate it offline with the keys published at /.well-known/jwks.json.
+type VerificationReceiptClaims struct {
+	Issuer     string `json:"iss"`
+	Subject    string `json:"sub"` // Verified email address
+	Audience   string `json:"aud,omitempty"`
+	IssuedAt   int64  `json:"iat"`
+	ExpiresAt  int64  `json:"exp"`
+	ID         string `json:"jti"` // Unique receipt ID, lets downstream services reject replays
+	Email      string `json:"email"`
+	NewEmail   string `json:"new_email,omitempty"` // Address confirmed by an email change action
+	System     string `json:"system"`
+	Action     string `json:"action"`            // Activation action, or ReceiptActionCode for verification codes
+	Purpose    string `json:"purpose,omitempty"` // Purpose of the verification code (/verify only)
+	Tenant     string `json:"tenant"`            // Tenant of the API key that performed the verification
+	VerifiedAt int64  `json:"verified_at"`
+}
+
+// VerifyResponse represents successful /verify response
+type VerifyResponse struct {
+	Success          bool   `json:"success"`
+	Message          string `json:"message,omitempty"`
+	Receipt          string `json:"receipt,omitempty"`            // Signed verification receipt (only when receipt keys are configured)
+	ReceiptExpiresAt int64  `json:"receipt_expires_at,omitempty"` // Unix timestamp
+}
+
+// JWK is a public key of the JSON Web Key Set published at /.well-known/jwks.json
+type JWK struct {
+	Kty string `json:"kty"` // "OKP"
+	Crv string `json:"crv"` // "Ed25519"
+	X   string `json:"x"`   // Public key, base64url
+	Kid string `json:"kid"`
+	Alg string `json:"alg"` // "EdDSA"
+	Use string `json:"use"` // "sig"
+}
+
+// JWKS is the JSON Web Key Set of receipt signing keys
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// TOTPEnrollment represents an authenticator enrollment stored in Redis (pending until confirmed)
+type TOTPEnrollment struct {
+	Email       string `json:"email"`
+	System      string `json:"system"`
+	KeyID       string `json:"key_id"` // kid of the key that encrypted Secret
+	Secret      string `json:"secret"` // AES-GCM encrypted TOTP secret (base64), never stored in plain text
+	CreatedAt   int64  `json:"created_at"`
+	ConfirmedAt int64  `json:"confirmed_at,omitempty"`
+	Replaces    bool   `json:"replaces,omitempty"` // Pending enrollment started with a current code or recovery code, may replace the confirmed one
+}
+
+// TOTPEnrollRequest represents request payload for /totp/enroll endpoint
+type TOTPEnrollRequest struct {
+	Email        string `json:"email" binding:"required,email"`
+	System       string `json:"system,omitempty"`
+	AccountName  string `json:"accountName,omitempty" binding:"max=100"` // Label shown in the authenticator app, defaults to email
+	Code         string `json:"code,omitempty" binding:"max=16"`         // Current code, required when an enrollment is already confirmed
+	RecoveryCode string `json:"recoveryCode,omitempty" binding:"max=64"` // Replaces code when the device is lost
+	Locale       string `json:"locale,omitempty"`
+}
+
+// TOTPEnrollResponse represents successful TOTP enrollment response
+type TOTPEnrollResponse struct {
+	Success    bool   `json:"success"`
+	Message    string `json:"message,omitempty"`
+	Secret     string `json:"secret"`      // Base32 secret for manual entry in the authenticator app
+	OTPAuthURI string `json:"otpauth_uri"` // otpauth://totp/... URI encoded in the QR code
+	QRCode     string `json:"qr_code"`     // PNG of the otpauth URI as a data URI (data:image/png;base64,...)
+	ExpiresAt  int64  `json:"expires_at"`  // Enrollment must be confirmed with /totp/confirm before this time
+}
+
+// TOTPCodeRequest represents request payload for /totp/confirm and /totp/verify endpoints
+type TOTPCodeRequest struct {
+	Email        string `json:"email" binding:"required,email"`
+	System       string `json:"system,omitempty"`
+	Code         string `json:"code,omitempty" binding:"max=16"`
+	RecoveryCode string `json:"recoveryCode,omitempty" binding:"max=64"` // /totp/verify only, replaces code when the device is lost
+	Locale       string `json:"locale,omitempty"`
+}
+
+// TOTPAccountRequest represents request payload for /totp/recovery-codes and /totp/disable endpoints,
+// which require either a current code or a recovery code
+type TOTPAccountRequest struct {
+	Email        string `json:"email" binding:"required,email"`
+	System       string `json:"system,omitempty"`
+	Code         string `json:"code,omitempty" binding:"max=16"`
+	RecoveryCode string `json:"recoveryCode,omitempty" binding:"max=64"`
+	Locale       string `json:"locale,omitempty"`
+}
+
+// TOTPRecoveryCodesResponse represents newly generated recovery codes, shown to the user only once
+type TOTPRecoveryCodesResponse struct {
+	Success       bool     `json:"success"`
+	Message       string   `json:"message,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TOTP verification methods
+const (
+	TOTPMethodCode         = "totp"
+	TOTPMethodRecoveryCode = "recovery_code"
+)
+
+// TOTPVerifyResponse represents successful TOTP verification response
+type TOTPVerifyResponse struct {
+	Success                bool   `json:"success"`
+	Message                string `json:"message,omitempty"`
+	Method                 string `json:"method"`                             // TOTPMethodCode or TOTPMethodRecoveryCode
+	RemainingRecoveryCodes *int   `json:"remaining_recovery_codes,omitempty"` // Only when a recovery code was used
+}
+
+// Tracking event types
+const (
+	TrackingEventSent  = "sent"
+	TrackingEventOpen  = "open"
+	TrackingEventClick = "click"
+)
+
+// TrackedMessage represents a tracked activation email stored in Redis
+type TrackedMessage struct {
+	MessageID string `json:"message_id"`
+	Email     string `json:"email"`
+	System    string `json:"system"`
+	Action    string `json:"action"`
+	URL       string `json:"url,omitempty"` // Plaintext activation URL of messages tracked before targets were encrypted (legacy)
+	CreatedAt int64  `json:"created_at"`    // Unix timestamp
+}
+
+// TrackingEvent represents an open/click event of a tracked message
+type TrackingEvent struct {
+	Type string `json:"type"` // "sent", "open", "click"
+	At   int64  `json:"at"`   // Unix timestamp
+}
+
+// BrandingProfile represents per-system branding applied to every email
+type BrandingProfile struct {
+	LogoURL      string `json:"logo_url,omitempty"`      // Logo hiển thị ở header (mặc định hiển thị tên system)
+	PrimaryColor string `json:"primary_color,omitempty"` // Màu chủ đạo dạng #rgb hoặc #rrggbb
+	FooterText   string `json:"footer_text,omitempty"`   // Dòng chữ ở footer
+	SupportEmail string `json:"support_email,omitempty"` // Email hỗ trợ hiển thị ở footer
+	FromName     string `json:"from_name,omitempty"`     // Tên người gửi
+	ReplyTo      string `json:"reply_to,omitempty"`      // Địa chỉ Reply-To
+	LegalAddress string `json:"legal_address,omitempty"` // Địa chỉ pháp lý hiển thị ở footer
+}
+
+// EmailTemplate represents a managed email template version stored in Redis
+type EmailTemplate struct {
+	System    string            `json:"system"`             // Empty = default for every system
+	Action    string            `json:"action"`             // "code", "registration", "password_reset", "verification"
+	Locale    string            `json:"locale"`             // "vi", "en"
+	HTML      string            `json:"html,omitempty"`     // html/template body
+	Markdown  string            `json:"markdown,omitempty"` // Markdown body with front-matter, alternative to HTML
+	Subject   string            `json:"subject,omitempty"`  // text/template subject line, empty = default subject
+	Variants  []TemplateVariant `json:"variants,omitempty"` // A/B variants, the template itself is the "control" variant
+	Schema    []TemplateField   `json:"schema,omitempty"`   // customData fields used by the template
+	Version   int               `json:"version"`            // Version number, starts at 1
+	Comment   string            `json:"comment,omitempty"`  // Change note
+	CreatedAt int64             `json:"created_at"`         // Unix timestamp
+	Active    bool              `json:"active"`             // Whether this version is currently used
+}
+
+// TemplateRequest represents request payload for creating/updating a template
+type TemplateRequest struct {
+	System   string            `json:"system,omitempty"`
+	Action   string            `json:"action" binding:"required"`
+	Locale   string            `json:"locale" binding:"required"`
+	HTML     string            `json:"html" binding:"required_without=Markdown"`
+	Markdown string            `json:"markdown" binding:"required_without=HTML"`
+	Subject  string            `json:"subject,omitempty" binding:"max=200"`
+	Variants []TemplateVariant `json:"variants,omitempty"`
+	Schema   []TemplateField   `json:"schema,omitempty"`
+	Comment  string            `json:"comment,omitempty"`
+}
+
+// TemplateRollbackRequest represents request payload for rolling back a template
+type TemplateRollbackRequest struct {
+	System  string `json:"system,omitempty"`
+	Action  string `json:"action" binding:"required"`
+	Locale  string `json:"locale" binding:"required"`
+	Version int    `json:"version" binding:"required,min=1"`
+}
+
+// Supported customData field types
+const (
+	FieldTypeString  = "string"
+	FieldTypeNumber  = "number"
+	FieldTypeBoolean = "boolean"
+)
+
+// TemplateVariantControl is the name of the variant rendered from the template's own HTML/subject
+const TemplateVariantControl = "control"
+
+// TemplateVariant represents an A/B variant of a template
+type TemplateVariant struct {
+	Name    string `json:"name"`              // Identifier, recorded on activation tokens
+	Weight  int    `json:"weight"`            // Percentage of emails, the control variant gets the rest
+	HTML    string `json:"html"`              // html/template body
+	Subject string `json:"subject,omitempty"` // Subject template, empty = template subject
+}
+
+// VariantStats represents send/conversion counters of a template variant
+type VariantStats struct {
+	Variant        string  `json:"variant"`
+	Issued         int64   `json:"issued"`          // Activation tokens created with this variant
+	Sent           int64   `json:"sent"`            // Emails sent, including resends
+	Converted      int64   `json:"converted"`       // Successful VerifyActivation
+	ConversionRate float64 `json:"conversion_rate"` // Converted / Issued
+}
+
+// TemplateField represents a customData field declared by a template schema
+type TemplateField struct {
+	Name      string      `json:"name"`                 // Key in customData, accessed as {{.CustomData.<name>}}
+	Type      string      `json:"type"`                 // "string", "number", "boolean"
+	Required  bool        `json:"required,omitempty"`   // Request is rejected when missing
+	MaxLength int         `json:"max_length,omitempty"` // Max length for string fields
+	Pattern   string      `json:"pattern,omitempty"`    // Regex for string fields
+	Sample    interface{} `json:"sample,omitempty"`     // Sample value used when test-rendering the template
 }
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/utils"
+)
+
+var ErrInvalidSignedToken = errors.New("signed activation token is invalid")
+
+// Giá trị denylist của token đã ký
+const (
+	TokenDenialUsed     = "used"     // Token đã được xác thực
+	TokenDenialRevoked  = "revoked"  // Yêu cầu bị hủy (link hủy đổi email, hủy lời mời)
+	TokenDenialReplaced = "replaced" // Token bị thay bằng token mới khi gửi lại hoặc yêu cầu bị xóa
+)
+
+// Giá trị typ trong header, activation token và receipt dùng typ riêng để không dùng lẫn được
+const (
+	activationTokenType = "activation+jwt"
+	receiptTokenType    = "receipt+jwt"
+)
+
+type signedTokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// ActivationTokenSigner phát hành activation token ký bằng Ed25519 (JWS compact, alg EdDSA) khi
+// ACTIVATION_TOKEN_MODE=signed. Token mang email/action/system và thời điểm hết hạn nên vẫn xác thực
+// được khi Redis mất dữ liệu, Redis chỉ cần giữ denylist của token đã dùng hoặc bị hủy.
+// Khóa ký được chọn theo kid trong header, khóa cũ giữ lại trong ACTIVATION_SIGNING_KEYS để xác thực
+// token đã phát hành trước khi đổi khóa.
+type ActivationTokenSigner struct {
+	config     *config.Config
+	keyID      string
+	signingKey ed25519.PrivateKey
+	publicKeys map[string]ed25519.PublicKey
+}
+
+func NewActivationTokenSigner(cfg *config.Config) (*ActivationTokenSigner, error) {
+	signingKey, publicKeys, err := loadSigningKeys(cfg.Tokens.SigningKeys, cfg.Tokens.SigningKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("ACTIVATION_SIGNING_KEYS: %w", err)
+	}
+	signer := &ActivationTokenSigner{
+		config:     cfg,
+		publicKeys: publicKeys,
+	}
+	if signingKey != nil {
+		signer.keyID, signer.signingKey = cfg.Tokens.SigningKeyID, signingKey
+	}
+
+	switch cfg.Tokens.Mode {
+	case config.TokenModeStored:
+	case config.TokenModeSigned:
+		if signer.signingKey == nil {
+			return nil, fmt.Errorf("ACTIVATION_SIGNING_KEY_ID %q is not declared in ACTIVATION_SIGNING_KEYS", cfg.Tokens.SigningKeyID)
+		}
+	default:
+		return nil, fmt.Errorf("ACTIVATION_TOKEN_MODE must be %q or %q, got %q", config.TokenModeStored, config.TokenModeSigned, cfg.Tokens.Mode)
+	}
+
+	return signer, nil
+}
+
+// Enabled kiểm tra token mới có được phát hành dưới dạng token đã ký hay không
+func (s *ActivationTokenSigner) Enabled() bool {
+	return s != nil && s.config.Tokens.Mode == config.TokenModeSigned && s.signingKey != nil
+}
+
+// IsSigned kiểm tra chuỗi có dạng token đã ký (JWS compact) hay không, UUID của chế độ stored không có dấu chấm
+func (s *ActivationTokenSigner) IsSigned(token string) bool {
+	return s != nil && strings.Count(token, ".") == 2
+}
+
+// Sign ký token với thông tin hiện tại của yêu cầu, trả về token và jti
+func (s *ActivationTokenSigner) Sign(token *models.ActivationToken) (string, string, error) {
+	if !s.Enabled() {
+		return "", "", fmt.Errorf("signed activation tokens are not enabled")
+	}
+
+	jti, err := utils.GenerateActivationToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	claims := models.ActivationTokenClaims{
+		Issuer:     s.config.Tokens.Issuer,
+		Subject:    token.Email,
+		IssuedAt:   token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		ID:         jti,
+		Action:     token.Action,
+		System:     token.System,
+		Locale:     token.Locale,
+		Variant:    token.Variant,
+		NonceHash:  token.NonceHash,
+		NewEmail:   token.NewEmail,
+		Invitation: token.Invitation,
+		Tenant:     token.Tenant,
+	}
+
+	signed, err := signJWS(s.signingKey, s.keyID, activationTokenType, claims)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign activation token: %w", err)
+	}
+	return signed, jti, nil
+}
+
+// Parse kiểm tra chữ ký và trả về activation token từ claims của token đã ký.
+// Thời điểm hết hạn không được kiểm tra ở đây, handler xử lý như token lưu trong Redis.
+func (s *ActivationTokenSigner) Parse(token string) (*models.ActivationToken, error) {
+	parts := strings.Split(token, ".")
+	if s == nil || len(parts) != 3 {
+		return nil, ErrInvalidSignedToken
+	}
+
+	var header signedTokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "EdDSA" {
+		return nil, ErrInvalidSignedToken
+	}
+	if header.Typ != activationTokenType {
+		return nil, fmt.Errorf("%w: unexpected type %q", ErrInvalidSignedToken, header.Typ)
+	}
+	publicKey, ok := s.publicKeys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidSignedToken, header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidSignedToken)
+	}
+
+	var claims models.ActivationTokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidSignedToken
+	}
+	if claims.Issuer != s.config.Tokens.Issuer || claims.ID == "" || claims.Subject == "" || claims.Action == "" {
+		return nil, fmt.Errorf("%w: unexpected claims", ErrInvalidSignedToken)
+	}
+
+	return &models.ActivationToken{
+		Token:      token,
+		TokenID:    claims.ID,
+		Email:      claims.Subject,
+		Action:     claims.Action,
+		System:     claims.System,
+		Locale:     claims.Locale,
+		Variant:    claims.Variant,
+		NonceHash:  claims.NonceHash,
+		NewEmail:   claims.NewEmail,
+		Invitation: claims.Invitation,
+		Tenant:     claims.Tenant,
+		CreatedAt:  claims.IssuedAt,
+		ExpiresAt:  claims.ExpiresAt,
+	}, nil
+}
+
+// signJWS ký claims thành JWS compact (alg EdDSA) với typ và kid trong header
+func signJWS(key ed25519.PrivateKey, kid, typ string, claims interface{}) (string, error) {
+	header, err := json.Marshal(signedTokenHeader{Alg: "EdDSA", Typ: typ, Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(key, []byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// loadSigningKeys đọc danh sách khóa kid:seed, trả về khóa ký của keyID (nil nếu không có) và public key theo kid
+func loadSigningKeys(keys map[string]string, keyID string) (ed25519.PrivateKey, map[string]ed25519.PublicKey, error) {
+	kids := make([]string, 0, len(keys))
+	for kid := range keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	var signingKey ed25519.PrivateKey
+	publicKeys := make(map[string]ed25519.PublicKey, len(keys))
+	for _, kid := range kids {
+		key, err := parseSigningKey(keys[kid])
+		if err != nil {
+			return nil, nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+		publicKeys[kid] = key.Public().(ed25519.PublicKey)
+		if kid == keyID {
+			signingKey = key
+		}
+	}
+	return signingKey, publicKeys, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// parseSigningKey đọc seed Ed25519 32 byte (hoặc private key 64 byte) dạng base64
+func parseSigningKey(value string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		if raw, err = base64.RawURLEncoding.DecodeString(value); err != nil {
+			return nil, fmt.Errorf("not valid base64")
+		}
+	}
+
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("expected a %d-byte seed, got %d bytes", ed25519.SeedSize, len(raw))
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+)
+
+// testSigningKeys trả về danh sách khóa kid:seed với seed lặp lại byte fill, dùng cho ACTIVATION/RECEIPT_SIGNING_KEYS
+func testSigningKeys(fills map[string]byte) map[string]string {
+	keys := make(map[string]string, len(fills))
+	for kid, fill := range fills {
+		keys[kid] = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, ed25519.SeedSize))
+	}
+	return keys
+}
+
+func newTestActivationSigner(t *testing.T, keyID string) *ActivationTokenSigner {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Tokens.Mode = config.TokenModeSigned
+	cfg.Tokens.Issuer = "mrs_sendemail_be"
+	cfg.Tokens.SigningKeyID = keyID
+	cfg.Tokens.SigningKeys = testSigningKeys(map[string]byte{"k1": 1, "k2": 2})
+
+	signer, err := NewActivationTokenSigner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func testActivationToken() *models.ActivationToken {
+	now := time.Now().Unix()
+	return &models.ActivationToken{
+		Email:     "user@example.com",
+		Action:    "registration",
+		System:    "Fix4Home",
+		Locale:    "en",
+		CreatedAt: now,
+		ExpiresAt: now + 1800,
+	}
+}
+
+// resignSegments ghép lại token với header/payload đã sửa và ký bằng key (nil = giữ chữ ký cũ)
+func resignSegments(t *testing.T, token string, key ed25519.PrivateKey, edit func(header, payload map[string]interface{})) string {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	var header, payload map[string]interface{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		t.Fatal(err)
+	}
+	if err := decodeSegment(parts[1], &payload); err != nil {
+		t.Fatal(err)
+	}
+	edit(header, payload)
+
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := encode(header) + "." + encode(payload)
+	if key == nil {
+		return signingInput + "." + parts[2]
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(signingInput)))
+}
+
+func TestActivationTokenSignParse(t *testing.T) {
+	signer := newTestActivationSigner(t, "k2")
+	token, jti, err := signer.Sign(testActivationToken())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := signer.Parse(token)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if parsed.TokenID != jti || parsed.Email != "user@example.com" || parsed.Action != "registration" || parsed.System != "Fix4Home" {
+		t.Fatalf("Parse = %+v", parsed)
+	}
+
+	var header signedTokenHeader
+	if err := decodeSegment(strings.Split(token, ".")[0], &header); err != nil {
+		t.Fatal(err)
+	}
+	if header != (signedTokenHeader{Alg: "EdDSA", Typ: activationTokenType, Kid: "k2"}) {
+		t.Fatalf("header = %+v", header)
+	}
+}
+
+func TestActivationTokenParseRejectsForgedTokens(t *testing.T) {
+	signer := newTestActivationSigner(t, "k2")
+	token, _, err := signer.Sign(testActivationToken())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey := signer.signingKey
+	unknownKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{9}, ed25519.SeedSize))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong alg", resignSegments(t, token, signingKey, func(h, _ map[string]interface{}) { h["alg"] = "none" })},
+		{"unknown kid", resignSegments(t, token, unknownKey, func(h, _ map[string]interface{}) { h["kid"] = "k9" })},
+		{"kid of another key", resignSegments(t, token, nil, func(h, _ map[string]interface{}) { h["kid"] = "k1" })},
+		{"tampered payload", resignSegments(t, token, nil, func(_, p map[string]interface{}) { p["sub"] = "attacker@example.com" })},
+		{"receipt type", resignSegments(t, token, signingKey, func(h, _ map[string]interface{}) { h["typ"] = receiptTokenType })},
+		{"generic type", resignSegments(t, token, signingKey, func(h, _ map[string]interface{}) { h["typ"] = "JWT" })},
+		{"not a JWS", "a.b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := signer.Parse(tt.token); !errors.Is(err, ErrInvalidSignedToken) {
+				t.Fatalf("Parse = %v, want ErrInvalidSignedToken", err)
+			}
+		})
+	}
+}
+
+func TestActivationTokenRotatedKeyStillVerifies(t *testing.T) {
+	// Token phát hành bằng k1 trước khi đổi khóa ký sang k2
+	token, _, err := newTestActivationSigner(t, "k1").Sign(testActivationToken())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newTestActivationSigner(t, "k2")
+	if _, err := rotated.Parse(token); err != nil {
+		t.Fatalf("token signed with the previous key: %v", err)
+	}
+
+	delete(rotated.publicKeys, "k1")
+	if _, err := rotated.Parse(token); !errors.Is(err, ErrInvalidSignedToken) {
+		t.Fatalf("token of a removed key = %v, want ErrInvalidSignedToken", err)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"regexp"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+)
+
+var brandingColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// BrandingService cung cấp branding profile theo system.
+// Thứ tự ưu tiên: Redis (branding:<system>) > file cấu hình > mặc định từ config.
+type BrandingService struct {
+	config       *config.Config
+	redisService *RedisService
+	profiles     map[string]models.BrandingProfile
+}
+
+func NewBrandingService(cfg *config.Config, redisService *RedisService) *BrandingService {
+	profiles := make(map[string]models.BrandingProfile)
+
+	if cfg.Branding.ProfilesFile != "" {
+		loaded, err := loadBrandingProfiles(cfg.Branding.ProfilesFile)
+		if err != nil {
+			log.Printf("Warning: failed to load branding profiles: %v", err)
+		} else {
+			profiles = loaded
+		}
+	}
+
+	return &BrandingService{
+		config:       cfg,
+		redisService: redisService,
+		profiles:     profiles,
+	}
+}
+
+// loadBrandingProfiles đọc file JSON dạng {"<system>": {...profile...}}
+func loadBrandingProfiles(path string) (map[string]models.BrandingProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read branding profiles file: %w", err)
+	}
+
+	var profiles map[string]models.BrandingProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse branding profiles file: %w", err)
+	}
+
+	return profiles, nil
+}
+
+// Profile trả về branding profile đã merge cho system
+func (b *BrandingService) Profile(ctx context.Context, system string) models.BrandingProfile {
+	profile := models.BrandingProfile{
+		PrimaryColor: b.config.Branding.PrimaryColor,
+		FromName:     b.config.SMTP.FromName,
+	}
+
+	if fileProfile, ok := b.profiles[system]; ok {
+		profile = mergeBranding(profile, fileProfile)
+	}
+
+	if b.redisService != nil {
+		redisProfile, err := b.redisService.GetBrandingProfile(ctx, system)
+		if err != nil {
+			log.Printf("Error loading branding profile for %s from Redis: %v", system, err)
+		} else if redisProfile != nil {
+			profile = mergeBranding(profile, *redisProfile)
+		}
+	}
+
+	return profile
+}
+
+// Systems trả về các system có branding profile trong file cấu hình
+func (b *BrandingService) Systems() []string {
+	systems := make([]string, 0, len(b.profiles))
+	for system := range b.profiles {
+		systems = append(systems, system)
+	}
+	return systems
+}
+
+// mergeBranding ghi đè các field không rỗng và hợp lệ của override lên base
+func mergeBranding(base, override models.BrandingProfile) models.BrandingProfile {
+	if override.LogoURL != "" {
+		base.LogoURL = override.LogoURL
+	}
+	if override.PrimaryColor != "" {
+		if brandingColorPattern.MatchString(override.PrimaryColor) {
+			base.PrimaryColor = override.PrimaryColor
+		} else {
+			log.Printf("Ignoring invalid branding color %q", override.PrimaryColor)
+		}
+	}
+	if override.FooterText != "" {
+		base.FooterText = override.FooterText
+	}
+	if override.SupportEmail != "" {
+		if _, err := mail.ParseAddress(override.SupportEmail); err == nil {
+			base.SupportEmail = override.SupportEmail
+		} else {
+			log.Printf("Ignoring invalid branding support email %q", override.SupportEmail)
+		}
+	}
+	if override.FromName != "" {
+		base.FromName = sanitizeHeaderValue(override.FromName)
+	}
+	if override.ReplyTo != "" {
+		if _, err := mail.ParseAddress(override.ReplyTo); err == nil {
+			base.ReplyTo = override.ReplyTo
+		} else {
+			log.Printf("Ignoring invalid branding reply-to %q", override.ReplyTo)
+		}
+	}
+	if override.LegalAddress != "" {
+		base.LegalAddress = override.LegalAddress
+	}
+	return base
+}
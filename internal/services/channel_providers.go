@@ -0,0 +1,150 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"mrs_sendemail_be/internal/utils"
+)
+
+// maxProviderResponse giới hạn kích thước response đọc từ provider
+const maxProviderResponse = 64 << 10
+
+// webhookProvider gửi tin nhắn tới SMS gateway nhận POST JSON {"to", "message"}, xác thực bằng Bearer token
+type webhookProvider struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+func (p *webhookProvider) Send(ctx context.Context, message ChannelMessage) error {
+	headers := map[string]string{}
+	if p.token != "" {
+		headers["Authorization"] = "Bearer " + p.token
+	}
+
+	payload := map[string]string{
+		"to":      message.Recipient,
+		"message": message.Text,
+	}
+	return postJSON(ctx, p.client, p.url, headers, payload, nil)
+}
+
+// zaloZNSProvider gửi tin qua Zalo Notification Service. ZNS chỉ gửi theo template đã được duyệt,
+// mã xác thực được truyền qua template_data.
+type zaloZNSProvider struct {
+	client      *http.Client
+	url         string
+	accessToken string
+}
+
+func (p *zaloZNSProvider) Send(ctx context.Context, message ChannelMessage) error {
+	trackingID, err := utils.GenerateActivationToken()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"phone":         strings.TrimPrefix(message.Recipient, "+"), // ZNS nhận số không có dấu "+", ví dụ 84901234567
+		"template_id":   message.TemplateID,
+		"template_data": message.Params,
+		"tracking_id":   trackingID,
+	}
+
+	var response struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := postJSON(ctx, p.client, p.url, map[string]string{"access_token": p.accessToken}, payload, &response); err != nil {
+		return err
+	}
+	if response.Error != 0 {
+		return fmt.Errorf("zalo returned error %d: %s", response.Error, response.Message)
+	}
+	return nil
+}
+
+// telegramProvider gửi tin qua Telegram Bot API (sendMessage), người nhận là chat ID đã bắt đầu chat với bot
+type telegramProvider struct {
+	client   *http.Client
+	baseURL  string
+	botToken string
+}
+
+func (p *telegramProvider) Send(ctx context.Context, message ChannelMessage) error {
+	payload := map[string]string{
+		"chat_id": message.Recipient,
+		"text":    message.Text,
+	}
+
+	var response struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", p.baseURL, p.botToken)
+	if err := postJSON(ctx, p.client, endpoint, nil, payload, &response); err != nil {
+		return err
+	}
+	if !response.OK {
+		return fmt.Errorf("telegram returned error: %s", response.Description)
+	}
+	return nil
+}
+
+// postJSON gửi payload dạng JSON tới provider và đọc response (nếu response khác nil).
+// Response không phải 2xx được coi là lỗi.
+func postJSON(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, payload, response interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal provider request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create provider request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Không đưa URL vào lỗi vì URL có thể chứa token (Telegram)
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("provider request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxProviderResponse))
+	if err != nil {
+		return fmt.Errorf("failed to read provider response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("provider returned HTTP %d: %s", resp.StatusCode, truncate(string(data), 200))
+	}
+
+	if response != nil {
+		if err := json.Unmarshal(data, response); err != nil {
+			return fmt.Errorf("unexpected provider response: %w", err)
+		}
+	}
+	return nil
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max] + "..."
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mrs_sendemail_be/internal/config"
+)
+
+// providerStub là provider giả lập ghi lại request cuối cùng và trả về status/body cấu hình sẵn
+type providerStub struct {
+	server  *httptest.Server
+	status  int
+	body    string
+	calls   int
+	path    string
+	headers http.Header
+	payload map[string]interface{}
+}
+
+func newProviderStub(t *testing.T, status int, body string) *providerStub {
+	t.Helper()
+	stub := &providerStub{status: status, body: body}
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.calls++
+		stub.path = r.URL.Path
+		stub.headers = r.Header.Clone()
+		stub.payload = nil
+		_ = json.NewDecoder(r.Body).Decode(&stub.payload)
+		w.WriteHeader(stub.status)
+		_, _ = w.Write([]byte(stub.body))
+	}))
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func newTestChannelService(t *testing.T, name string, channel config.ChannelConfig) *ChannelService {
+	t.Helper()
+	cfg := &config.Config{Channels: map[string]config.ChannelConfig{name: channel}}
+	cfg.Code.ExpireMinutes = 5
+	service, err := NewChannelService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func TestWebhookProvider(t *testing.T) {
+	stub := newProviderStub(t, http.StatusOK, `{}`)
+	service := newTestChannelService(t, "sms", config.ChannelConfig{
+		Provider:       config.ProviderWebhook,
+		URL:            stub.server.URL + "/send",
+		Token:          "sms-token",
+		TimeoutSeconds: 5,
+	})
+	ctx := context.Background()
+
+	if err := service.SendCode(ctx, "sms", "+84901234567", "123 456", "Fix4Home", "en"); err != nil {
+		t.Fatalf("SendCode: %v", err)
+	}
+	if stub.path != "/send" || stub.headers.Get("Authorization") != "Bearer sms-token" {
+		t.Fatalf("unexpected request %s %v", stub.path, stub.headers)
+	}
+	if stub.payload["to"] != "+84901234567" || !strings.Contains(stub.payload["message"].(string), "123 456") {
+		t.Fatalf("unexpected payload %v", stub.payload)
+	}
+
+	stub.status, stub.body = http.StatusBadGateway, "upstream down"
+	if err := service.SendCode(ctx, "sms", "+84901234567", "123 456", "Fix4Home", "en"); err == nil || !strings.Contains(err.Error(), "HTTP 502") {
+		t.Fatalf("SendCode on 502: %v", err)
+	}
+
+	calls := stub.calls
+	for _, phone := range []string{"0901234567", "84901234567", "+0901234567", "+84 901 234 567", "+8490123456789012"} {
+		if err := service.SendCode(ctx, "sms", phone, "123 456", "Fix4Home", "en"); !errors.Is(err, ErrInvalidRecipient) {
+			t.Fatalf("SendCode(%q) = %v, want ErrInvalidRecipient", phone, err)
+		}
+	}
+	if stub.calls != calls {
+		t.Fatal("provider called for a non-E.164 phone number")
+	}
+}
+
+func TestZaloZNSProvider(t *testing.T) {
+	stub := newProviderStub(t, http.StatusOK, `{"error":0,"message":"Success"}`)
+	service := newTestChannelService(t, "zalo", config.ChannelConfig{
+		Provider:       config.ProviderZaloZNS,
+		URL:            stub.server.URL,
+		Token:          "zalo-token",
+		TemplateID:     "tpl-1",
+		TemplateData:   map[string]string{"otp": "{{.Code}}"},
+		TimeoutSeconds: 5,
+	})
+	ctx := context.Background()
+
+	if err := service.SendCode(ctx, "zalo", "+84901234567", "123456", "Fix4Home", "vi"); err != nil {
+		t.Fatalf("SendCode: %v", err)
+	}
+	if stub.headers.Get("access_token") != "zalo-token" {
+		t.Fatalf("missing access token header: %v", stub.headers)
+	}
+	data, _ := stub.payload["template_data"].(map[string]interface{})
+	if stub.payload["phone"] != "84901234567" || stub.payload["template_id"] != "tpl-1" || data["otp"] != "123456" {
+		t.Fatalf("unexpected payload %v", stub.payload)
+	}
+
+	// Zalo trả HTTP 200 kèm mã lỗi trong body
+	stub.body = `{"error":-124,"message":"Invalid access token"}`
+	if err := service.SendCode(ctx, "zalo", "+84901234567", "123456", "Fix4Home", "vi"); err == nil || !strings.Contains(err.Error(), "-124") {
+		t.Fatalf("SendCode on provider error: %v", err)
+	}
+
+	stub.status, stub.body = http.StatusUnauthorized, `{"error":-216}`
+	if err := service.SendCode(ctx, "zalo", "+84901234567", "123456", "Fix4Home", "vi"); err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Fatalf("SendCode on 401: %v", err)
+	}
+
+	calls := stub.calls
+	if err := service.SendCode(ctx, "zalo", "0901234567", "123456", "Fix4Home", "vi"); !errors.Is(err, ErrInvalidRecipient) {
+		t.Fatalf("SendCode with local number = %v, want ErrInvalidRecipient", err)
+	}
+	if stub.calls != calls {
+		t.Fatal("provider called for a non-E.164 phone number")
+	}
+}
+
+func TestTelegramProvider(t *testing.T) {
+	stub := newProviderStub(t, http.StatusOK, `{"ok":true}`)
+	service := newTestChannelService(t, "telegram", config.ChannelConfig{
+		Provider:       config.ProviderTelegram,
+		URL:            stub.server.URL,
+		Token:          "bot-token",
+		TimeoutSeconds: 5,
+	})
+	ctx := context.Background()
+
+	// Người nhận Telegram là chat ID, không phải số điện thoại
+	if err := service.SendCode(ctx, "telegram", "123456789", "123456", "Fix4Home", "en"); err != nil {
+		t.Fatalf("SendCode: %v", err)
+	}
+	if stub.path != "/botbot-token/sendMessage" || stub.payload["chat_id"] != "123456789" {
+		t.Fatalf("unexpected request %s %v", stub.path, stub.payload)
+	}
+
+	stub.status, stub.body = http.StatusForbidden, `{"ok":false,"description":"Forbidden: bot was blocked by the user"}`
+	err := service.SendCode(ctx, "telegram", "123456789", "123456", "Fix4Home", "en")
+	if err == nil || !strings.Contains(err.Error(), "HTTP 403") {
+		t.Fatalf("SendCode on 403: %v", err)
+	}
+	if strings.Contains(err.Error(), "bot-token") {
+		t.Fatalf("error leaks the bot token: %v", err)
+	}
+}
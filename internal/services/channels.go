@@ -0,0 +1,174 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/i18n"
+)
+
+// e164Pattern là số điện thoại dạng E.164: dấu "+", mã quốc gia và tối đa 15 chữ số
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+var ErrInvalidRecipient = errors.New("invalid recipient")
+
+// ChannelMessage là tin nhắn chứa mã xác thực gửi qua kênh ngoài email
+type ChannelMessage struct {
+	Recipient  string            // Số điện thoại E.164 hoặc chat ID
+	Text       string            // Nội dung đã render theo locale
+	TemplateID string            // Template của provider (ZNS)
+	Params     map[string]string // Tham số template của provider (ZNS)
+}
+
+// ChannelProvider gửi tin nhắn qua HTTP API của một nhà cung cấp
+type ChannelProvider interface {
+	Send(ctx context.Context, message ChannelMessage) error
+}
+
+// channelTemplateData là dữ liệu dùng trong templates và template_data của kênh
+type channelTemplateData struct {
+	Code          string
+	System        string
+	ExpireMinutes int
+}
+
+type deliveryChannel struct {
+	config       config.ChannelConfig
+	provider     ChannelProvider
+	templates    map[string]*template.Template // Nội dung tin nhắn theo locale
+	templateData map[string]*template.Template // Tham số template ZNS theo tên
+}
+
+// ChannelService gửi mã xác thực qua các kênh khai báo trong CHANNELS_FILE (SMS, Zalo ZNS, Telegram).
+// Mỗi kênh dùng một HTTP provider, URL của provider cấu hình được nên có thể trỏ về stub khi kiểm thử.
+type ChannelService struct {
+	config   *config.Config
+	channels map[string]*deliveryChannel
+}
+
+func NewChannelService(cfg *config.Config) (*ChannelService, error) {
+	service := &ChannelService{
+		config:   cfg,
+		channels: make(map[string]*deliveryChannel),
+	}
+
+	for name, channelConfig := range cfg.Channels {
+		channel, err := newDeliveryChannel(name, channelConfig)
+		if err != nil {
+			return nil, err
+		}
+		service.channels[name] = channel
+	}
+
+	return service, nil
+}
+
+func newDeliveryChannel(name string, channelConfig config.ChannelConfig) (*deliveryChannel, error) {
+	client := &http.Client{Timeout: time.Duration(channelConfig.TimeoutSeconds) * time.Second}
+
+	var provider ChannelProvider
+	switch channelConfig.Provider {
+	case config.ProviderWebhook:
+		provider = &webhookProvider{client: client, url: channelConfig.URL, token: channelConfig.Token}
+	case config.ProviderZaloZNS:
+		provider = &zaloZNSProvider{client: client, url: channelConfig.URL, accessToken: channelConfig.Token}
+	case config.ProviderTelegram:
+		provider = &telegramProvider{client: client, baseURL: channelConfig.URL, botToken: channelConfig.Token}
+	default:
+		return nil, fmt.Errorf("channel %q: unsupported provider %q", name, channelConfig.Provider)
+	}
+
+	channel := &deliveryChannel{
+		config:       channelConfig,
+		provider:     provider,
+		templates:    make(map[string]*template.Template),
+		templateData: make(map[string]*template.Template),
+	}
+	for locale, text := range channelConfig.Templates {
+		tmpl, err := template.New(name + "." + locale).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("channel %q: template %q: %w", name, locale, err)
+		}
+		channel.templates[locale] = tmpl
+	}
+	for param, text := range channelConfig.TemplateData {
+		tmpl, err := template.New(name + "." + param).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("channel %q: template_data %q: %w", name, param, err)
+		}
+		channel.templateData[param] = tmpl
+	}
+
+	return channel, nil
+}
+
+// Names trả về tên các kênh đã khai báo, sắp xếp theo tên
+func (s *ChannelService) Names() []string {
+	names := make([]string, 0, len(s.channels))
+	for name := range s.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SendCode gửi mã xác thực (đã định dạng để hiển thị) tới người nhận qua kênh
+func (s *ChannelService) SendCode(ctx context.Context, name, recipient, code, system, locale string) error {
+	channel, ok := s.channels[name]
+	if !ok {
+		return fmt.Errorf("unknown channel %q", name)
+	}
+	if channel.config.RecipientField() == "phone" && !e164Pattern.MatchString(recipient) {
+		return fmt.Errorf("channel %q: %w: phone number must be in E.164 format", name, ErrInvalidRecipient)
+	}
+
+	data := channelTemplateData{Code: code, System: system, ExpireMinutes: s.config.Code.ExpireMinutes}
+	message := ChannelMessage{
+		Recipient:  recipient,
+		TemplateID: channel.config.TemplateID,
+	}
+
+	// Nội dung theo template của kênh cho locale, mặc định dùng message trong catalog
+	if tmpl, ok := channel.templates[locale]; ok {
+		text, err := renderChannelTemplate(tmpl, data)
+		if err != nil {
+			return err
+		}
+		message.Text = text
+	} else {
+		message.Text = i18n.T(locale, "channel.code.message", code, system, data.ExpireMinutes)
+	}
+
+	if len(channel.templateData) > 0 {
+		message.Params = make(map[string]string, len(channel.templateData))
+		for param, tmpl := range channel.templateData {
+			value, err := renderChannelTemplate(tmpl, data)
+			if err != nil {
+				return err
+			}
+			message.Params[param] = value
+		}
+	}
+
+	if err := channel.provider.Send(ctx, message); err != nil {
+		return fmt.Errorf("channel %q: %w", name, err)
+	}
+	return nil
+}
+
+func renderChannelTemplate(tmpl *template.Template, data channelTemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render channel template %s: %w", tmpl.Name(), err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
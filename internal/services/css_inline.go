@@ -0,0 +1,364 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	cssCommentPattern  = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssCompoundPattern = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9]*)?((\.|#)[a-zA-Z0-9_-]+)*$`)
+	cssSimplePartRegex = regexp.MustCompile(`[.#][a-zA-Z0-9_-]+`)
+)
+
+// cssDeclaration là một khai báo CSS (property: value)
+type cssDeclaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+// cssRule là rule có thể inline: selector đơn giản (tag, .class, #id, tổ hợp con cháu)
+type cssRule struct {
+	compounds    []cssCompound
+	declarations []cssDeclaration
+	specificity  int
+	order        int
+}
+
+// cssCompound là một phần của selector, ví dụ "td.content#main"
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+// renderEmail render template email rồi inline CSS để hiển thị đúng trên các email client
+// không hỗ trợ <style> (Gmail app, Outlook...)
+func renderEmail(tmpl *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return inlineCSS(buf.String())
+}
+
+// inlineCSS chuyển các rule trong <style> thành thuộc tính style của từng phần tử.
+// Rule không inline được (@media, pseudo-class, selector phức tạp) được giữ lại trong <style>,
+// thẻ <style> rỗng sau khi inline bị xóa.
+func inlineCSS(document string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse email html: %w", err)
+	}
+
+	var styles []*html.Node
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom == atom.Style {
+			styles = append(styles, n)
+		}
+	})
+	if len(styles) == 0 {
+		return document, nil
+	}
+
+	var rules []cssRule
+	for _, style := range styles {
+		var remaining []string
+		rules, remaining = parseStylesheet(nodeText(style), rules)
+
+		for child := style.FirstChild; child != nil; {
+			next := child.NextSibling
+			style.RemoveChild(child)
+			child = next
+		}
+		if len(remaining) == 0 {
+			style.Parent.RemoveChild(style)
+			continue
+		}
+		style.AppendChild(&html.Node{
+			Type: html.TextNode,
+			Data: "\n" + strings.Join(remaining, "\n") + "\n",
+		})
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].specificity != rules[j].specificity {
+			return rules[i].specificity < rules[j].specificity
+		}
+		return rules[i].order < rules[j].order
+	})
+
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom == atom.Head || hasAncestor(n, atom.Head) {
+			return
+		}
+		applyRules(n, rules)
+	})
+
+	var out bytes.Buffer
+	if err := html.Render(&out, doc); err != nil {
+		return "", fmt.Errorf("failed to render email html: %w", err)
+	}
+	return out.String(), nil
+}
+
+// parseStylesheet tách stylesheet thành các rule inline được và các rule phải giữ lại trong <style>
+func parseStylesheet(css string, rules []cssRule) ([]cssRule, []string) {
+	css = cssCommentPattern.ReplaceAllString(css, "")
+	var remaining []string
+
+	for {
+		css = strings.TrimSpace(css)
+		if css == "" {
+			break
+		}
+
+		open := strings.Index(css, "{")
+		if open < 0 {
+			break
+		}
+
+		if strings.HasPrefix(css, "@") {
+			end := matchingBrace(css, open)
+			remaining = append(remaining, strings.TrimSpace(css[:end]))
+			css = css[end:]
+			continue
+		}
+
+		closeIdx := strings.Index(css[open:], "}")
+		if closeIdx < 0 {
+			break
+		}
+		selectors := css[:open]
+		body := css[open+1 : open+closeIdx]
+		css = css[open+closeIdx+1:]
+
+		declarations := parseDeclarations(body)
+		var kept []string
+		for _, selector := range strings.Split(selectors, ",") {
+			selector = strings.Join(strings.Fields(selector), " ")
+			if selector == "" {
+				continue
+			}
+			rule, ok := parseSelector(selector)
+			if !ok {
+				kept = append(kept, selector)
+				continue
+			}
+			rule.declarations = declarations
+			rule.order = len(rules)
+			rules = append(rules, rule)
+		}
+		if len(kept) > 0 {
+			remaining = append(remaining, fmt.Sprintf("%s { %s }", strings.Join(kept, ", "), strings.TrimSpace(body)))
+		}
+	}
+
+	return rules, remaining
+}
+
+// matchingBrace trả về vị trí ngay sau dấu } đóng khối bắt đầu tại open
+func matchingBrace(css string, open int) int {
+	depth := 0
+	for i := open; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(css)
+}
+
+func parseDeclarations(body string) []cssDeclaration {
+	var declarations []cssDeclaration
+	for _, part := range strings.Split(body, ";") {
+		colon := strings.Index(part, ":")
+		if colon < 0 {
+			continue
+		}
+		property := strings.ToLower(strings.TrimSpace(part[:colon]))
+		value := strings.TrimSpace(part[colon+1:])
+		if property == "" || value == "" {
+			continue
+		}
+
+		important := false
+		if idx := strings.Index(strings.ToLower(value), "!important"); idx >= 0 {
+			important = true
+			value = strings.TrimSpace(value[:idx])
+		}
+		declarations = append(declarations, cssDeclaration{property: property, value: value, important: important})
+	}
+	return declarations
+}
+
+// parseSelector phân tích selector đơn giản, trả về false nếu selector không inline được
+func parseSelector(selector string) (cssRule, bool) {
+	var rule cssRule
+	for _, part := range strings.Split(selector, " ") {
+		if !cssCompoundPattern.MatchString(part) {
+			return cssRule{}, false
+		}
+
+		var compound cssCompound
+		if idx := strings.IndexAny(part, ".#"); idx >= 0 {
+			compound.tag = strings.ToLower(part[:idx])
+		} else {
+			compound.tag = strings.ToLower(part)
+		}
+		if compound.tag != "" {
+			rule.specificity++
+		}
+		for _, simple := range cssSimplePartRegex.FindAllString(part, -1) {
+			if simple[0] == '#' {
+				compound.id = simple[1:]
+				rule.specificity += 100
+			} else {
+				compound.classes = append(compound.classes, simple[1:])
+				rule.specificity += 10
+			}
+		}
+		rule.compounds = append(rule.compounds, compound)
+	}
+	return rule, len(rule.compounds) > 0
+}
+
+// applyRules gộp các rule khớp với phần tử vào thuộc tính style.
+// Style inline có sẵn được ưu tiên hơn stylesheet, trừ khai báo !important.
+func applyRules(n *html.Node, rules []cssRule) {
+	var normal, important []cssDeclaration
+	for _, rule := range rules {
+		if !rule.matches(n) {
+			continue
+		}
+		for _, decl := range rule.declarations {
+			if decl.important {
+				important = append(important, decl)
+			} else {
+				normal = append(normal, decl)
+			}
+		}
+	}
+	if len(normal) == 0 && len(important) == 0 {
+		return
+	}
+
+	existing := parseDeclarations(attribute(n, "style"))
+
+	var properties []string
+	values := make(map[string]string)
+	set := func(decls []cssDeclaration) {
+		for _, decl := range decls {
+			if _, ok := values[decl.property]; !ok {
+				properties = append(properties, decl.property)
+			}
+			values[decl.property] = decl.value
+		}
+	}
+	set(normal)
+	set(existing)
+	set(important)
+
+	declarations := make([]string, 0, len(properties))
+	for _, property := range properties {
+		declarations = append(declarations, property+": "+values[property])
+	}
+	setAttribute(n, "style", strings.Join(declarations, "; ")+";")
+}
+
+func (r cssRule) matches(n *html.Node) bool {
+	last := len(r.compounds) - 1
+	if !r.compounds[last].matches(n) {
+		return false
+	}
+
+	// Các phần phía trước phải khớp với tổ tiên theo đúng thứ tự
+	i := last - 1
+	for p := n.Parent; p != nil && i >= 0; p = p.Parent {
+		if p.Type == html.ElementNode && r.compounds[i].matches(p) {
+			i--
+		}
+	}
+	return i < 0
+}
+
+func (c cssCompound) matches(n *html.Node) bool {
+	if c.tag != "" && c.tag != n.Data {
+		return false
+	}
+	if c.id != "" && attribute(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(attribute(n, "class"))
+		for _, class := range c.classes {
+			if !containsString(classes, class) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func walkElements(n *html.Node, fn func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		fn(n)
+	}
+	for child := n.FirstChild; child != nil; {
+		// Lưu trước node kế tiếp vì fn có thể xóa child khỏi cây
+		next := child.NextSibling
+		walkElements(child, fn)
+		child = next
+	}
+}
+
+func hasAncestor(n *html.Node, a atom.Atom) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.DataAtom == a {
+			return true
+		}
+	}
+	return false
+}
+
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			sb.WriteString(child.Data)
+		}
+	}
+	return sb.String()
+}
+
+func attribute(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func setAttribute(n *html.Node, key, value string) {
+	for i := range n.Attr {
+		if n.Attr[i].Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: value})
+}
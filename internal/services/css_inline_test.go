@@ -0,0 +1,96 @@
+package services
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/i18n"
+	"mrs_sendemail_be/internal/models"
+)
+
+var update = flag.Bool("update", false, "regenerate testdata/*.golden")
+
+// goldenEmailData dữ liệu cố định dùng để render template dựng sẵn cho golden file
+func goldenEmailData(locale string) emailData {
+	return emailData{
+		Localizer: i18n.NewLocalizer(locale),
+		System:    "Fix4Home",
+		Brand: models.BrandingProfile{
+			PrimaryColor: "#007bff",
+			FromName:     "Fix4Home System",
+			SupportEmail: "support@example.com",
+		},
+	}
+}
+
+func TestBuiltinTemplatesGolden(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Code.ExpireMinutes = 5
+	s := NewSMTPService(cfg, nil, nil, nil)
+
+	const activationURL = "https://app.example.com/verify.html?token=golden-token"
+	cases := []struct {
+		name   string
+		render func() (string, string, error)
+	}{
+		{"code_en", func() (string, string, error) {
+			compiled := &compiledTemplate{tmpl: verificationEmailTemplate, schema: builtinSchema(TemplateActionCode)}
+			return s.generateEmailBody(compiled, "123456", goldenEmailData("en"), map[string]interface{}{"user_name": "Alice"})
+		}},
+		{"code_vi", func() (string, string, error) {
+			compiled := &compiledTemplate{tmpl: verificationEmailTemplate, schema: builtinSchema(TemplateActionCode)}
+			return s.generateEmailBody(compiled, "123456", goldenEmailData("vi"), nil)
+		}},
+		{"registration_en", func() (string, string, error) {
+			compiled := &compiledTemplate{tmpl: activationEmailTemplate, schema: builtinSchema("registration")}
+			values := map[string]interface{}{"user_name": "Alice", "plan_name": "Pro"}
+			return s.generateActivationEmailBody(compiled, activationURL, "registration", 30, ActivationDetails{}, goldenEmailData("en"), values)
+		}},
+		{"password_reset_en", func() (string, string, error) {
+			compiled := &compiledTemplate{tmpl: activationEmailTemplate, schema: builtinSchema("password_reset")}
+			values := map[string]interface{}{"temp_password": "Tmp#1234"}
+			return s.generateActivationEmailBody(compiled, activationURL, "password_reset", 30, ActivationDetails{}, goldenEmailData("en"), values)
+		}},
+		{"invitation_en", func() (string, string, error) {
+			compiled := &compiledTemplate{tmpl: activationEmailTemplate, schema: builtinSchema("invitation")}
+			details := ActivationDetails{Invitation: &models.Invitation{InviterName: "Bob", OrganizationID: "org-1", OrganizationName: "Acme", Role: "admin"}}
+			return s.generateActivationEmailBody(compiled, activationURL, "invitation", 10080, details, goldenEmailData("en"), nil)
+		}},
+		{"email_change_notice_en", func() (string, string, error) {
+			compiled := &compiledTemplate{tmpl: emailChangeNoticeTemplate, schema: builtinSchema("email_change_notice")}
+			details := ActivationDetails{OldEmail: "old@example.com", NewEmail: "new@example.com"}
+			return s.generateActivationEmailBody(compiled, activationURL, "email_change_notice", 60, details, goldenEmailData("en"), nil)
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _, err := tc.render()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", tc.name+".golden")
+			if *update {
+				if err := os.MkdirAll("testdata", 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal([]byte(body), want) {
+				t.Fatalf("rendered HTML differs from %s (run go test -update if the change is intended):\n%s", path, body)
+			}
+		})
+	}
+}
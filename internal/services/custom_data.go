@@ -0,0 +1,145 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"unicode/utf8"
+
+	"mrs_sendemail_be/internal/models"
+)
+
+var fieldNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validateSchema kiểm tra schema khai báo cho template
+func validateSchema(schema []models.TemplateField) error {
+	seen := make(map[string]bool)
+	for _, field := range schema {
+		if !fieldNamePattern.MatchString(field.Name) {
+			return fmt.Errorf("invalid field name %q", field.Name)
+		}
+		if seen[field.Name] {
+			return fmt.Errorf("duplicate field %q", field.Name)
+		}
+		seen[field.Name] = true
+
+		switch field.Type {
+		case models.FieldTypeString, models.FieldTypeNumber, models.FieldTypeBoolean:
+		default:
+			return fmt.Errorf("field %q has unsupported type %q", field.Name, field.Type)
+		}
+
+		if field.Pattern != "" {
+			if _, err := regexp.Compile(field.Pattern); err != nil {
+				return fmt.Errorf("field %q has invalid pattern: %v", field.Name, err)
+			}
+		}
+
+		if field.Sample != nil {
+			if _, err := convertField(field, field.Sample); err != nil {
+				return fmt.Errorf("field %q has invalid sample: %v", field.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateCustomData kiểm tra customData theo schema, trả về các giá trị hợp lệ đã được ép kiểu
+// và danh sách lỗi theo từng field. Key không được khai báo trong schema bị bỏ qua.
+func validateCustomData(schema []models.TemplateField, customData map[string]interface{}) (map[string]interface{}, []string) {
+	values := make(map[string]interface{})
+	var problems []string
+
+	for _, field := range schema {
+		raw, exists := customData[field.Name]
+		if !exists || raw == nil || raw == "" {
+			if field.Required {
+				problems = append(problems, fmt.Sprintf("%s: required", field.Name))
+			}
+			continue
+		}
+
+		value, err := convertField(field, raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", field.Name, err))
+			continue
+		}
+		values[field.Name] = value
+	}
+
+	for key := range customData {
+		if !schemaHasField(schema, key) {
+			log.Printf("Dropping customData key %q: not declared by template schema", key)
+		}
+	}
+
+	return values, problems
+}
+
+// convertField ép kiểu giá trị theo kiểu khai báo của field
+func convertField(field models.TemplateField, raw interface{}) (interface{}, error) {
+	switch field.Type {
+	case models.FieldTypeString:
+		value, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string")
+		}
+		if field.MaxLength > 0 && utf8.RuneCountInString(value) > field.MaxLength {
+			return nil, fmt.Errorf("longer than %d characters", field.MaxLength)
+		}
+		if field.Pattern != "" {
+			pattern, err := regexp.Compile(field.Pattern)
+			if err != nil || !pattern.MatchString(value) {
+				return nil, fmt.Errorf("invalid format")
+			}
+		}
+		return value, nil
+	case models.FieldTypeNumber:
+		switch v := raw.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+		return nil, fmt.Errorf("expected number")
+	case models.FieldTypeBoolean:
+		value, ok := raw.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected boolean")
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", field.Type)
+}
+
+func schemaHasField(schema []models.TemplateField, name string) bool {
+	for _, field := range schema {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleCustomData tạo customData mẫu từ schema (ưu tiên giá trị sample khai báo), dùng để render thử template
+func sampleCustomData(schema []models.TemplateField) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, field := range schema {
+		if sample, err := convertField(field, field.Sample); field.Sample != nil && err == nil {
+			values[field.Name] = sample
+			continue
+		}
+
+		switch field.Type {
+		case models.FieldTypeNumber:
+			values[field.Name] = float64(1)
+		case models.FieldTypeBoolean:
+			values[field.Name] = true
+		default:
+			values[field.Name] = "Sample"
+		}
+	}
+	return values
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"html/template"
+
+	"mrs_sendemail_be/internal/i18n"
+	"mrs_sendemail_be/internal/models"
+)
+
+// builtinSchemas khai báo các key customData mà template dựng sẵn của từng action sử dụng.
+// Các key không được khai báo sẽ không được render vào email.
+var builtinSchemas = map[string][]models.TemplateField{
+	TemplateActionCode: {
+		{Name: "user_name", Type: models.FieldTypeString, MaxLength: 100},
+	},
+	"registration": {
+		{Name: "user_name", Type: models.FieldTypeString, MaxLength: 100},
+		{Name: "plan_name", Type: models.FieldTypeString, MaxLength: 100},
+	},
+	"password_reset": {
+		{Name: "user_name", Type: models.FieldTypeString, MaxLength: 100},
+		// ASCII in được, không có khoảng trắng
+		{Name: "temp_password", Type: models.FieldTypeString, MaxLength: 64, Pattern: `^[\x21-\x7E]+$`},
+	},
+	"verification": {
+		{Name: "user_name", Type: models.FieldTypeString, MaxLength: 100},
+	},
+}
+
+// builtinSchema trả về schema của template dựng sẵn cho action,
+// action không có schema riêng dùng schema của "verification"
+func builtinSchema(action string) []models.TemplateField {
+	if schema, ok := builtinSchemas[action]; ok {
+		return schema
+	}
+	return builtinSchemas["verification"]
+}
+
+// actionTextKey trả về key catalog i18n của nội dung email theo action (title, message, button, subject),
+// action không có nội dung riêng trong catalog dùng nội dung của "verification"
+func actionTextKey(action, name string) string {
+	key := "email." + action + "." + name
+	if !i18n.Has(key) {
+		return "email.verification." + name
+	}
+	return key
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// emailData dữ liệu chung cho mọi email
+type emailData struct {
+	i18n.Localizer
+	System string
+	Title  string
+	Brand  models.BrandingProfile
+}
+
+// verificationEmailData dữ liệu render cho email mã xác thực
+type verificationEmailData struct {
+	emailData
+	Code          string
+	ExpireMinutes int
+	CustomData    map[string]interface{}
+}
+
+// activationEmailData dữ liệu render cho email kích hoạt
+type activationEmailData struct {
+	emailData
+	ActivationDetails
+	Message       string
+	ButtonText    string
+	ActivationURL string
+	ExpireMinutes int
+	CustomData    map[string]interface{}
+}
+
+// brandingPartials chứa header/footer dùng chung, áp dụng branding profile cho mọi email
+var brandingPartials = template.Must(template.New("branding").Parse(`
+{{define "brand_logo"}}
+            {{- if .Brand.LogoURL}}
+            <img src="{{.Brand.LogoURL}}" alt="{{.System}}" class="logo-image">
+            {{- else}}
+            <div class="logo">{{.System}}</div>
+            {{- end}}
+{{- end}}
+{{define "brand_footer"}}
+        <div class="footer">
+            <p>{{if .Brand.FooterText}}{{.Brand.FooterText}}{{else}}{{.T "email.footer.sent" .System}}{{end}}</p>
+            {{- with .Brand.SupportEmail}}
+            <p>{{$.T "email.footer.support"}} <a href="mailto:{{.}}">{{.}}</a></p>
+            {{- end}}
+            {{- if not .Brand.ReplyTo}}
+            <p>{{.T "email.footer.noreply"}}</p>
+            {{- end}}
+            {{- with .Brand.LegalAddress}}
+            <p class="legal">{{.}}</p>
+            {{- end}}
+        </div>
+{{- end}}
+`))
+
+// emailLayout là layout responsive dùng chung cho mọi email, nội dung riêng của từng email
+// được đặt trong template "content", đoạn xem trước (preheader) trong template "preheader".
+// CSS trong <style> được inline khi render (xem inlineCSS), chỉ các rule không inline được
+// (@media, :hover) được giữ lại.
+var emailLayout = template.Must(template.Must(brandingPartials.Clone()).New("email").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta http-equiv="X-UA-Compatible" content="IE=edge">
+    <title>{{.Title}}</title>
+    <style>
+        body {
+            margin: 0;
+            padding: 0;
+            background-color: #f4f4f4;
+            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
+            line-height: 1.6;
+            color: #333333;
+        }
+        table {
+            border-collapse: collapse;
+        }
+        .wrapper {
+            width: 100%;
+            background-color: #f4f4f4;
+        }
+        .container {
+            width: 600px;
+            max-width: 600px;
+            background-color: #ffffff;
+            border-radius: 10px;
+        }
+        .content {
+            padding: 30px;
+            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
+            font-size: 16px;
+            line-height: 1.6;
+            color: #333333;
+            text-align: left;
+        }
+        .header {
+            text-align: center;
+            margin-bottom: 30px;
+        }
+        .logo {
+            font-size: 24px;
+            font-weight: bold;
+            color: #2c3e50;
+            margin-bottom: 10px;
+        }
+        .logo-image {
+            max-height: 60px;
+            margin-bottom: 10px;
+            border: 0;
+        }
+        h2 {
+            margin: 0;
+            font-size: 22px;
+            color: #2c3e50;
+        }
+        .highlight {
+            color: {{.Brand.PrimaryColor}};
+            font-weight: bold;
+        }
+        .code-container {
+            background-color: #f8f9fa;
+            border: 2px solid #e9ecef;
+            border-radius: 8px;
+            padding: 20px;
+            text-align: center;
+            margin: 20px 0;
+        }
+        .verification-code {
+            font-size: 32px;
+            font-weight: bold;
+            color: {{.Brand.PrimaryColor}};
+            letter-spacing: 8px;
+            margin: 10px 0;
+        }
+        .button-container {
+            text-align: center;
+            margin: 30px 0;
+        }
+        .button {
+            display: inline-block;
+            background-color: {{.Brand.PrimaryColor}};
+            color: #ffffff;
+            padding: 15px 30px;
+            text-decoration: none;
+            border-radius: 8px;
+            font-weight: bold;
+            font-size: 16px;
+        }
+        .url-fallback {
+            background-color: #f8f9fa;
+            border: 1px solid #e9ecef;
+            border-radius: 5px;
+            padding: 15px;
+            margin: 20px 0;
+            word-break: break-all;
+            font-size: 14px;
+        }
+        .temp-password {
+            font-size: 18px;
+            color: {{.Brand.PrimaryColor}};
+            background-color: #f8f9fa;
+            padding: 8px 12px;
+            border-radius: 4px;
+            font-family: monospace;
+        }
+        .warning {
+            background-color: #fff3cd;
+            border: 1px solid #ffeaa7;
+            border-radius: 5px;
+            padding: 15px;
+            margin: 20px 0;
+            color: #856404;
+        }
+        .warning ul {
+            margin: 10px 0;
+            padding-left: 20px;
+        }
+        .footer {
+            margin-top: 30px;
+            padding-top: 20px;
+            border-top: 1px solid #eeeeee;
+            text-align: center;
+            color: #666666;
+            font-size: 14px;
+        }
+        .legal {
+            font-size: 12px;
+            color: #999999;
+        }
+        .preheader {
+            display: none;
+            max-height: 0;
+            overflow: hidden;
+            font-size: 1px;
+            line-height: 1px;
+            color: #f4f4f4;
+            opacity: 0;
+        }
+        .button:hover {
+            opacity: 0.9;
+        }
+        @media only screen and (max-width: 620px) {
+            .container {
+                width: 100% !important;
+                border-radius: 0 !important;
+            }
+            .content {
+                padding: 20px !important;
+            }
+            .verification-code {
+                font-size: 26px !important;
+                letter-spacing: 4px !important;
+            }
+            .button {
+                display: block !important;
+            }
+        }
+    </style>
+</head>
+<body>
+    <div class="preheader">{{template "preheader" .}}</div>
+    <table role="presentation" class="wrapper" width="100%" cellpadding="0" cellspacing="0" border="0">
+        <tr>
+            <td align="center" style="padding: 20px 0;">
+                <table role="presentation" class="container" width="600" cellpadding="0" cellspacing="0" border="0">
+                    <tr>
+                        <td class="content">
+                            <div class="header">
+                                {{- template "brand_logo" .}}
+                                <h2>{{.Title}}</h2>
+                            </div>
+                            {{template "content" .}}
+                            {{template "brand_footer" .}}
+                        </td>
+                    </tr>
+                </table>
+            </td>
+        </tr>
+    </table>
+</body>
+</html>
+{{- define "preheader"}}{{end -}}
+`))
+
+// newLayoutTemplate parse nội dung email vào layout dùng chung
+func newLayoutTemplate(content string) (*template.Template, error) {
+	layout, err := emailLayout.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := layout.New("content").Parse(content); err != nil {
+		return nil, err
+	}
+	return layout, nil
+}
+
+func mustLayoutTemplate(content string) *template.Template {
+	return template.Must(newLayoutTemplate(content))
+}
+
+var verificationEmailTemplate = mustLayoutTemplate(`
+        <p>{{with .CustomData.user_name}}{{$.T "email.greeting_name" .}}{{else}}{{.T "email.greeting"}}{{end}}</p>
+        <p>{{.T "email.code.intro" .System}}</p>
+
+        <div class="code-container">
+            <p><strong>{{.T "email.code.label"}}</strong></p>
+            <div class="verification-code">{{.Code}}</div>
+            <p><small class="highlight">{{.T "email.code.validity" .ExpireMinutes}}</small></p>
+        </div>
+
+        <div class="warning">
+            <strong>{{.T "email.security.title"}}</strong>
+            <ul>
+                <li>{{.T "email.code.share"}}</li>
+                <li>{{.T "email.code.once" .ExpireMinutes}}</li>
+                <li>{{.T "email.code.ignore"}}</li>
+            </ul>
+        </div>
+
+        <p>{{.T "email.code.support"}}</p>
+`)
+
+var activationEmailTemplate = mustLayoutTemplate(`
+        <p>{{with .CustomData.user_name}}{{$.T "email.greeting_name" .}}{{else}}{{.T "email.greeting"}}{{end}}</p>
+        {{- with .CustomData.temp_password}}
+        <p>{{$.T "email.password_reset.temp_intro"}} <strong class="temp-password">{{.}}</strong></p>
+        {{- end}}
+        {{- with .Invitation}}
+        <p>{{$.T "email.invitation.invited_by" .InviterName .OrganizationName .Role}}</p>
+        {{- end}}
+        <p>{{.Message}}</p>
+        {{- with .CustomData.plan_name}}
+        <p>{{$.T "email.registration.plan" .}}</p>
+        {{- end}}
+
+        <div class="button-container">
+            <a href="{{.ActivationURL}}" class="button">{{.ButtonText}}</a>
+        </div>
+
+        <p><strong>{{.T "email.link.expiry" .ExpireMinutes}}</strong></p>
+
+        <p>{{.T "email.link.fallback"}}</p>
+        <div class="url-fallback">
+            {{.ActivationURL}}
+        </div>
+
+        <div class="warning">
+            <strong>{{.T "email.security.title"}}</strong>
+            <ul>
+                <li>{{.T "email.link.once" .ExpireMinutes}}</li>
+                <li>{{.T "email.link.share"}}</li>
+                <li>{{.T "email.link.ignore"}}</li>
+            </ul>
+        </div>
+
+        <p>{{.T "email.support"}}</p>
+`)
+
+// emailChangeNoticeTemplate là email thông báo gửi tới địa chỉ hiện tại khi có yêu cầu đổi email,
+// nút trong email là link hủy yêu cầu
+var emailChangeNoticeTemplate = mustLayoutTemplate(`
+        <p>{{with .CustomData.user_name}}{{$.T "email.greeting_name" .}}{{else}}{{.T "email.greeting"}}{{end}}</p>
+        <p>{{.Message}}</p>
+        <p><strong>{{.NewEmail}}</strong></p>
+        <p>{{.T "email.email_change_notice.revoke"}}</p>
+
+        <div class="button-container">
+            <a href="{{.ActivationURL}}" class="button">{{.ButtonText}}</a>
+        </div>
+
+        <p><strong>{{.T "email.email_change_notice.expiry" .ExpireMinutes}}</strong></p>
+
+        <p>{{.T "email.link.fallback"}}</p>
+        <div class="url-fallback">
+            {{.ActivationURL}}
+        </div>
+
+        <p>{{.T "email.support"}}</p>
+`)
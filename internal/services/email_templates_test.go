@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mrs_sendemail_be/internal/config"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var injectionPayloads = []string{
+	`<script>alert(1)</script>`,
+	`"><a href=javascript:alert(1)>x</a>`,
+	"Evil\r\nBcc: victim@example.com",
+}
+
+// newInjectionSMTPService tạo SMTPService có branding profile (from_name) chứa payload cho system payload
+func newInjectionSMTPService(t *testing.T, payload string) *SMTPService {
+	t.Helper()
+	profiles, err := json.Marshal(map[string]interface{}{
+		payload: map[string]string{"from_name": payload},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "branding.json")
+	if err := os.WriteFile(path, profiles, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.SMTP.Username = "noreply@example.com"
+	cfg.SMTP.FromName = "Fix4Home System"
+	cfg.Branding.PrimaryColor = "#007bff"
+	cfg.Branding.ProfilesFile = path
+	return NewSMTPService(cfg, NewBrandingService(cfg, nil), nil, nil)
+}
+
+// assertSafeHTML kiểm tra HTML đã render không chứa thẻ <script>, link javascript: hay payload nguyên văn
+func assertSafeHTML(t *testing.T, name, body, payload string) {
+	t.Helper()
+	if strings.Contains(payload, "<") && strings.Contains(body, payload) {
+		t.Fatalf("%s: payload rendered unescaped", name)
+	}
+
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom == atom.Script {
+			t.Fatalf("%s: <script> element in output", name)
+		}
+		for _, attr := range n.Attr {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(attr.Val)), "javascript:") {
+				t.Fatalf("%s: javascript: URL in %s attribute of <%s>", name, attr.Key, n.Data)
+			}
+		}
+	})
+}
+
+func TestEmailRenderingEscapesInjectedValues(t *testing.T) {
+	ctx := context.Background()
+	for _, payload := range injectionPayloads {
+		t.Run(payload, func(t *testing.T) {
+			s := newInjectionSMTPService(t, payload)
+			base := s.newEmailData(ctx, payload, "en")
+			if strings.ContainsAny(base.Brand.FromName, "\r\n") {
+				t.Fatalf("branding from_name keeps CRLF: %q", base.Brand.FromName)
+			}
+
+			customData := map[string]interface{}{
+				"user_name":  payload,
+				"plan_name":  payload,
+				"undeclared": payload,
+			}
+
+			compiled := s.resolveTemplate(ctx, base.System, "registration", base.Locale)
+			values, _ := validateCustomData(compiled.schema, customData)
+			if _, exists := values["undeclared"]; exists {
+				t.Fatal("customData key outside the schema was kept")
+			}
+			body, _, err := s.generateActivationEmailBody(compiled, "javascript:alert(1)", "registration", 30, ActivationDetails{}, base, values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertSafeHTML(t, "activation email", body, payload)
+
+			codeTemplate := s.resolveTemplate(ctx, base.System, TemplateActionCode, base.Locale)
+			codeValues, _ := validateCustomData(codeTemplate.schema, customData)
+			body, _, err = s.generateEmailBody(codeTemplate, "123456", base, codeValues)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertSafeHTML(t, "verification email", body, payload)
+
+			subject, err := s.generateSubject(compiled, "registration", "registration", "{{.System}} {{.CustomData.user_name}}", base, values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.ContainsAny(subject, "\r\n") {
+				t.Fatalf("subject keeps CRLF: %q", subject)
+			}
+
+			var raw bytes.Buffer
+			if _, err := s.newMessage("user@example.com", subject, base.Brand).WriteTo(&raw); err != nil {
+				t.Fatal(err)
+			}
+			headers, _, _ := strings.Cut(raw.String(), "\r\n\r\n")
+			for _, line := range strings.Split(headers, "\r\n") {
+				if strings.HasPrefix(strings.ToLower(line), "bcc:") {
+					t.Fatalf("injected header in message:\n%s", headers)
+				}
+			}
+		})
+	}
+}
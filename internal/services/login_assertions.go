@@ -0,0 +1,76 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/utils"
+)
+
+var ErrAssertionsDisabled = errors.New("login assertions are not configured")
+
+// LoginAssertionService ký login assertion (JWT HS256) trả về khi xác thực magic link thành công.
+// Auth service kiểm tra chữ ký bằng khóa dùng chung LOGIN_ASSERTION_SECRET.
+type LoginAssertionService struct {
+	config *config.Config
+}
+
+func NewLoginAssertionService(cfg *config.Config) *LoginAssertionService {
+	return &LoginAssertionService{config: cfg}
+}
+
+// Enabled kiểm tra khóa ký assertion đã được cấu hình hay chưa
+func (s *LoginAssertionService) Enabled() bool {
+	return s != nil && s.config.Login.AssertionSecret != ""
+}
+
+// Sign tạo login assertion cho token đã xác thực, trả về assertion và thời điểm hết hạn
+func (s *LoginAssertionService) Sign(token *models.ActivationToken) (string, int64, error) {
+	if !s.Enabled() {
+		return "", 0, ErrAssertionsDisabled
+	}
+
+	jti, err := utils.GenerateActivationToken()
+	if err != nil {
+		return "", 0, err
+	}
+
+	ttl := s.config.Login.AssertionTTL
+	if ttl <= 0 {
+		ttl = 300
+	}
+	now := time.Now().Unix()
+	claims := models.LoginAssertionClaims{
+		Issuer:       s.config.Login.Issuer,
+		Subject:      token.Email,
+		Audience:     token.System,
+		IssuedAt:     now,
+		ExpiresAt:    now + int64(ttl),
+		ID:           jti,
+		Action:       token.Action,
+		AuthMethods:  []string{"email_link"},
+		BrowserBound: token.NonceHash != "",
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", 0, err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to marshal login assertion: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(s.config.Login.AssertionSecret))
+	mac.Write([]byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), claims.ExpiresAt, nil
+}
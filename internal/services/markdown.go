@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/yuin/goldmark"
+)
+
+var (
+	templateActionPattern = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+	actionPlaceholder     = regexp.MustCompile(`zzmdtpl(\d+)zz`)
+
+	mdImagePattern    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLinkPattern     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	mdHeadingPattern  = regexp.MustCompile(`(?m)^#{1,6}\s+`)
+	mdQuotePattern    = regexp.MustCompile(`(?m)^>\s?`)
+	mdBulletPattern   = regexp.MustCompile(`(?m)^(\s*)[*+]\s+`)
+	mdStrongPattern   = regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`)
+	mdEmPattern       = regexp.MustCompile(`(^|[^\w*])[*_]([^*_\n]+)[*_]`)
+	mdCodePattern     = regexp.MustCompile("`([^`]*)`")
+	mdRulePattern     = regexp.MustCompile(`(?m)^\s*([-*_]\s*){3,}$`)
+	mdBlankRunPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// markdownFrontMatter là phần khai báo đầu file Markdown, giữa hai dòng "---"
+type markdownFrontMatter struct {
+	Subject     string // Template tiêu đề
+	Preheader   string // Đoạn xem trước hiển thị trong hộp thư
+	ButtonLabel string // Nhãn nút, ví dụ {{.ButtonText}}
+	ButtonURL   string // Link của nút, ví dụ {{.ActivationURL}}
+}
+
+// markdownTextFooter là footer của phần text/plain
+const markdownTextFooter = `{{if .Brand.FooterText}}{{.Brand.FooterText}}{{else}}{{.T "email.footer.sent" .System}}{{end}}`
+
+// compileMarkdown biên dịch template Markdown thành phần HTML (đặt trong layout dùng chung)
+// và phần text/plain. Các action {{...}} được giữ nguyên qua bước chuyển Markdown nên giá trị
+// vẫn được html/template escape theo ngữ cảnh khi render.
+func compileMarkdown(source string) (*compiledTemplate, error) {
+	frontMatter, body, err := parseFrontMatter(source)
+	if err != nil {
+		return nil, err
+	}
+
+	protected, actions := protectActions(body)
+
+	var rendered bytes.Buffer
+	if err := goldmark.Convert([]byte(protected), &rendered); err != nil {
+		return nil, fmt.Errorf("failed to convert markdown: %w", err)
+	}
+
+	content := restoreActions(rendered.String(), actions)
+	text := restoreActions(markdownToText(protected), actions)
+	if frontMatter.ButtonLabel != "" && frontMatter.ButtonURL != "" {
+		content += fmt.Sprintf("\n<div class=\"button-container\"><a href=\"%s\" class=\"button\">%s</a></div>\n",
+			escapeOutsideActions(frontMatter.ButtonURL), escapeOutsideActions(frontMatter.ButtonLabel))
+		text += fmt.Sprintf("\n\n%s: %s", frontMatter.ButtonLabel, frontMatter.ButtonURL)
+	}
+
+	compiled := &compiledTemplate{}
+	if compiled.tmpl, err = newLayoutTemplate(content); err != nil {
+		return nil, err
+	}
+	if frontMatter.Preheader != "" {
+		if _, err := compiled.tmpl.Parse(`{{define "preheader"}}` + escapeOutsideActions(frontMatter.Preheader) + `{{end}}`); err != nil {
+			return nil, fmt.Errorf("invalid preheader: %w", err)
+		}
+	}
+
+	if compiled.text, err = texttemplate.New("text").Parse(strings.TrimSpace(text) + "\n\n-- \n" + markdownTextFooter + "\n"); err != nil {
+		return nil, err
+	}
+
+	if frontMatter.Subject != "" {
+		if compiled.subject, err = parseSubjectTemplate(frontMatter.Subject); err != nil {
+			return nil, err
+		}
+	}
+
+	return compiled, nil
+}
+
+// renderText render phần text/plain của email, trả về rỗng nếu template không có phần text
+func renderText(tmpl *texttemplate.Template, data interface{}) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// parseFrontMatter tách front-matter dạng "key: value" khỏi nội dung Markdown
+func parseFrontMatter(source string) (markdownFrontMatter, string, error) {
+	var frontMatter markdownFrontMatter
+
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	if !strings.HasPrefix(source, "---\n") {
+		return frontMatter, source, nil
+	}
+
+	end := strings.Index(source[4:], "\n---")
+	if end < 0 {
+		return frontMatter, "", fmt.Errorf("front-matter is not closed with ---")
+	}
+	header := source[4 : 4+end]
+	body := strings.TrimPrefix(source[4+end+4:], "\n")
+
+	for i, line := range strings.Split(header, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			return frontMatter, "", fmt.Errorf("front-matter line %d: expected key: value", i+1)
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:colon]))
+		value := unquote(strings.TrimSpace(line[colon+1:]))
+
+		switch key {
+		case "subject":
+			frontMatter.Subject = value
+		case "preheader":
+			frontMatter.Preheader = value
+		case "button_label":
+			frontMatter.ButtonLabel = value
+		case "button_url":
+			frontMatter.ButtonURL = value
+		default:
+			return frontMatter, "", fmt.Errorf("front-matter line %d: unknown key %q (allowed: subject, preheader, button_label, button_url)", i+1, key)
+		}
+	}
+
+	return frontMatter, body, nil
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// protectActions thay các action {{...}} bằng placeholder chỉ gồm chữ và số để không bị
+// bộ chuyển Markdown thay đổi
+func protectActions(text string) (string, []string) {
+	var actions []string
+	protected := templateActionPattern.ReplaceAllStringFunc(text, func(action string) string {
+		actions = append(actions, action)
+		return fmt.Sprintf("zzmdtpl%dzz", len(actions)-1)
+	})
+	return protected, actions
+}
+
+func restoreActions(text string, actions []string) string {
+	return actionPlaceholder.ReplaceAllStringFunc(text, func(placeholder string) string {
+		idx, err := strconv.Atoi(actionPlaceholder.FindStringSubmatch(placeholder)[1])
+		if err != nil || idx >= len(actions) {
+			return placeholder
+		}
+		return actions[idx]
+	})
+}
+
+// escapeOutsideActions escape HTML cho phần chữ, giữ nguyên các action {{...}}
+func escapeOutsideActions(text string) string {
+	protected, actions := protectActions(text)
+	return restoreActions(template.HTMLEscapeString(protected), actions)
+}
+
+// markdownToText chuyển Markdown thành text thuần cho phần text/plain của email
+func markdownToText(markdown string) string {
+	text := strings.ReplaceAll(markdown, "\r\n", "\n")
+	text = mdRulePattern.ReplaceAllString(text, "")
+	text = mdImagePattern.ReplaceAllString(text, "$1")
+	text = mdLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		parts := mdLinkPattern.FindStringSubmatch(link)
+		if parts[1] == parts[2] {
+			return parts[2]
+		}
+		return fmt.Sprintf("%s (%s)", parts[1], parts[2])
+	})
+	text = mdHeadingPattern.ReplaceAllString(text, "")
+	text = mdQuotePattern.ReplaceAllString(text, "")
+	text = mdBulletPattern.ReplaceAllString(text, "$1- ")
+	text = mdStrongPattern.ReplaceAllString(text, "$2")
+	text = mdEmPattern.ReplaceAllString(text, "$1$2")
+	text = mdCodePattern.ReplaceAllString(text, "$1")
+	text = mdBlankRunPattern.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
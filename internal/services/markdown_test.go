@@ -0,0 +1,206 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// renderMarkdownContent biên dịch template Markdown và render phần nội dung HTML, preheader và text/plain
+func renderMarkdownContent(t *testing.T, source string, data map[string]interface{}) (content, preheader, text string) {
+	t.Helper()
+	compiled, err := compileMarkdown(source)
+	if err != nil {
+		t.Fatalf("compileMarkdown: %v", err)
+	}
+
+	data["Brand"] = map[string]string{"FooterText": "Footer"}
+	var buf bytes.Buffer
+	if err := compiled.tmpl.ExecuteTemplate(&buf, "content", data); err != nil {
+		t.Fatal(err)
+	}
+	content = buf.String()
+
+	buf.Reset()
+	if compiled.tmpl.Lookup("preheader") != nil {
+		if err := compiled.tmpl.ExecuteTemplate(&buf, "preheader", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	preheader = buf.String()
+
+	if text, err = renderText(compiled.text, data); err != nil {
+		t.Fatal(err)
+	}
+	return content, preheader, text
+}
+
+func TestProtectActions(t *testing.T) {
+	source := "[Open]({{.URL}}) *{{.Name}}* `{{.Code}}`"
+	protected, actions := protectActions(source)
+
+	if strings.ContainsAny(protected, "{}") {
+		t.Fatalf("protected text keeps template delimiters: %q", protected)
+	}
+	if want := []string{"{{.URL}}", "{{.Name}}", "{{.Code}}"}; strings.Join(actions, "|") != strings.Join(want, "|") {
+		t.Fatalf("actions = %q, want %q", actions, want)
+	}
+	if restored := restoreActions(protected, actions); restored != source {
+		t.Fatalf("restoreActions = %q, want %q", restored, source)
+	}
+}
+
+func TestCompileMarkdownKeepsActions(t *testing.T) {
+	data := map[string]interface{}{
+		"URL":  "https://example.com/activate?token=a&b=1",
+		"Name": "<b>Bob</b>",
+		"Code": "12 34",
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		wantHTML string
+		wantText string
+	}{
+		{
+			name:     "link URL",
+			source:   "[Activate]({{.URL}})",
+			wantHTML: `<a href="https://example.com/activate?token=a&amp;b=1">Activate</a>`,
+			wantText: "Activate (https://example.com/activate?token=a&b=1)",
+		},
+		{
+			name:     "link label",
+			source:   "[Hi {{.Name}}](https://example.com)",
+			wantHTML: `<a href="https://example.com">Hi &lt;b&gt;Bob&lt;/b&gt;</a>`,
+			wantText: "Hi <b>Bob</b> (https://example.com)",
+		},
+		{
+			name:     "emphasis",
+			source:   "*Hello {{.Name}}*",
+			wantHTML: `<em>Hello &lt;b&gt;Bob&lt;/b&gt;</em>`,
+			wantText: "Hello <b>Bob</b>",
+		},
+		{
+			name:     "strong",
+			source:   "**{{.Name}}**",
+			wantHTML: `<strong>&lt;b&gt;Bob&lt;/b&gt;</strong>`,
+			wantText: "<b>Bob</b>",
+		},
+		{
+			name:     "code span",
+			source:   "Code: `{{.Code}}`",
+			wantHTML: `<code>12 34</code>`,
+			wantText: "Code: 12 34",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _, text := renderMarkdownContent(t, tt.source, data)
+			if !strings.Contains(content, tt.wantHTML) {
+				t.Fatalf("HTML = %q, want it to contain %q", content, tt.wantHTML)
+			}
+			if !strings.HasPrefix(text, tt.wantText+"\n") {
+				t.Fatalf("text = %q, want it to start with %q", text, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestCompileMarkdownEscapesFrontMatter(t *testing.T) {
+	source := "---\n" +
+		"preheader: \"Tom & Jerry <3 {{.Name}}\"\n" +
+		"button_label: Open <now> & {{.Name}}\n" +
+		"button_url: \"{{.URL}}\"\n" +
+		"---\n" +
+		"Body"
+	data := map[string]interface{}{"Name": "<i>Bob</i>", "URL": "javascript:alert(1)"}
+
+	content, preheader, text := renderMarkdownContent(t, source, data)
+
+	if want := "Tom &amp; Jerry &lt;3 &lt;i&gt;Bob&lt;/i&gt;"; preheader != want {
+		t.Fatalf("preheader = %q, want %q", preheader, want)
+	}
+	if want := `class="button">Open &lt;now&gt; &amp; &lt;i&gt;Bob&lt;/i&gt;</a>`; !strings.Contains(content, want) {
+		t.Fatalf("button = %q, want it to contain %q", content, want)
+	}
+	if strings.Contains(content, "javascript:") {
+		t.Fatalf("button URL keeps javascript: scheme: %q", content)
+	}
+	if want := "Open <now> & <i>Bob</i>: javascript:alert(1)"; !strings.Contains(text, want) {
+		t.Fatalf("text = %q, want it to contain %q", text, want)
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    markdownFrontMatter
+		body    string
+		wantErr string
+	}{
+		{name: "none", source: "# Hello", body: "# Hello"},
+		{
+			name:   "all keys",
+			source: "---\nsubject: \"Welcome {{.System}}\"\n# comment\n\npreheader: 'Hi'\nButton_Label: {{.ButtonText}}\nbutton_url: {{.ActivationURL}}\n---\nBody",
+			want:   markdownFrontMatter{Subject: "Welcome {{.System}}", Preheader: "Hi", ButtonLabel: "{{.ButtonText}}", ButtonURL: "{{.ActivationURL}}"},
+			body:   "Body",
+		},
+		{name: "CRLF", source: "---\r\nsubject: Hi\r\n---\r\nBody", want: markdownFrontMatter{Subject: "Hi"}, body: "Body"},
+		{name: "value with colon", source: "---\nsubject: Note: read\n---\n", want: markdownFrontMatter{Subject: "Note: read"}},
+		{name: "unclosed", source: "---\nsubject: Hi\nBody", wantErr: "not closed"},
+		{name: "unknown key", source: "---\nsubject: Hi\nfrom: x\n---\nBody", wantErr: `line 2: unknown key "from"`},
+		{name: "missing colon", source: "---\nsubject Hi\n---\nBody", wantErr: "line 1: expected key: value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frontMatter, body, err := parseFrontMatter(tt.source)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				if _, err := compileMarkdown(tt.source); err == nil {
+					t.Fatal("compileMarkdown accepted invalid front-matter")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frontMatter != tt.want || body != tt.body {
+				t.Fatalf("parseFrontMatter = %+v, %q, want %+v, %q", frontMatter, body, tt.want, tt.body)
+			}
+		})
+	}
+}
+
+func TestMarkdownToText(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{name: "link", markdown: "See [the docs](https://example.com/docs \"Docs\").", want: "See the docs (https://example.com/docs)."},
+		{name: "autolink style", markdown: "[https://example.com](https://example.com)", want: "https://example.com"},
+		{name: "image", markdown: "![Logo](https://example.com/logo.png)", want: "Logo"},
+		{name: "headings", markdown: "# Title\n\n### Section\nText", want: "Title\n\nSection\nText"},
+		{name: "bullet list", markdown: "* one\n+ two\n  * nested\n- three", want: "- one\n- two\n  - nested\n- three"},
+		{name: "ordered list", markdown: "1. first\n2. second", want: "1. first\n2. second"},
+		{name: "emphasis", markdown: "**bold** and *italic* and _under_", want: "bold and italic and under"},
+		{name: "snake_case kept", markdown: "use user_name here", want: "use user_name here"},
+		{name: "code", markdown: "Run `make test`", want: "Run make test"},
+		{name: "quote and rule", markdown: "> quoted\n\n---\n\nafter", want: "quoted\n\nafter"},
+		{name: "blank lines", markdown: "a\n\n\n\nb\r\n", want: "a\n\nb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownToText(tt.markdown); got != tt.want {
+				t.Fatalf("markdownToText(%q) = %q, want %q", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}
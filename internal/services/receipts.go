@@ -0,0 +1,106 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/utils"
+)
+
+var ErrReceiptsDisabled = errors.New("verification receipts are not configured")
+
+// ReceiptSigner ký receipt (JWT EdDSA) trả về khi /verify hoặc /verify-activation thành công, giúp service
+// phía sau tin kết quả xác thực mà không cần gọi lại API. Public key được công bố tại /.well-known/jwks.json,
+// khóa cũ giữ lại trong RECEIPT_SIGNING_KEYS để receipt đã phát hành vẫn kiểm tra được sau khi đổi khóa.
+type ReceiptSigner struct {
+	config     *config.Config
+	keyID      string
+	signingKey ed25519.PrivateKey
+	publicKeys map[string]ed25519.PublicKey
+}
+
+func NewReceiptSigner(cfg *config.Config) (*ReceiptSigner, error) {
+	signingKey, publicKeys, err := loadSigningKeys(cfg.Receipts.SigningKeys, cfg.Receipts.SigningKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("RECEIPT_SIGNING_KEYS: %w", err)
+	}
+	if cfg.Receipts.SigningKeyID != "" && signingKey == nil {
+		return nil, fmt.Errorf("RECEIPT_SIGNING_KEY_ID %q is not declared in RECEIPT_SIGNING_KEYS", cfg.Receipts.SigningKeyID)
+	}
+
+	return &ReceiptSigner{
+		config:     cfg,
+		keyID:      cfg.Receipts.SigningKeyID,
+		signingKey: signingKey,
+		publicKeys: publicKeys,
+	}, nil
+}
+
+// Enabled kiểm tra khóa ký receipt đã được cấu hình hay chưa
+func (s *ReceiptSigner) Enabled() bool {
+	return s != nil && s.signingKey != nil
+}
+
+// Sign ký receipt cho kết quả xác thực, điền iss/aud/iat/exp/jti/verified_at.
+// Trả về receipt và thời điểm hết hạn.
+func (s *ReceiptSigner) Sign(claims models.VerificationReceiptClaims) (string, int64, error) {
+	if !s.Enabled() {
+		return "", 0, ErrReceiptsDisabled
+	}
+
+	jti, err := utils.GenerateActivationToken()
+	if err != nil {
+		return "", 0, err
+	}
+
+	ttl := s.config.Receipts.TTL
+	if ttl <= 0 {
+		ttl = 300
+	}
+	now := time.Now().Unix()
+	claims.Issuer = s.config.Receipts.Issuer
+	claims.Audience = s.config.Receipts.Audience
+	claims.Subject = claims.Email
+	claims.IssuedAt = now
+	claims.ExpiresAt = now + int64(ttl)
+	claims.ID = jti
+	claims.VerifiedAt = now
+
+	receipt, err := signJWS(s.signingKey, s.keyID, receiptTokenType, claims)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to sign verification receipt: %w", err)
+	}
+	return receipt, claims.ExpiresAt, nil
+}
+
+// JWKS trả về public key của mọi khóa ký receipt (kể cả khóa cũ), sắp xếp theo kid
+func (s *ReceiptSigner) JWKS() models.JWKS {
+	jwks := models.JWKS{Keys: []models.JWK{}}
+	if s == nil {
+		return jwks
+	}
+
+	kids := make([]string, 0, len(s.publicKeys))
+	for kid := range s.publicKeys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		jwks.Keys = append(jwks.Keys, models.JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(s.publicKeys[kid]),
+			Kid: kid,
+			Alg: "EdDSA",
+			Use: "sig",
+		})
+	}
+	return jwks
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+)
+
+func newTestReceiptSigner(t *testing.T, keyID string) *ReceiptSigner {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Receipts.Issuer = "mrs_sendemail_be"
+	cfg.Receipts.Audience = "user-service"
+	cfg.Receipts.TTL = 300
+	cfg.Receipts.SigningKeyID = keyID
+	cfg.Receipts.SigningKeys = testSigningKeys(map[string]byte{"r1": 1, "r2": 2})
+
+	signer, err := NewReceiptSigner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// verifyWithJWKS kiểm tra receipt như service phía sau: chọn khóa trong JWKS theo kid, kiểm tra alg, typ và chữ ký
+func verifyWithJWKS(t *testing.T, jwks models.JWKS, receipt string) (*models.VerificationReceiptClaims, bool) {
+	t.Helper()
+	parts := strings.Split(receipt, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	var header signedTokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "EdDSA" || header.Typ != receiptTokenType {
+		return nil, false
+	}
+
+	for _, key := range jwks.Keys {
+		if key.Kid != header.Kid {
+			continue
+		}
+		publicKey, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil || !ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signature) {
+			return nil, false
+		}
+		var claims models.VerificationReceiptClaims
+		if err := decodeSegment(parts[1], &claims); err != nil {
+			return nil, false
+		}
+		return &claims, true
+	}
+	return nil, false
+}
+
+func TestReceiptSignVerifiesWithJWKS(t *testing.T) {
+	signer := newTestReceiptSigner(t, "r2")
+	receipt, expiresAt, err := signer.Sign(models.VerificationReceiptClaims{
+		Email:  "user@example.com",
+		System: "Fix4Home",
+		Action: models.ReceiptActionCode,
+		Tenant: "default",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, ok := verifyWithJWKS(t, signer.JWKS(), receipt)
+	if !ok {
+		t.Fatal("receipt does not verify with the published JWKS")
+	}
+	if claims.Subject != "user@example.com" || claims.Issuer != "mrs_sendemail_be" || claims.Audience != "user-service" ||
+		claims.ID == "" || claims.ExpiresAt != expiresAt || claims.ExpiresAt-claims.IssuedAt != 300 {
+		t.Fatalf("claims = %+v", claims)
+	}
+
+	// Receipt bị sửa payload hoặc kid không còn kiểm tra được
+	forged := resignSegments(t, receipt, nil, func(_, p map[string]interface{}) { p["sub"] = "attacker@example.com" })
+	if _, ok := verifyWithJWKS(t, signer.JWKS(), forged); ok {
+		t.Fatal("tampered receipt verifies")
+	}
+	if _, ok := verifyWithJWKS(t, signer.JWKS(), resignSegments(t, receipt, nil, func(h, _ map[string]interface{}) { h["kid"] = "r9" })); ok {
+		t.Fatal("receipt with unknown kid verifies")
+	}
+}
+
+func TestReceiptRotatedKeyStaysInJWKS(t *testing.T) {
+	// Receipt phát hành bằng r1 trước khi đổi khóa ký sang r2
+	receipt, _, err := newTestReceiptSigner(t, "r1").Sign(models.VerificationReceiptClaims{Email: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := newTestReceiptSigner(t, "r2").JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "r1" || jwks.Keys[1].Kid != "r2" {
+		t.Fatalf("JWKS keys = %+v, want r1 and r2 sorted by kid", jwks.Keys)
+	}
+	for _, key := range jwks.Keys {
+		if key.Kty != "OKP" || key.Crv != "Ed25519" || key.Alg != "EdDSA" || key.Use != "sig" {
+			t.Fatalf("JWK %s = %+v", key.Kid, key)
+		}
+		if x, err := base64.RawURLEncoding.DecodeString(key.X); err != nil || len(x) != ed25519.PublicKeySize {
+			t.Fatalf("JWK %s x = %q", key.Kid, key.X)
+		}
+	}
+	if _, ok := verifyWithJWKS(t, jwks, receipt); !ok {
+		t.Fatal("receipt signed with the previous key does not verify after rotation")
+	}
+}
+
+func TestReceiptIsNotAnActivationToken(t *testing.T) {
+	// Cùng seed cho cả hai loại (cấu hình bị config.Load từ chối): typ vẫn ngăn receipt được nhận là activation token
+	cfg := &config.Config{}
+	cfg.Tokens.Mode = config.TokenModeSigned
+	cfg.Tokens.Issuer = "mrs_sendemail_be"
+	cfg.Tokens.SigningKeyID = "k1"
+	cfg.Tokens.SigningKeys = testSigningKeys(map[string]byte{"k1": 1})
+	cfg.Receipts = config.ReceiptConfig{Issuer: "mrs_sendemail_be", SigningKeyID: "k1", SigningKeys: cfg.Tokens.SigningKeys}
+
+	activation, err := NewActivationTokenSigner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts, err := NewReceiptSigner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, _, err := receipts.Sign(models.VerificationReceiptClaims{Email: "user@example.com", Action: "registration", ID: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := activation.Parse(receipt); !errors.Is(err, ErrInvalidSignedToken) || !strings.Contains(err.Error(), receiptTokenType) {
+		t.Fatalf("Parse(receipt) = %v, want unexpected type error", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -14,6 +16,7 @@ import (
 type RedisService struct {
 	client *redis.Client
 	config *config.Config
+	hasher *SecretHasher // Băm mã xác thực và token trước khi lưu
 }
 
 func NewRedisService(cfg *config.Config) *RedisService {
@@ -32,6 +35,7 @@ func NewRedisService(cfg *config.Config) *RedisService {
 	return &RedisService{
 		client: rdb,
 		config: cfg,
+		hasher: NewSecretHasher(cfg.Security.HashSecrets),
 	}
 }
 
@@ -45,12 +49,14 @@ func (r *RedisService) Close() error {
 	return r.client.Close()
 }
 
-// StoreVerificationCode lưu mã xác thực vào Redis
-func (r *RedisService) StoreVerificationCode(ctx context.Context, email, code, system string) error {
+// StoreVerificationCode lưu bản băm của mã xác thực vào Redis. Mỗi scope (tenant, system, purpose)
+// giữ một mã riêng, mã mới chỉ thay mã cũ cùng scope.
+func (r *RedisService) StoreVerificationCode(ctx context.Context, scope models.CodeScope, email, code string) error {
 	verificationCode := models.VerificationCode{
-		Code:      code,
+		CodeHash:  r.hasher.Hash(hashPurposeCode, codeHashInput(scope, email, code)),
 		Email:     email,
-		System:    system,
+		System:    scope.System,
+		Purpose:   scope.Purpose,
 		CreatedAt: time.Now().Unix(),
 	}
 
@@ -59,15 +65,21 @@ func (r *RedisService) StoreVerificationCode(ctx context.Context, email, code, s
 		return fmt.Errorf("failed to marshal verification code: %w", err)
 	}
 
-	key := fmt.Sprintf("verify:%s", email)
+	key := verificationCodeKey(scope, email)
 	expiration := time.Duration(r.config.Code.ExpireMinutes) * time.Minute
 
-	return r.client.Set(ctx, key, data, expiration).Err()
+	// Mã mới có lượt nhập riêng
+	pipe := r.client.Pipeline()
+	pipe.Set(ctx, key, data, expiration)
+	pipe.Del(ctx, verificationAttemptsKey(scope, email))
+
+	_, err = pipe.Exec(ctx)
+	return err
 }
 
-// GetVerificationCode lấy mã xác thực từ Redis
-func (r *RedisService) GetVerificationCode(ctx context.Context, email string) (*models.VerificationCode, error) {
-	key := fmt.Sprintf("verify:%s", email)
+// GetVerificationCode lấy mã xác thực của scope từ Redis
+func (r *RedisService) GetVerificationCode(ctx context.Context, scope models.CodeScope, email string) (*models.VerificationCode, error) {
+	key := verificationCodeKey(scope, email)
 	
 	data, err := r.client.Get(ctx, key).Result()
 	if err != nil {
@@ -85,10 +97,108 @@ func (r *RedisService) GetVerificationCode(ctx context.Context, email string) (*
 	return &verificationCode, nil
 }
 
-// DeleteVerificationCode xóa mã xác thực từ Redis
-func (r *RedisService) DeleteVerificationCode(ctx context.Context, email string) error {
-	key := fmt.Sprintf("verify:%s", email)
-	return r.client.Del(ctx, key).Err()
+// MatchVerificationCode so sánh mã người dùng nhập với mã đã lưu theo thời gian không đổi
+func (r *RedisService) MatchVerificationCode(scope models.CodeScope, stored *models.VerificationCode, code string) bool {
+	return r.hasher.Match(hashPurposeCode, codeHashInput(scope, stored.Email, code), stored.CodeHash)
+}
+
+// codeHashInput gắn mã với scope và email để cùng một mã ở hai nơi có hash khác nhau
+func codeHashInput(scope models.CodeScope, email, code string) string {
+	return strings.Join([]string{scope.Tenant, scope.System, scope.Purpose, email, code}, "\x00")
+}
+
+// DeleteVerificationCode xóa mã xác thực và số lần nhập của mã từ Redis
+func (r *RedisService) DeleteVerificationCode(ctx context.Context, scope models.CodeScope, email string) error {
+	return r.client.Del(ctx, verificationCodeKey(scope, email), verificationAttemptsKey(scope, email)).Err()
+}
+
+// ConsumeVerificationCode xóa mã xác thực nếu mã trong Redis vẫn là mã stored đã so khớp.
+// Kiểm tra và xóa nằm trong cùng transaction (WATCH): khi nhiều request đúng mã đến cùng lúc,
+// chỉ request xóa được key nhận true, các request còn lại nhận false như mã không tồn tại.
+func (r *RedisService) ConsumeVerificationCode(ctx context.Context, scope models.CodeScope, email string, stored *models.VerificationCode) (bool, error) {
+	key := verificationCodeKey(scope, email)
+	consumed := false
+
+	consume := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get verification code: %w", err)
+		}
+
+		var current models.VerificationCode
+		if err := json.Unmarshal([]byte(data), &current); err != nil {
+			return fmt.Errorf("failed to unmarshal verification code: %w", err)
+		}
+		// Mã đã được thay bằng mã mới sau khi so khớp
+		if current.CodeHash != stored.CodeHash {
+			return nil
+		}
+
+		var deleted *redis.IntCmd
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			deleted = pipe.Del(ctx, key)
+			pipe.Del(ctx, verificationAttemptsKey(scope, email))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		consumed = deleted.Val() == 1
+		return nil
+	}
+
+	// Transaction bị hủy nghĩa là request khác đã xóa hoặc thay mã
+	if err := r.client.Watch(ctx, consume, key); err != nil && err != redis.TxFailedErr {
+		return false, fmt.Errorf("failed to consume verification code: %w", err)
+	}
+	return consumed, nil
+}
+
+// RecordVerificationAttempt tăng và trả về số lần nhập mã hiện tại của email trong scope.
+// Bộ đếm được lưu cạnh mã xác thực và hết hạn cùng mã.
+func (r *RedisService) RecordVerificationAttempt(ctx context.Context, scope models.CodeScope, email string) (int64, error) {
+	key := verificationAttemptsKey(scope, email)
+
+	pipe := r.client.TxPipeline()
+	attempts := pipe.Incr(ctx, key)
+	ttl := pipe.TTL(ctx, verificationCodeKey(scope, email))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to record verification attempt: %w", err)
+	}
+
+	expiration := ttl.Val()
+	if expiration <= 0 {
+		expiration = time.Minute
+	}
+	if err := r.client.Expire(ctx, key, expiration).Err(); err != nil {
+		return 0, fmt.Errorf("failed to record verification attempt: %w", err)
+	}
+	return attempts.Val(), nil
+}
+
+func verificationCodeKey(scope models.CodeScope, email string) string {
+	return fmt.Sprintf("verify:%s:%s:%s:%s", scope.Tenant, scope.System, scope.Purpose, email)
+}
+
+func verificationAttemptsKey(scope models.CodeScope, email string) string {
+	return fmt.Sprintf("verify:attempts:%s:%s:%s:%s", scope.Tenant, scope.System, scope.Purpose, email)
+}
+
+// IncrementVerifyRateLimit tăng và trả về số lần gọi /verify trong giờ theo kind ("ip", "email") và giá trị
+func (r *RedisService) IncrementVerifyRateLimit(ctx context.Context, kind, value string) (int64, error) {
+	key := fmt.Sprintf("verifylimit:%s:%s", kind, value)
+
+	pipe := r.client.Pipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, time.Hour)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to increment verify rate limit: %w", err)
+	}
+	return count.Val(), nil
 }
 
 // CheckEmailRateLimit kiểm tra rate limit theo email
@@ -161,37 +271,100 @@ func (r *RedisService) GetIPRateLimitCount(ctx context.Context, ip string) (int,
 	return count, err
 }
 
+// IncrementChannelRateLimit tăng và trả về số lần gửi mã trong giờ tới người nhận của kênh (số điện thoại, chat ID).
+// Gọi trước khi gửi để các request song song không vượt quá giới hạn.
+func (r *RedisService) IncrementChannelRateLimit(ctx context.Context, channel, recipient string) (int64, error) {
+	key := channelRateLimitKey(channel, recipient)
+
+	pipe := r.client.Pipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, time.Hour)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to increment channel rate limit: %w", err)
+	}
+	return count.Val(), nil
+}
+
+func channelRateLimitKey(channel, recipient string) string {
+	return fmt.Sprintf("genlimit:channel:%s:%s", channel, recipient)
+}
+
 // ===== ACTIVATION TOKEN METHODS =====
+// Token và link hủy chỉ được lưu dưới dạng hash: key, tham chiếu theo email, danh sách lời mời
+// và đánh dấu đã dùng/đã hủy đều dùng TokenHash, token gốc chỉ có trong email đã gửi.
 
 // StoreActivationToken lưu activation token vào Redis
 func (r *RedisService) StoreActivationToken(ctx context.Context, token *models.ActivationToken) error {
+	token.TokenHash = r.hasher.Hash(hashPurposeActivation, token.Token)
+	if token.RevokeKey != "" {
+		token.RevokeHash = r.hasher.Hash(hashPurposeRevoke, token.RevokeKey)
+	}
+
 	data, err := json.Marshal(token)
 	if err != nil {
 		return fmt.Errorf("failed to marshal activation token: %w", err)
 	}
 
-	// Store by token for verification
-	tokenKey := fmt.Sprintf("activation:token:%s", token.Token)
+	// Store by token hash for verification
+	tokenKey := activationTokenKey(token.TokenHash)
 	
 	// Store by email+action for resend logic
-	emailKey := fmt.Sprintf("activation:email:%s:%s", token.Email, token.Action)
+	emailKey := tokenEmailKey(token)
 	
-	// 30 minutes expiration
-	expiration := 30 * time.Minute
+	// Hết hạn theo ExpiresAt của token (TTL cấu hình theo action)
+	expiration := time.Until(time.Unix(token.ExpiresAt, 0))
+	if expiration <= 0 {
+		return fmt.Errorf("token has expired")
+	}
 
 	pipe := r.client.Pipeline()
 	pipe.Set(ctx, tokenKey, data, expiration)
-	pipe.Set(ctx, emailKey, token.Token, expiration) // Store token reference
+	pipe.Set(ctx, emailKey, token.TokenHash, expiration) // Store token reference
+	if token.RevokeHash != "" {
+		// Link hủy yêu cầu đổi email trỏ tới token
+		pipe.Set(ctx, fmt.Sprintf("activation:revoke:%s", token.RevokeHash), token.TokenHash, expiration)
+	}
+	if token.Invitation != nil {
+		// Danh sách lời mời của tổ chức, score = thời điểm hết hạn
+		orgKey := invitationOrgKey(token.Tenant, token.Invitation.OrganizationID)
+		pipe.ZAdd(ctx, orgKey, &redis.Z{Score: float64(token.ExpiresAt), Member: token.TokenHash})
+		pipe.Expire(ctx, orgKey, expiration)
+	}
 	
 	_, err = pipe.Exec(ctx)
 	return err
 }
 
-// GetActivationToken lấy activation token từ Redis bằng token
+// GetActivationToken lấy activation token từ Redis bằng token (tra theo hash với mọi khóa băm)
 func (r *RedisService) GetActivationToken(ctx context.Context, token string) (*models.ActivationToken, error) {
-	key := fmt.Sprintf("activation:token:%s", token)
-	
-	data, err := r.client.Get(ctx, key).Result()
+	hashes := r.hasher.Candidates(hashPurposeActivation, token)
+	keys := make([]string, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = activationTokenKey(hash)
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get activation token: %w", err)
+	}
+	for _, value := range values {
+		if data, ok := value.(string); ok {
+			activationToken, err := unmarshalActivationToken(data)
+			if err != nil {
+				return nil, err
+			}
+			activationToken.Token = token
+			return activationToken, nil
+		}
+	}
+
+	return nil, fmt.Errorf("activation token not found or expired")
+}
+
+// getActivationTokenByHash lấy activation token từ tham chiếu đã lưu (hash của token)
+func (r *RedisService) getActivationTokenByHash(ctx context.Context, tokenHash string) (*models.ActivationToken, error) {
+	data, err := r.client.Get(ctx, activationTokenKey(tokenHash)).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, fmt.Errorf("activation token not found or expired")
@@ -199,17 +372,13 @@ func (r *RedisService) GetActivationToken(ctx context.Context, token string) (*m
 		return nil, fmt.Errorf("failed to get activation token: %w", err)
 	}
 
-	var activationToken models.ActivationToken
-	if err := json.Unmarshal([]byte(data), &activationToken); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal activation token: %w", err)
-	}
-
-	return &activationToken, nil
+	return unmarshalActivationToken(data)
 }
 
-// GetActivationTokenByEmail lấy activation token từ Redis bằng email và action
-func (r *RedisService) GetActivationTokenByEmail(ctx context.Context, email, action string) (*models.ActivationToken, error) {
-	emailKey := fmt.Sprintf("activation:email:%s:%s", email, action)
+// GetActivationTokenByEmail lấy activation token từ Redis bằng email và action,
+// scope là tổ chức của lời mời (rỗng với action khác). Token gốc không có trong kết quả.
+func (r *RedisService) GetActivationTokenByEmail(ctx context.Context, email, action, scope string) (*models.ActivationToken, error) {
+	emailKey := activationEmailKey(email, action, scope)
 	
 	// Get token reference
 	tokenRef, err := r.client.Get(ctx, emailKey).Result()
@@ -221,48 +390,281 @@ func (r *RedisService) GetActivationTokenByEmail(ctx context.Context, email, act
 	}
 
 	// Get actual token data
-	return r.GetActivationToken(ctx, tokenRef)
+	return r.getActivationTokenByHash(ctx, tokenRef)
 }
 
-// UpdateActivationToken cập nhật activation token (cho resend logic)
-func (r *RedisService) UpdateActivationToken(ctx context.Context, token *models.ActivationToken) error {
-	data, err := json.Marshal(token)
-	if err != nil {
-		return fmt.Errorf("failed to marshal activation token: %w", err)
-	}
+// ReissueActivationToken thay token của yêu cầu đang chờ bằng newToken khi gửi lại email
+// (token gốc không được lưu nên không gửi lại được link cũ). Link đã gửi trước đó hết hiệu lực,
+// thời điểm hết hạn và các thông tin khác của yêu cầu được giữ nguyên.
+func (r *RedisService) ReissueActivationToken(ctx context.Context, token *models.ActivationToken, newToken, newTokenID string) error {
+	oldKey := activationTokenKey(token.TokenHash)
+	oldHash := token.TokenHash
+	oldTokenID := token.TokenID
 
-	tokenKey := fmt.Sprintf("activation:token:%s", token.Token)
-	
-	// Calculate remaining TTL
-	ttl, err := r.client.TTL(ctx, tokenKey).Result()
+	ttl, err := r.client.TTL(ctx, oldKey).Result()
 	if err != nil {
 		return fmt.Errorf("failed to get TTL: %w", err)
 	}
-	
 	if ttl <= 0 {
 		return fmt.Errorf("token has expired")
 	}
 
-	// Update with remaining TTL
-	return r.client.Set(ctx, tokenKey, data, ttl).Err()
+	token.Token = newToken
+	token.TokenID = newTokenID
+	token.TokenHash = r.hasher.Hash(hashPurposeActivation, newToken)
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal activation token: %w", err)
+	}
+
+	pipe := r.client.TxPipeline()
+	deleted := pipe.Del(ctx, oldKey)
+	pipe.Set(ctx, activationTokenKey(token.TokenHash), data, ttl)
+	pipe.Set(ctx, tokenEmailKey(token), token.TokenHash, ttl)
+	if token.RevokeHash != "" {
+		pipe.Set(ctx, fmt.Sprintf("activation:revoke:%s", token.RevokeHash), token.TokenHash, ttl)
+	}
+	if token.Invitation != nil {
+		orgKey := invitationOrgKey(token.Tenant, token.Invitation.OrganizationID)
+		pipe.ZRem(ctx, orgKey, oldHash)
+		pipe.ZAdd(ctx, orgKey, &redis.Z{Score: float64(token.ExpiresAt), Member: token.TokenHash})
+	}
+	if oldTokenID != "" {
+		// Token đã ký vẫn hợp lệ về chữ ký, chặn bằng denylist
+		pipe.Set(ctx, tokenDenylistKey(oldTokenID), TokenDenialReplaced, denylistTTL(token))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to reissue activation token: %w", err)
+	}
+	if deleted.Val() == 0 {
+		// Token cũ đã được xác thực hoặc hủy trong lúc gửi lại, bỏ token mới
+		_ = r.DeleteActivationToken(ctx, token)
+		return fmt.Errorf("token was used or revoked")
+	}
+
+	return nil
 }
 
 // DeleteActivationToken xóa activation token từ Redis
 func (r *RedisService) DeleteActivationToken(ctx context.Context, token *models.ActivationToken) error {
-	tokenKey := fmt.Sprintf("activation:token:%s", token.Token)
-	emailKey := fmt.Sprintf("activation:email:%s:%s", token.Email, token.Action)
+	tokenKey := activationTokenKey(token.TokenHash)
+	emailKey := tokenEmailKey(token)
 	
 	pipe := r.client.Pipeline()
 	pipe.Del(ctx, tokenKey)
 	pipe.Del(ctx, emailKey)
+	if token.RevokeHash != "" {
+		pipe.Del(ctx, fmt.Sprintf("activation:revoke:%s", token.RevokeHash))
+	}
+	if token.Invitation != nil {
+		pipe.ZRem(ctx, invitationOrgKey(token.Tenant, token.Invitation.OrganizationID), token.TokenHash)
+	}
+	if token.TokenID != "" {
+		pipe.Set(ctx, tokenDenylistKey(token.TokenID), TokenDenialReplaced, denylistTTL(token))
+	}
 	
 	_, err := pipe.Exec(ctx)
 	return err
 }
 
+// ConsumeActivationToken xóa activation token đã xác thực và đánh dấu đã sử dụng tới khi hết hạn.
+// Trả về false nếu token đã bị request khác sử dụng trước (chỉ một request xóa được token).
+// Token đã ký được đánh dấu trong denylist theo jti, TokenHash rỗng khi không còn bản ghi trong Redis.
+func (r *RedisService) ConsumeActivationToken(ctx context.Context, token *models.ActivationToken) (bool, error) {
+	if token.TokenHash == "" && token.TokenID == "" {
+		return false, fmt.Errorf("failed to consume activation token: token has neither hash nor token ID")
+	}
+	ttl := denylistTTL(token)
+
+	pipe := r.client.TxPipeline()
+	var deleted *redis.IntCmd
+	if token.TokenHash != "" {
+		deleted = pipe.Del(ctx, activationTokenKey(token.TokenHash))
+		pipe.Del(ctx, tokenEmailKey(token))
+		if token.RevokeHash != "" {
+			pipe.Del(ctx, fmt.Sprintf("activation:revoke:%s", token.RevokeHash))
+		}
+		if token.Invitation != nil {
+			pipe.ZRem(ctx, invitationOrgKey(token.Tenant, token.Invitation.OrganizationID), token.TokenHash)
+		}
+	}
+	pipe.Del(ctx, activationSessionKey(token))
+	var denied *redis.BoolCmd
+	if token.TokenID != "" {
+		denied = pipe.SetNX(ctx, tokenDenylistKey(token.TokenID), TokenDenialUsed, ttl)
+	} else {
+		pipe.Set(ctx, fmt.Sprintf("activation:used:%s", token.TokenHash), time.Now().Unix(), ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("failed to consume activation token: %w", err)
+	}
+
+	if denied != nil {
+		return denied.Val(), nil
+	}
+	return deleted.Val() == 1, nil
+}
+
+// IsActivationTokenUsed kiểm tra token đã được sử dụng (và chưa tới thời điểm hết hạn ban đầu) hay chưa
+func (r *RedisService) IsActivationTokenUsed(ctx context.Context, token string) (bool, error) {
+	return r.activationMarkerExists(ctx, "activation:used:%s", token)
+}
+
+// GetActivationTokenByRevokeKey lấy activation token từ token của link hủy yêu cầu
+func (r *RedisService) GetActivationTokenByRevokeKey(ctx context.Context, revokeKey string) (*models.ActivationToken, error) {
+	hashes := r.hasher.Candidates(hashPurposeRevoke, revokeKey)
+	keys := make([]string, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = fmt.Sprintf("activation:revoke:%s", hash)
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token reference: %w", err)
+	}
+	for _, value := range values {
+		if tokenRef, ok := value.(string); ok {
+			return r.getActivationTokenByHash(ctx, tokenRef)
+		}
+	}
+
+	return nil, fmt.Errorf("revoke token not found or expired")
+}
+
+// RevokeActivationToken xóa activation token bị hủy và đánh dấu đã hủy tới khi hết hạn.
+// Trả về false nếu token đã được xác thực hoặc hủy trước đó.
+func (r *RedisService) RevokeActivationToken(ctx context.Context, token *models.ActivationToken) (bool, error) {
+	tokenKey := activationTokenKey(token.TokenHash)
+	emailKey := tokenEmailKey(token)
+	revokedKey := fmt.Sprintf("activation:revoked:%s", token.TokenHash)
+
+	ttl := time.Until(time.Unix(token.ExpiresAt, 0))
+	if ttl < time.Minute {
+		ttl = time.Minute
+	}
+
+	pipe := r.client.TxPipeline()
+	deleted := pipe.Del(ctx, tokenKey)
+	pipe.Del(ctx, emailKey)
+	if token.RevokeHash != "" {
+		pipe.Del(ctx, fmt.Sprintf("activation:revoke:%s", token.RevokeHash))
+	}
+	if token.Invitation != nil {
+		pipe.ZRem(ctx, invitationOrgKey(token.Tenant, token.Invitation.OrganizationID), token.TokenHash)
+	}
+	pipe.Set(ctx, revokedKey, time.Now().Unix(), ttl)
+	if token.TokenID != "" {
+		pipe.Set(ctx, tokenDenylistKey(token.TokenID), TokenDenialRevoked, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("failed to revoke activation token: %w", err)
+	}
+
+	return deleted.Val() == 1, nil
+}
+
+// IsActivationTokenRevoked kiểm tra token đã bị hủy (và chưa tới thời điểm hết hạn ban đầu) hay chưa
+func (r *RedisService) IsActivationTokenRevoked(ctx context.Context, token string) (bool, error) {
+	return r.activationMarkerExists(ctx, "activation:revoked:%s", token)
+}
+
+// GetActivationTokenDenial trả về lý do token đã ký bị chặn (TokenDenialUsed, ...), rỗng nếu token không nằm trong denylist
+func (r *RedisService) GetActivationTokenDenial(ctx context.Context, tokenID string) (string, error) {
+	reason, err := r.client.Get(ctx, tokenDenylistKey(tokenID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return reason, err
+}
+
+// StoreActivationSession lưu hash của session handle cấp cho token bởi /activation/validate, thay handle cấp trước đó.
+// Bản ghi được giữ tới khi token hết hạn để handle đã hết hạn vẫn bị từ chối thay vì bỏ yêu cầu handle.
+func (r *RedisService) StoreActivationSession(ctx context.Context, token *models.ActivationToken, handle string, expiresAt int64) error {
+	value := fmt.Sprintf("%d:%s", expiresAt, r.hasher.Hash(hashPurposeSession, handle))
+	return r.client.Set(ctx, activationSessionKey(token), value, denylistTTL(token)).Err()
+}
+
+// MatchActivationSession kiểm tra session handle của token. Trả về true nếu token chưa được cấp handle
+// hoặc handle khớp với handle đã cấp và chưa hết hạn.
+func (r *RedisService) MatchActivationSession(ctx context.Context, token *models.ActivationToken, handle string) (bool, error) {
+	value, err := r.client.Get(ctx, activationSessionKey(token)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to get activation session: %w", err)
+	}
+
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return false, fmt.Errorf("malformed activation session")
+	}
+	expiresAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("malformed activation session: %w", err)
+	}
+	if time.Now().Unix() > expiresAt {
+		return false, nil
+	}
+	return handle != "" && r.hasher.Match(hashPurposeSession, handle, parts[1]), nil
+}
+
+// activationMarkerExists kiểm tra đánh dấu (đã dùng/đã hủy) của token theo hash với mọi khóa băm
+func (r *RedisService) activationMarkerExists(ctx context.Context, pattern, token string) (bool, error) {
+	hashes := r.hasher.Candidates(hashPurposeActivation, token)
+	keys := make([]string, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = fmt.Sprintf(pattern, hash)
+	}
+
+	count, err := r.client.Exists(ctx, keys...).Result()
+	return count > 0, err
+}
+
+// ListInvitations trả về các lời mời chưa hết hạn của tổ chức thuộc tenant, lời mời đã hết hạn được xóa khỏi danh sách
+func (r *RedisService) ListInvitations(ctx context.Context, tenant, organizationID string) ([]models.ActivationToken, error) {
+	orgKey := invitationOrgKey(tenant, organizationID)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	if err := r.client.ZRemRangeByScore(ctx, orgKey, "-inf", "("+now).Err(); err != nil {
+		return nil, fmt.Errorf("failed to prune invitations: %w", err)
+	}
+	tokens, err := r.client.ZRangeByScore(ctx, orgKey, &redis.ZRangeBy{Min: now, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(tokens))
+	for i, tokenHash := range tokens {
+		keys[i] = activationTokenKey(tokenHash)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitations: %w", err)
+	}
+
+	invitations := make([]models.ActivationToken, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue // Token đã bị xóa
+		}
+		token, err := unmarshalActivationToken(data)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *token)
+	}
+	return invitations, nil
+}
+
 // CheckActivationResendLimit kiểm tra xem có thể gửi lại activation email không
-func (r *RedisService) CheckActivationResendLimit(ctx context.Context, email, action string) (bool, int64, error) {
-	token, err := r.GetActivationTokenByEmail(ctx, email, action)
+// theo số lần gửi tối đa và khoảng cách giữa hai lần gửi (giây) của action, scope như GetActivationTokenByEmail
+func (r *RedisService) CheckActivationResendLimit(ctx context.Context, email, action, scope string, maxSends int, interval int64) (bool, int64, error) {
+	token, err := r.GetActivationTokenByEmail(ctx, email, action, scope)
 	if err != nil {
 		// No existing token, can send
 		return true, 0, nil
@@ -270,16 +672,486 @@ func (r *RedisService) CheckActivationResendLimit(ctx context.Context, email, ac
 
 	now := time.Now().Unix()
 	
-	// Check if max sends reached (3 times)
-	if token.SendCount >= 3 {
+	// Check if max sends reached
+	if token.SendCount >= maxSends {
 		return false, 0, fmt.Errorf("maximum resend limit reached")
 	}
 	
-	// Check if 60 seconds have passed since last send
-	if now-token.LastSentAt < 60 {
-		nextAllowedTime := token.LastSentAt + 60
-		return false, nextAllowedTime, fmt.Errorf("must wait 60 seconds between resends")
+	// Check if interval has passed since last send
+	if now-token.LastSentAt < interval {
+		nextAllowedTime := token.LastSentAt + interval
+		return false, nextAllowedTime, fmt.Errorf("must wait %d seconds between resends", interval)
 	}
 	
 	return true, 0, nil
-} 
\ No newline at end of file
+} 
+// activationEmailKey trả về key tham chiếu token theo email và action,
+// lời mời được phân biệt theo tổ chức để một email nhận được lời mời từ nhiều tổ chức
+func activationEmailKey(email, action, scope string) string {
+	if scope == "" {
+		return fmt.Sprintf("activation:email:%s:%s", email, action)
+	}
+	return fmt.Sprintf("activation:email:%s:%s:%s", email, action, scope)
+}
+
+func activationTokenKey(tokenHash string) string {
+	return fmt.Sprintf("activation:token:%s", tokenHash)
+}
+
+// tokenDenylistKey trả về key denylist của token đã ký theo jti
+func tokenDenylistKey(tokenID string) string {
+	return fmt.Sprintf("activation:denylist:%s", tokenID)
+}
+
+// denylistTTL giữ đánh dấu tới thời điểm hết hạn của token (tối thiểu một phút)
+func denylistTTL(token *models.ActivationToken) time.Duration {
+	ttl := time.Until(time.Unix(token.ExpiresAt, 0))
+	if ttl < time.Minute {
+		ttl = time.Minute
+	}
+	return ttl
+}
+
+// activationSessionKey trả về key session handle của token, theo jti với token đã ký
+func activationSessionKey(token *models.ActivationToken) string {
+	if token.TokenID != "" {
+		return fmt.Sprintf("activation:session:%s", token.TokenID)
+	}
+	return fmt.Sprintf("activation:session:%s", token.TokenHash)
+}
+
+func unmarshalActivationToken(data string) (*models.ActivationToken, error) {
+	var token models.ActivationToken
+	if err := json.Unmarshal([]byte(data), &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal activation token: %w", err)
+	}
+	return &token, nil
+}
+
+func tokenEmailKey(token *models.ActivationToken) string {
+	if token.Invitation != nil {
+		return activationEmailKey(token.Email, token.Action, InvitationScope(token.Tenant, token.Invitation.OrganizationID))
+	}
+	return activationEmailKey(token.Email, token.Action, "")
+}
+
+// InvitationScope trả về scope của lời mời khi tìm token theo email: tổ chức nằm trong tenant của API key,
+// hai tenant dùng cùng organizationId không thấy lời mời của nhau
+func InvitationScope(tenant, organizationID string) string {
+	return tenant + ":" + organizationID
+}
+
+func invitationOrgKey(tenant, organizationID string) string {
+	return fmt.Sprintf("activation:org:%s:%s", tenant, organizationID)
+}
+
+// ===== BRANDING METHODS =====
+
+// GetBrandingProfile lấy branding profile của system từ Redis, trả về nil nếu chưa được cấu hình
+func (r *RedisService) GetBrandingProfile(ctx context.Context, system string) (*models.BrandingProfile, error) {
+	key := fmt.Sprintf("branding:%s", system)
+
+	data, err := r.client.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get branding profile: %w", err)
+	}
+
+	var profile models.BrandingProfile
+	if err := json.Unmarshal([]byte(data), &profile); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal branding profile: %w", err)
+	}
+
+	return &profile, nil
+}
+
+// ===== TEMPLATE METHODS =====
+
+// templateChannel là kênh pub/sub thông báo template thay đổi
+const templateChannel = "template:invalidate"
+
+// maxTemplateWriteAttempts là số lần thử lại khi version của template bị ghi đồng thời
+const maxTemplateWriteAttempts = 3
+
+// StoreTemplateVersion lưu một version mới của template và đặt làm version đang dùng.
+// mustExist = true khi cập nhật (template phải đang có version đang dùng), false khi tạo mới
+// (template chưa tồn tại). Kiểm tra và ghi nằm trong cùng transaction (WATCH) nên hai request
+// tạo cùng template đồng thời chỉ có một request thành công.
+func (r *RedisService) StoreTemplateVersion(ctx context.Context, id string, tmpl *models.EmailTemplate, mustExist bool) error {
+	activeKey := fmt.Sprintf("template:active:%s", id)
+	seqKey := fmt.Sprintf("template:seq:%s", id)
+
+	store := func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, activeKey).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get active template version: %w", err)
+		}
+		if mustExist && exists == 0 {
+			return ErrTemplateNotFound
+		}
+		if !mustExist && exists != 0 {
+			return ErrTemplateExists
+		}
+
+		seq, err := tx.Get(ctx, seqKey).Int()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("failed to allocate template version: %w", err)
+		}
+		tmpl.Version = seq + 1
+
+		data, err := json.Marshal(tmpl)
+		if err != nil {
+			return fmt.Errorf("failed to marshal template: %w", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, seqKey, tmpl.Version, 0)
+			pipe.HSet(ctx, fmt.Sprintf("template:versions:%s", id), tmpl.Version, data)
+			pipe.Set(ctx, activeKey, tmpl.Version, 0)
+			pipe.SAdd(ctx, "template:index", id)
+			return nil
+		})
+		return err
+	}
+
+	// Transaction bị hủy khi request khác ghi template cùng lúc: thử lại với trạng thái mới
+	for attempt := 0; attempt < maxTemplateWriteAttempts; attempt++ {
+		err := r.client.Watch(ctx, store, activeKey, seqKey)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("template %s is being modified concurrently", id)
+}
+
+// GetTemplateVersion lấy một version cụ thể của template
+func (r *RedisService) GetTemplateVersion(ctx context.Context, id string, version int) (*models.EmailTemplate, error) {
+	data, err := r.client.HGet(ctx, fmt.Sprintf("template:versions:%s", id), fmt.Sprint(version)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("template version not found")
+		}
+		return nil, fmt.Errorf("failed to get template version: %w", err)
+	}
+
+	var tmpl models.EmailTemplate
+	if err := json.Unmarshal([]byte(data), &tmpl); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal template: %w", err)
+	}
+
+	return &tmpl, nil
+}
+
+// GetTemplateVersions lấy toàn bộ lịch sử version của template
+func (r *RedisService) GetTemplateVersions(ctx context.Context, id string) ([]models.EmailTemplate, error) {
+	data, err := r.client.HGetAll(ctx, fmt.Sprintf("template:versions:%s", id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template versions: %w", err)
+	}
+
+	versions := make([]models.EmailTemplate, 0, len(data))
+	for _, raw := range data {
+		var tmpl models.EmailTemplate
+		if err := json.Unmarshal([]byte(raw), &tmpl); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal template: %w", err)
+		}
+		versions = append(versions, tmpl)
+	}
+
+	return versions, nil
+}
+
+// GetActiveTemplateVersion lấy số version đang dùng của template, trả về 0 nếu chưa có
+func (r *RedisService) GetActiveTemplateVersion(ctx context.Context, id string) (int, error) {
+	version, err := r.client.Get(ctx, fmt.Sprintf("template:active:%s", id)).Int()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get active template version: %w", err)
+	}
+	return version, nil
+}
+
+// SetActiveTemplateVersion đặt version đang dùng của template
+func (r *RedisService) SetActiveTemplateVersion(ctx context.Context, id string, version int) error {
+	return r.client.Set(ctx, fmt.Sprintf("template:active:%s", id), version, 0).Err()
+}
+
+// ListTemplateIDs lấy danh sách id của các template được quản lý
+func (r *RedisService) ListTemplateIDs(ctx context.Context) ([]string, error) {
+	return r.client.SMembers(ctx, "template:index").Result()
+}
+
+// PublishTemplateChange thông báo cho các instance khác rằng template đã thay đổi
+func (r *RedisService) PublishTemplateChange(ctx context.Context, id string) error {
+	return r.client.Publish(ctx, templateChannel, id).Err()
+}
+
+// SubscribeTemplateChanges đăng ký nhận thông báo template thay đổi
+func (r *RedisService) SubscribeTemplateChanges(ctx context.Context) <-chan *redis.Message {
+	return r.client.Subscribe(ctx, templateChannel).Channel()
+}
+
+// ===== A/B TEST METHODS =====
+
+// IncrementVariantStat tăng bộ đếm (issued, sent, converted) của variant A/B theo system/action
+func (r *RedisService) IncrementVariantStat(ctx context.Context, system, action, variant, counter string) error {
+	key := fmt.Sprintf("abtest:%s:%s", system, action)
+	return r.client.HIncrBy(ctx, key, fmt.Sprintf("%s:%s", variant, counter), 1).Err()
+}
+
+// GetVariantStats lấy bộ đếm của mọi variant theo system/action, dạng variant -> counter -> giá trị
+func (r *RedisService) GetVariantStats(ctx context.Context, system, action string) (map[string]map[string]int64, error) {
+	key := fmt.Sprintf("abtest:%s:%s", system, action)
+	data, err := r.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]map[string]int64)
+	for field, value := range data {
+		idx := strings.LastIndex(field, ":")
+		if idx < 0 {
+			continue
+		}
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		variant, counter := field[:idx], field[idx+1:]
+		if stats[variant] == nil {
+			stats[variant] = make(map[string]int64)
+		}
+		stats[variant][counter] = count
+	}
+	return stats, nil
+}
+
+// ===== TRACKING METHODS =====
+
+// maxTrackingEvents là số sự kiện tối đa được lưu cho mỗi message
+const maxTrackingEvents = 100
+
+// StoreTrackedMessage lưu thông tin email được theo dõi
+func (r *RedisService) StoreTrackedMessage(ctx context.Context, message *models.TrackedMessage, ttl time.Duration) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tracked message: %w", err)
+	}
+	return r.client.Set(ctx, fmt.Sprintf("track:msg:%s", message.MessageID), data, ttl).Err()
+}
+
+// GetTrackedMessage lấy thông tin email được theo dõi theo message ID
+func (r *RedisService) GetTrackedMessage(ctx context.Context, messageID string) (*models.TrackedMessage, error) {
+	data, err := r.client.Get(ctx, fmt.Sprintf("track:msg:%s", messageID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("tracked message not found or expired")
+		}
+		return nil, fmt.Errorf("failed to get tracked message: %w", err)
+	}
+
+	var message models.TrackedMessage
+	if err := json.Unmarshal([]byte(data), &message); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tracked message: %w", err)
+	}
+	return &message, nil
+}
+
+// StoreTrackedTarget lưu link kích hoạt đã mã hóa của message, hết hạn cùng activation token
+func (r *RedisService) StoreTrackedTarget(ctx context.Context, messageID, target string, ttl time.Duration) error {
+	return r.client.Set(ctx, fmt.Sprintf("track:url:%s", messageID), target, ttl).Err()
+}
+
+// GetTrackedTarget lấy link kích hoạt đã mã hóa của message, trả về chuỗi rỗng nếu đã hết hạn
+func (r *RedisService) GetTrackedTarget(ctx context.Context, messageID string) (string, error) {
+	target, err := r.client.Get(ctx, fmt.Sprintf("track:url:%s", messageID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get tracked target: %w", err)
+	}
+	return target, nil
+}
+
+// AddTrackingEvent ghi sự kiện cho message, chỉ giữ lại maxTrackingEvents sự kiện gần nhất
+func (r *RedisService) AddTrackingEvent(ctx context.Context, messageID string, event models.TrackingEvent, ttl time.Duration) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tracking event: %w", err)
+	}
+
+	key := fmt.Sprintf("track:events:%s", messageID)
+	pipe := r.client.TxPipeline()
+	pipe.RPush(ctx, key, data)
+	pipe.LTrim(ctx, key, -maxTrackingEvents, -1)
+	pipe.Expire(ctx, key, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetTrackingEvents lấy các sự kiện của message theo thứ tự thời gian
+func (r *RedisService) GetTrackingEvents(ctx context.Context, messageID string) ([]models.TrackingEvent, error) {
+	data, err := r.client.LRange(ctx, fmt.Sprintf("track:events:%s", messageID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracking events: %w", err)
+	}
+
+	events := make([]models.TrackingEvent, 0, len(data))
+	for _, item := range data {
+		var event models.TrackingEvent
+		if err := json.Unmarshal([]byte(item), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// ===== TOTP METHODS =====
+// Secret chỉ được lưu dưới dạng đã mã hóa (SecretCipher), recovery code chỉ được lưu dưới dạng hash.
+
+// StorePendingTOTPEnrollment lưu đăng ký TOTP chưa xác nhận, thay đăng ký đang chờ trước đó
+func (r *RedisService) StorePendingTOTPEnrollment(ctx context.Context, scope models.CodeScope, enrollment *models.TOTPEnrollment, ttl time.Duration) error {
+	data, err := json.Marshal(enrollment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal TOTP enrollment: %w", err)
+	}
+	return r.client.Set(ctx, totpPendingKey(scope, enrollment.Email), data, ttl).Err()
+}
+
+// GetPendingTOTPEnrollment lấy đăng ký TOTP đang chờ xác nhận, trả về nil nếu không có hoặc đã hết hạn
+func (r *RedisService) GetPendingTOTPEnrollment(ctx context.Context, scope models.CodeScope, email string) (*models.TOTPEnrollment, error) {
+	return r.getTOTPEnrollment(ctx, totpPendingKey(scope, email))
+}
+
+// GetTOTPEnrollment lấy đăng ký TOTP đã xác nhận, trả về nil nếu email chưa đăng ký
+func (r *RedisService) GetTOTPEnrollment(ctx context.Context, scope models.CodeScope, email string) (*models.TOTPEnrollment, error) {
+	return r.getTOTPEnrollment(ctx, totpSecretKey(scope, email))
+}
+
+func (r *RedisService) getTOTPEnrollment(ctx context.Context, key string) (*models.TOTPEnrollment, error) {
+	data, err := r.client.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get TOTP enrollment: %w", err)
+	}
+
+	var enrollment models.TOTPEnrollment
+	if err := json.Unmarshal([]byte(data), &enrollment); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal TOTP enrollment: %w", err)
+	}
+	return &enrollment, nil
+}
+
+// ActivateTOTPEnrollment chuyển đăng ký đang chờ thành đăng ký chính thức (thay secret cũ nếu có)
+// và thay toàn bộ recovery code
+func (r *RedisService) ActivateTOTPEnrollment(ctx context.Context, scope models.CodeScope, enrollment *models.TOTPEnrollment, recoveryCodes []string) error {
+	data, err := json.Marshal(enrollment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal TOTP enrollment: %w", err)
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, totpSecretKey(scope, enrollment.Email), data, 0)
+	pipe.Del(ctx, totpPendingKey(scope, enrollment.Email))
+	r.replaceRecoveryCodes(ctx, pipe, scope, enrollment.Email, recoveryCodes)
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// UpdateTOTPEnrollment ghi lại đăng ký TOTP đã xác nhận (secret được mã hóa lại bằng khóa mới)
+func (r *RedisService) UpdateTOTPEnrollment(ctx context.Context, scope models.CodeScope, enrollment *models.TOTPEnrollment) error {
+	data, err := json.Marshal(enrollment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal TOTP enrollment: %w", err)
+	}
+	return r.client.Set(ctx, totpSecretKey(scope, enrollment.Email), data, 0).Err()
+}
+
+// DeleteTOTPEnrollment xóa đăng ký TOTP (đã xác nhận và đang chờ) cùng recovery code của email,
+// trả về false nếu email chưa đăng ký
+func (r *RedisService) DeleteTOTPEnrollment(ctx context.Context, scope models.CodeScope, email string) (bool, error) {
+	deleted, err := r.client.Del(ctx, totpSecretKey(scope, email), totpPendingKey(scope, email), totpRecoveryKey(scope, email)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete TOTP enrollment: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// ReplaceTOTPRecoveryCodes thay toàn bộ recovery code của email, code cũ không còn dùng được
+func (r *RedisService) ReplaceTOTPRecoveryCodes(ctx context.Context, scope models.CodeScope, email string, recoveryCodes []string) error {
+	pipe := r.client.TxPipeline()
+	r.replaceRecoveryCodes(ctx, pipe, scope, email, recoveryCodes)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisService) replaceRecoveryCodes(ctx context.Context, pipe redis.Pipeliner, scope models.CodeScope, email string, recoveryCodes []string) {
+	key := totpRecoveryKey(scope, email)
+	pipe.Del(ctx, key)
+	if len(recoveryCodes) == 0 {
+		return
+	}
+
+	hashes := make([]interface{}, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		hashes[i] = r.hasher.Hash(hashPurposeRecovery, recoveryHashInput(scope, email, code))
+	}
+	pipe.SAdd(ctx, key, hashes...)
+}
+
+// ConsumeTOTPRecoveryCode xóa recovery code (đã chuẩn hóa) khỏi danh sách, trả về false nếu code không tồn tại
+// hoặc đã được dùng, cùng số code còn lại. Khi nhiều request dùng cùng code, chỉ một request thành công.
+func (r *RedisService) ConsumeTOTPRecoveryCode(ctx context.Context, scope models.CodeScope, email, code string) (bool, int64, error) {
+	key := totpRecoveryKey(scope, email)
+
+	candidates := r.hasher.Candidates(hashPurposeRecovery, recoveryHashInput(scope, email, code))
+	members := make([]interface{}, len(candidates))
+	for i, candidate := range candidates {
+		members[i] = candidate
+	}
+
+	pipe := r.client.TxPipeline()
+	removed := pipe.SRem(ctx, key, members...)
+	remaining := pipe.SCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	return removed.Val() > 0, remaining.Val(), nil
+}
+
+// MarkTOTPStepUsed đánh dấu mã TOTP của chu kỳ step đã được dùng, trả về false nếu mã đã được dùng trước đó
+func (r *RedisService) MarkTOTPStepUsed(ctx context.Context, scope models.CodeScope, email string, step int64, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("totp:used:%s:%s:%s:%d", scope.Tenant, scope.System, email, step)
+	fresh, err := r.client.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark TOTP code as used: %w", err)
+	}
+	return fresh, nil
+}
+
+// recoveryHashInput gắn recovery code với tenant, system và email
+func recoveryHashInput(scope models.CodeScope, email, code string) string {
+	return strings.Join([]string{scope.Tenant, scope.System, email, code}, "\x00")
+}
+
+func totpSecretKey(scope models.CodeScope, email string) string {
+	return fmt.Sprintf("totp:secret:%s:%s:%s", scope.Tenant, scope.System, email)
+}
+
+func totpPendingKey(scope models.CodeScope, email string) string {
+	return fmt.Sprintf("totp:pending:%s:%s:%s", scope.Tenant, scope.System, email)
+}
+
+func totpRecoveryKey(scope models.CodeScope, email string) string {
+	return fmt.Sprintf("totp:recovery:%s:%s:%s", scope.Tenant, scope.System, email)
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+)
+
+func TestConsumeActivationTokenWithoutIdentifier(t *testing.T) {
+	// Token không có định danh bị từ chối trước khi truy cập Redis
+	redisService := NewRedisService(&config.Config{})
+
+	token := &models.ActivationToken{
+		Email:     "user@example.com",
+		Action:    "registration",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+	consumed, err := redisService.ConsumeActivationToken(context.Background(), token)
+	if err == nil || consumed {
+		t.Fatalf("ConsumeActivationToken = %v, %v, want error", consumed, err)
+	}
+}
+
+func TestVerificationCodeIsBoundToScope(t *testing.T) {
+	redisService, mr, cfg := newTestRedisService(t)
+	cfg.Code.ExpireMinutes = 10
+	ctx := context.Background()
+
+	scope := models.CodeScope{Tenant: "tenant-a", System: "Fix4Home", Purpose: "login"}
+	if err := redisService.StoreVerificationCode(ctx, scope, "user@example.com", "123456"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := redisService.GetVerificationCode(ctx, scope, "user@example.com")
+	if err != nil || !redisService.MatchVerificationCode(scope, stored, "123456") {
+		t.Fatalf("code does not verify in its own scope: %v", err)
+	}
+
+	raw, err := mr.Get(verificationCodeKey(scope, "user@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	others := map[string]models.CodeScope{
+		"tenant":  {Tenant: "tenant-b", System: scope.System, Purpose: scope.Purpose},
+		"system":  {Tenant: scope.Tenant, System: "Other", Purpose: scope.Purpose},
+		"purpose": {Tenant: scope.Tenant, System: scope.System, Purpose: "signup"},
+	}
+	for dimension, other := range others {
+		if _, err := redisService.GetVerificationCode(ctx, other, "user@example.com"); err == nil {
+			t.Fatalf("other %s: code found outside its scope", dimension)
+		}
+		// Bản ghi bị chép sang key của scope khác vẫn không khớp vì hash gắn với scope
+		if err := mr.Set(verificationCodeKey(other, "user@example.com"), raw); err != nil {
+			t.Fatal(err)
+		}
+		copied, err := redisService.GetVerificationCode(ctx, other, "user@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if redisService.MatchVerificationCode(other, copied, "123456") {
+			t.Fatalf("other %s: code hash matches outside its scope", dimension)
+		}
+	}
+}
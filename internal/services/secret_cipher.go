@@ -0,0 +1,95 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var ErrCipherDisabled = errors.New("encryption keys are not configured")
+
+// SecretCipher mã hóa secret cần giải mã lại được (TOTP secret) bằng AES-256-GCM trước khi lưu vào Redis.
+// Khóa mã hóa secret mới được chọn theo kid, secret lưu kèm kid của khóa đã mã hóa nên khóa cũ
+// giữ lại trong cấu hình vẫn giải mã được, secret được mã hóa lại bằng khóa hiện tại khi được dùng.
+type SecretCipher struct {
+	keyID string
+	keys  map[string]cipher.AEAD
+}
+
+func NewSecretCipher(keyID string, keys map[string]string) (*SecretCipher, error) {
+	c := &SecretCipher{keys: make(map[string]cipher.AEAD)}
+
+	for kid, value := range keys {
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes encoded as base64", kid)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+		c.keys[kid] = aead
+	}
+
+	if len(c.keys) > 0 {
+		if _, ok := c.keys[keyID]; !ok {
+			return nil, fmt.Errorf("key id %q is not declared", keyID)
+		}
+		c.keyID = keyID
+	}
+
+	return c, nil
+}
+
+// Enabled kiểm tra khóa mã hóa đã được cấu hình hay chưa
+func (c *SecretCipher) Enabled() bool {
+	return c != nil && c.keyID != ""
+}
+
+// CurrentKeyID trả về kid của khóa mã hóa secret mới
+func (c *SecretCipher) CurrentKeyID() string {
+	return c.keyID
+}
+
+// Encrypt mã hóa plaintext bằng khóa hiện tại, associated gắn ciphertext với chủ sở hữu
+// (không giải mã được khi bị chép sang bản ghi khác). Trả về kid và ciphertext (base64, nonce ở đầu).
+func (c *SecretCipher) Encrypt(plaintext []byte, associated string) (string, string, error) {
+	if !c.Enabled() {
+		return "", "", ErrCipherDisabled
+	}
+
+	aead := c.keys[c.keyID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(associated))
+	return c.keyID, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt giải mã ciphertext đã được mã hóa bằng khóa keyID
+func (c *SecretCipher) Decrypt(keyID, ciphertext, associated string) ([]byte, error) {
+	aead, ok := c.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", keyID)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed ciphertext")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(associated))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return plaintext, nil
+}
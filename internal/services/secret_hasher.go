@@ -0,0 +1,100 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Mục đích băm, tách riêng để hash của một loại giá trị không dùng được cho loại khác
+const (
+	hashPurposeCode       = "code"
+	hashPurposeActivation = "activation"
+	hashPurposeRevoke     = "revoke"
+	hashPurposeRecovery   = "recovery"
+	hashPurposeSession    = "session"
+	hashPurposeTracking   = "tracking"
+)
+
+// SecretHasher băm mã xác thực và token (HMAC-SHA256, hex) trước khi lưu vào Redis.
+// Khóa đầu tiên trong TOKEN_HASH_SECRETS dùng để băm giá trị mới, các khóa sau chỉ dùng để
+// tra cứu giá trị đã lưu trước khi đổi khóa.
+type SecretHasher struct {
+	secrets [][]byte
+}
+
+func NewSecretHasher(secrets []string) *SecretHasher {
+	hasher := &SecretHasher{}
+	for _, secret := range secrets {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			hasher.secrets = append(hasher.secrets, []byte(secret))
+		}
+	}
+	if len(hasher.secrets) == 0 {
+		// Chưa cấu hình khóa (config.Load trả về lỗi trong trường hợp này), vẫn băm để không lưu giá trị gốc
+		hasher.secrets = [][]byte{nil}
+	}
+	return hasher
+}
+
+// Hash băm giá trị bằng khóa hiện tại
+func (h *SecretHasher) Hash(purpose, value string) string {
+	return h.hash(h.secrets[0], purpose, value)
+}
+
+// Candidates trả về hash của giá trị theo mọi khóa, khóa hiện tại trước
+func (h *SecretHasher) Candidates(purpose, value string) []string {
+	hashes := make([]string, len(h.secrets))
+	for i, secret := range h.secrets {
+		hashes[i] = h.hash(secret, purpose, value)
+	}
+	return hashes
+}
+
+// Match so sánh giá trị với hash đã lưu theo thời gian không đổi
+func (h *SecretHasher) Match(purpose, value, hash string) bool {
+	matched := false
+	for _, candidate := range h.Candidates(purpose, value) {
+		if hmac.Equal([]byte(candidate), []byte(hash)) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+func (h *SecretHasher) hash(secret []byte, purpose, value string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Cipher trả về SecretCipher với khóa AES-256 dẫn xuất từ mỗi khóa băm theo purpose, dùng cho giá trị
+// cần giải mã lại được nhưng không có khóa mã hóa riêng. kid là hash của khóa dẫn xuất nên không đổi
+// khi thêm khóa mới vào TOKEN_HASH_SECRETS, giá trị mã hóa bằng khóa cũ vẫn giải mã được.
+func (h *SecretHasher) Cipher(purpose string) *SecretCipher {
+	c := &SecretCipher{keys: make(map[string]cipher.AEAD)}
+	for i, secret := range h.secrets {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte("cipher"))
+		mac.Write([]byte{0})
+		mac.Write([]byte(purpose))
+		key := mac.Sum(nil)
+
+		// Khóa dẫn xuất luôn dài 32 byte nên AES-256-GCM không trả về lỗi
+		block, _ := aes.NewCipher(key)
+		aead, _ := cipher.NewGCM(block)
+
+		sum := sha256.Sum256(key)
+		kid := hex.EncodeToString(sum[:4])
+		c.keys[kid] = aead
+		if i == 0 {
+			c.keyID = kid
+		}
+	}
+	return c
+}
@@ -1,18 +1,27 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"strings"
+	"unicode"
 
 	"gopkg.in/gomail.v2"
 	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/i18n"
+	"mrs_sendemail_be/internal/models"
 )
 
 type SMTPService struct {
-	config *config.Config
-	dialer *gomail.Dialer
+	config          *config.Config
+	dialer          *gomail.Dialer
+	brandingService *BrandingService
+	templateService *TemplateService
+	trackingService *TrackingService
 }
 
-func NewSMTPService(cfg *config.Config) *SMTPService {
+func NewSMTPService(cfg *config.Config, brandingService *BrandingService, templateService *TemplateService, trackingService *TrackingService) *SMTPService {
 	dialer := gomail.NewDialer(
 		cfg.SMTP.Host,
 		cfg.SMTP.Port,
@@ -21,8 +30,11 @@ func NewSMTPService(cfg *config.Config) *SMTPService {
 	)
 
 	return &SMTPService{
-		config: cfg,
-		dialer: dialer,
+		config:          cfg,
+		dialer:          dialer,
+		brandingService: brandingService,
+		templateService: templateService,
+		trackingService: trackingService,
 	}
 }
 
@@ -36,20 +48,28 @@ func (s *SMTPService) TestConnection() error {
 	return nil
 }
 
-// SendVerificationEmail gửi email chứa mã xác thực
-func (s *SMTPService) SendVerificationEmail(email, code, system string, customData map[string]interface{}) error {
+// SendVerificationEmail gửi email chứa mã xác thực.
+// subject là template tiêu đề ghi đè (rỗng = theo template của system/action).
+func (s *SMTPService) SendVerificationEmail(ctx context.Context, email, code, system, locale, subject string, customData map[string]interface{}) error {
 	if system == "" {
 		system = s.config.Code.DefaultSystemName
 	}
+	base := s.newEmailData(ctx, system, locale)
 
-	subject := fmt.Sprintf("Mã xác thực cho %s", system)
-	body := s.generateEmailBody(code, system, customData)
+	compiled := s.resolveTemplate(ctx, base.System, TemplateActionCode, base.Locale)
+	values, _ := validateCustomData(compiled.schema, customData)
 
-	message := gomail.NewMessage()
-	message.SetHeader("From", message.FormatAddress(s.config.SMTP.Username, s.config.SMTP.FromName))
-	message.SetHeader("To", email)
-	message.SetHeader("Subject", subject)
-	message.SetBody("text/html", body)
+	subject, err := s.generateSubject(compiled, TemplateActionCode, TemplateActionCode, subject, base, values)
+	if err != nil {
+		return err
+	}
+	body, text, err := s.generateEmailBody(compiled, code, base, values)
+	if err != nil {
+		return err
+	}
+
+	message := s.newMessage(email, subject, base.Brand)
+	setMessageBody(message, body, text)
 
 	if err := s.dialer.DialAndSend(message); err != nil {
 		return fmt.Errorf("failed to send email: %w", err)
@@ -58,312 +78,286 @@ func (s *SMTPService) SendVerificationEmail(email, code, system string, customDa
 	return nil
 }
 
-// SendActivationEmail gửi email chứa liên kết kích hoạt
-func (s *SMTPService) SendActivationEmail(email, activationURL, action, system string, customData map[string]interface{}) error {
+// ActivationDetails là thông tin riêng của từng luồng, template dùng qua {{.OldEmail}}, {{.NewEmail}}
+// (yêu cầu đổi email) và {{.Invitation}} (lời mời)
+type ActivationDetails struct {
+	OldEmail   string
+	NewEmail   string
+	Invitation *models.Invitation
+}
+
+// SendActivationEmail gửi email chứa liên kết kích hoạt, trả về message ID nếu email được theo dõi.
+// subject là template tiêu đề ghi đè (rỗng = theo template của system/action),
+// variant là variant A/B đã chọn cho token (rỗng = không dùng variant),
+// expiresAt là thời điểm hết hạn của token trong link (link tracking hết hạn cùng token),
+// details là thông tin của yêu cầu đổi email hoặc lời mời (rỗng với action khác).
+func (s *SMTPService) SendActivationEmail(ctx context.Context, email, activationURL, action, system, locale, subject, variant string, expiresAt int64, details ActivationDetails, customData map[string]interface{}) (string, error) {
 	if system == "" {
 		system = s.config.Code.DefaultSystemName
 	}
+	base := s.newEmailData(ctx, system, locale)
 
-	var subject, body string
-	switch action {
-	case "registration":
-		subject = fmt.Sprintf("Kích hoạt tài khoản %s", system)
-		body = s.generateActivationEmailBody(activationURL, system, "registration", customData)
-	case "password_reset":
-		subject = fmt.Sprintf("Đặt lại mật khẩu %s", system)
-		body = s.generateActivationEmailBody(activationURL, system, "password_reset", customData)
-	default:
-		subject = fmt.Sprintf("Xác thực email cho %s", system)
-		body = s.generateActivationEmailBody(activationURL, system, "verification", customData)
+	templateAction := s.templateActionFor(action)
+	compiled := s.resolveTemplate(ctx, base.System, templateAction, base.Locale).withVariant(variant)
+	values, _ := validateCustomData(compiled.schema, customData)
+
+	subject, err := s.generateSubject(compiled, action, templateAction, subject, base, values)
+	if err != nil {
+		return "", err
 	}
 
-	message := gomail.NewMessage()
-	message.SetHeader("From", message.FormatAddress(s.config.SMTP.Username, s.config.SMTP.FromName))
-	message.SetHeader("To", email)
-	message.SetHeader("Subject", subject)
-	message.SetBody("text/html", body)
+	// Tracking: link trong email trỏ về endpoint click, link thật được lưu (đã mã hóa) theo message ID
+	var tracked *models.TrackedMessage
+	if s.trackingService.Enabled(system) {
+		if tracked, err = s.trackingService.Start(ctx, email, system, action, activationURL, expiresAt); err != nil {
+			log.Printf("Error starting tracking for %s, sending untracked email: %v", email, err)
+		} else {
+			activationURL = s.trackingService.ClickURL(tracked.MessageID)
+		}
+	}
+
+	expireMinutes := 30
+	if actionConfig, ok := s.config.Action(action); ok {
+		expireMinutes = actionConfig.TTLMinutes
+	}
+	body, text, err := s.generateActivationEmailBody(compiled, activationURL, templateAction, expireMinutes, details, base, values)
+	if err != nil {
+		return "", err
+	}
+	if tracked != nil {
+		body = insertTrackingPixel(body, s.trackingService.PixelURL(tracked.MessageID))
+	}
+
+	message := s.newMessage(email, subject, base.Brand)
+	setMessageBody(message, body, text)
 
 	if err := s.dialer.DialAndSend(message); err != nil {
-		return fmt.Errorf("failed to send activation email: %w", err)
+		return "", fmt.Errorf("failed to send activation email: %w", err)
+	}
+
+	if tracked == nil {
+		return "", nil
 	}
+	s.trackingService.RecordSent(ctx, tracked.MessageID)
+	return tracked.MessageID, nil
+}
 
+// SendEmailChangeNotice gửi thông báo kèm link hủy yêu cầu tới địa chỉ hiện tại của yêu cầu đổi email.
+// Email dùng template thông báo (notice_template) của action, không theo dõi và không dùng variant A/B.
+func (s *SMTPService) SendEmailChangeNotice(ctx context.Context, details ActivationDetails, revokeURL, action, system, locale string, customData map[string]interface{}) error {
+	actionConfig, ok := s.config.Action(action)
+	if !ok || !actionConfig.ChangesEmail {
+		return fmt.Errorf("action %q does not change email", action)
+	}
+	if system == "" {
+		system = s.config.Code.DefaultSystemName
+	}
+	base := s.newEmailData(ctx, system, locale)
+
+	compiled := s.resolveTemplate(ctx, base.System, actionConfig.NoticeTemplate, base.Locale)
+	values, _ := validateCustomData(compiled.schema, customData)
+
+	subject, err := s.generateSubject(compiled, action, actionConfig.NoticeTemplate, "", base, values)
+	if err != nil {
+		return err
+	}
+	body, text, err := s.generateActivationEmailBody(compiled, revokeURL, actionConfig.NoticeTemplate, actionConfig.TTLMinutes, details, base, values)
+	if err != nil {
+		return err
+	}
+
+	message := s.newMessage(details.OldEmail, subject, base.Brand)
+	setMessageBody(message, body, text)
+
+	if err := s.dialer.DialAndSend(message); err != nil {
+		return fmt.Errorf("failed to send email change notice: %w", err)
+	}
 	return nil
 }
 
-// generateActivationEmailBody tạo nội dung HTML cho activation email
-func (s *SMTPService) generateActivationEmailBody(activationURL, system, action string, customData map[string]interface{}) string {
-	var title, message, buttonText, buttonColor string
-	
-	switch action {
-	case "registration":
-		title = "Kích hoạt tài khoản"
-		message = "Cảm ơn bạn đã đăng ký tài khoản. Vui lòng click vào nút bên dưới để kích hoạt tài khoản của bạn:"
-		buttonText = "Kích Hoạt Tài Khoản"
-		buttonColor = "#28a745"
-	case "password_reset":
-		title = "Đặt lại mật khẩu"
-		// Check if temp password is provided in customData
-		if tempPassword, exists := customData["temp_password"]; exists {
-			message = fmt.Sprintf("Mật khẩu tạm thời của bạn là: <strong style='font-size: 18px; color: #dc3545; background: #f8f9fa; padding: 8px 12px; border-radius: 4px; font-family: monospace;'>%v</strong><br><br>Click vào nút bên dưới để kích hoạt mật khẩu này. Sau khi đăng nhập, bạn cần vào trang cài đặt để đổi mật khẩu mới:", tempPassword)
-			buttonText = "Kích Hoạt Mật Khẩu Tạm Thời"
-		} else {
-			message = "Bạn đã yêu cầu đặt lại mật khẩu. Click vào nút bên dưới để tạo mật khẩu mới:"
-			buttonText = "Đặt Lại Mật Khẩu"
+// newEmailData chuẩn bị dữ liệu chung (locale, branding) cho email của system
+func (s *SMTPService) newEmailData(ctx context.Context, system, locale string) emailData {
+	data := emailData{
+		Localizer: i18n.NewLocalizer(locale),
+		System:    system,
+		Brand: models.BrandingProfile{
+			PrimaryColor: s.config.Branding.PrimaryColor,
+			FromName:     s.config.SMTP.FromName,
+		},
+	}
+	if s.brandingService != nil {
+		data.Brand = s.brandingService.Profile(ctx, system)
+	}
+	return data
+}
+
+// newMessage tạo message với các header From/To/Subject/Reply-To theo branding
+func (s *SMTPService) newMessage(to, subject string, brand models.BrandingProfile) *gomail.Message {
+	message := gomail.NewMessage()
+	message.SetHeader("From", message.FormatAddress(s.config.SMTP.Username, brand.FromName))
+	message.SetHeader("To", to)
+	message.SetHeader("Subject", subject)
+	if brand.ReplyTo != "" {
+		message.SetHeader("Reply-To", brand.ReplyTo)
+	}
+	return message
+}
+
+// setMessageBody đặt nội dung email, kèm phần text/plain (multipart/alternative) nếu template có
+func setMessageBody(message *gomail.Message, body, text string) {
+	if text == "" {
+		message.SetBody("text/html", body)
+		return
+	}
+	message.SetBody("text/plain", text)
+	message.AddAlternative("text/html", body)
+}
+
+// ValidateCustomData kiểm tra customData theo schema của template sẽ dùng cho system/action/locale,
+// trả về danh sách field thiếu hoặc sai kiểu
+func (s *SMTPService) ValidateCustomData(ctx context.Context, system, action, locale string, customData map[string]interface{}) []string {
+	if system == "" {
+		system = s.config.Code.DefaultSystemName
+	}
+	if action != TemplateActionCode {
+		action = s.templateActionFor(action)
+	}
+
+	compiled := s.resolveTemplate(ctx, system, action, i18n.NewLocalizer(locale).Locale)
+	_, problems := validateCustomData(compiled.schema, customData)
+	return problems
+}
+
+// ChooseVariant chọn variant A/B theo trọng số của template dùng cho system/action/locale,
+// trả về rỗng nếu template không có variant
+func (s *SMTPService) ChooseVariant(ctx context.Context, system, action, locale string) string {
+	if system == "" {
+		system = s.config.Code.DefaultSystemName
+	}
+	return s.resolveTemplate(ctx, system, s.templateActionFor(action), i18n.NewLocalizer(locale).Locale).chooseVariant()
+}
+
+// ValidateSubject kiểm tra template tiêu đề ghi đè với schema của template sẽ dùng cho system/action/locale
+func (s *SMTPService) ValidateSubject(ctx context.Context, system, action, locale, subject string) error {
+	if system == "" {
+		system = s.config.Code.DefaultSystemName
+	}
+	if action != TemplateActionCode {
+		action = s.templateActionFor(action)
+	}
+
+	compiled := s.resolveTemplate(ctx, system, action, i18n.NewLocalizer(locale).Locale)
+	_, err := validateSubjectTemplate(subject, action, locale, compiled.schema)
+	return err
+}
+
+// generateSubject tạo tiêu đề email từ template ghi đè, template của system/action hoặc tiêu đề mặc định
+func (s *SMTPService) generateSubject(compiled *compiledTemplate, action, templateAction, override string, base emailData, values map[string]interface{}) (string, error) {
+	tmpl := compiled.subject
+	if override != "" {
+		parsed, err := parseSubjectTemplate(override)
+		if err != nil {
+			return "", err
 		}
-		buttonColor = "#dc3545"
-	default:
-		title = "Xác thực email"
-		message = "Vui lòng click vào nút bên dưới để xác thực địa chỉ email của bạn:"
-		buttonText = "Xác Thực Email"
-		buttonColor = "#007bff"
-	}
-
-	return fmt.Sprintf(`
-<!DOCTYPE html>
-<html lang="vi">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>%s</title>
-    <style>
-        body {
-            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-            line-height: 1.6;
-            color: #333;
-            max-width: 600px;
-            margin: 0 auto;
-            padding: 20px;
-            background-color: #f4f4f4;
-        }
-        .container {
-            background: white;
-            padding: 30px;
-            border-radius: 10px;
-            box-shadow: 0 0 20px rgba(0,0,0,0.1);
-        }
-        .header {
-            text-align: center;
-            margin-bottom: 30px;
-        }
-        .logo {
-            font-size: 24px;
-            font-weight: bold;
-            color: #2c3e50;
-            margin-bottom: 10px;
-        }
-        .button-container {
-            text-align: center;
-            margin: 30px 0;
-        }
-        .activation-button {
-            display: inline-block;
-            background: %s;
-            color: white;
-            padding: 15px 30px;
-            text-decoration: none;
-            border-radius: 8px;
-            font-weight: bold;
-            font-size: 16px;
-            transition: background-color 0.3s;
-        }
-        .activation-button:hover {
-            opacity: 0.9;
-        }
-        .url-fallback {
-            background: #f8f9fa;
-            border: 1px solid #e9ecef;
-            border-radius: 5px;
-            padding: 15px;
-            margin: 20px 0;
-            word-break: break-all;
-            font-size: 14px;
-        }
-        .warning {
-            background: #fff3cd;
-            border: 1px solid #ffeaa7;
-            border-radius: 5px;
-            padding: 15px;
-            margin: 20px 0;
-            color: #856404;
-        }
-        .footer {
-            margin-top: 30px;
-            padding-top: 20px;
-            border-top: 1px solid #eee;
-            text-align: center;
-            color: #666;
-            font-size: 14px;
-        }
-        .highlight {
-            color: #007bff;
-            font-weight: bold;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <div class="logo">%s</div>
-            <h2>%s</h2>
-        </div>
-        
-        <p>Xin chào,</p>
-        <p>%s</p>
-        
-        <div class="button-container">
-            <a href="%s" class="activation-button">%s</a>
-        </div>
-        
-        <p><strong>Liên kết này sẽ hết hạn sau <span class="highlight">30 phút</span>.</strong></p>
-        
-        <p>Nếu bạn không thể click vào nút trên, vui lòng copy và paste URL bên dưới vào trình duyệt:</p>
-        <div class="url-fallback">
-            %s
-        </div>
-        
-        <div class="warning">
-            <strong>⚠️ Lưu ý bảo mật:</strong>
-            <ul style="margin: 10px 0; padding-left: 20px;">
-                <li>Liên kết này chỉ sử dụng một lần và sẽ hết hạn sau 30 phút</li>
-                <li>Không chia sẻ liên kết này với bất kỳ ai</li>
-                <li>Nếu bạn không yêu cầu email này, vui lòng bỏ qua</li>
-            </ul>
-        </div>
-        
-        <p>Nếu bạn gặp khó khăn, vui lòng liên hệ với đội ngũ hỗ trợ.</p>
-        
-        <div class="footer">
-            <p>Email này được gửi tự động từ hệ thống <strong>%s</strong></p>
-            <p>Vui lòng không trả lời email này.</p>
-        </div>
-    </div>
-</body>
-</html>
-    `,
-		title,        // Page title
-		buttonColor,  // Button color
-		system,       // Logo/header
-		title,        // H2 title
-		message,      // Main message
-		activationURL, // Button URL
-		buttonText,   // Button text
-		activationURL, // Fallback URL
-		system,       // Footer system name
-	)
+		tmpl = parsed
+	}
+
+	return renderSubject(tmpl, templateAction, subjectData{
+		Localizer:  base.Localizer,
+		System:     base.System,
+		Action:     action,
+		CustomData: values,
+	}, compiled.schema), nil
 }
 
-// generateEmailBody tạo nội dung HTML cho email
-func (s *SMTPService) generateEmailBody(code, system string, customData map[string]interface{}) string {
-	return fmt.Sprintf(`
-<!DOCTYPE html>
-<html lang="vi">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Mã xác thực</title>
-    <style>
-        body {
-            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-            line-height: 1.6;
-            color: #333;
-            max-width: 600px;
-            margin: 0 auto;
-            padding: 20px;
-            background-color: #f4f4f4;
-        }
-        .container {
-            background: white;
-            padding: 30px;
-            border-radius: 10px;
-            box-shadow: 0 0 20px rgba(0,0,0,0.1);
-        }
-        .header {
-            text-align: center;
-            margin-bottom: 30px;
-        }
-        .logo {
-            font-size: 24px;
-            font-weight: bold;
-            color: #2c3e50;
-            margin-bottom: 10px;
-        }
-        .code-container {
-            background: #f8f9fa;
-            border: 2px solid #e9ecef;
-            border-radius: 8px;
-            padding: 20px;
-            text-align: center;
-            margin: 20px 0;
-        }
-        .verification-code {
-            font-size: 32px;
-            font-weight: bold;
-            color: #007bff;
-            letter-spacing: 8px;
-            margin: 10px 0;
-        }
-        .warning {
-            background: #fff3cd;
-            border: 1px solid #ffeaa7;
-            border-radius: 5px;
-            padding: 15px;
-            margin: 20px 0;
-            color: #856404;
-        }
-        .footer {
-            margin-top: 30px;
-            padding-top: 20px;
-            border-top: 1px solid #eee;
-            text-align: center;
-            color: #666;
-            font-size: 14px;
-        }
-        .highlight {
-            color: #007bff;
-            font-weight: bold;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <div class="logo">%s</div>
-            <h2>Mã xác thực đăng nhập</h2>
-        </div>
-        
-        <p>Xin chào,</p>
-        <p>Bạn đã yêu cầu mã xác thực để đăng nhập vào hệ thống <span class="highlight">%s</span>.</p>
-        
-        <div class="code-container">
-            <p><strong>Mã xác thực của bạn là:</strong></p>
-            <div class="verification-code">%s</div>
-            <p><small>Mã này có hiệu lực trong vòng <span class="highlight">%d phút</span></small></p>
-        </div>
-        
-        <div class="warning">
-            <strong>⚠️ Lưu ý bảo mật:</strong>
-            <ul style="margin: 10px 0; padding-left: 20px;">
-                <li>Không chia sẻ mã này với bất kỳ ai</li>
-                <li>Mã chỉ sử dụng một lần và sẽ hết hạn sau %d phút</li>
-                <li>Nếu bạn không yêu cầu mã này, vui lòng bỏ qua email</li>
-            </ul>
-        </div>
-        
-        <p>Nếu bạn gặp khó khăn trong việc đăng nhập, vui lòng liên hệ với đội ngũ hỗ trợ.</p>
-        
-        <div class="footer">
-            <p>Email này được gửi tự động từ hệ thống <strong>%s</strong></p>
-            <p>Vui lòng không trả lời email này.</p>
-        </div>
-    </div>
-</body>
-</html>
-    `,
-		system,                          // Logo/header
-		system,                          // Tên hệ thống trong nội dung
-		code,                            // Mã xác thực
-		s.config.Code.ExpireMinutes,     // Thời gian hết hạn (1)
-		s.config.Code.ExpireMinutes,     // Thời gian hết hạn (2)
-		system,                          // Footer
-	)
-} 
\ No newline at end of file
+// generateActivationEmailBody tạo nội dung HTML và phần text (nếu có) cho activation email
+func (s *SMTPService) generateActivationEmailBody(compiled *compiledTemplate, activationURL, action string, expireMinutes int, details ActivationDetails, base emailData, values map[string]interface{}) (string, string, error) {
+	base.Title = base.T(actionTextKey(action, "title"))
+	data := activationEmailData{
+		emailData:         base,
+		ActivationDetails: details,
+		ActivationURL:     activationURL,
+		ExpireMinutes:     expireMinutes,
+		CustomData:        values,
+		Message:           base.T(actionTextKey(action, "message")),
+		ButtonText:        base.T(actionTextKey(action, "button")),
+	}
+
+	// Mật khẩu tạm thời (nếu có) được template hiển thị riêng từ customData đã lọc
+	if _, exists := data.CustomData["temp_password"]; exists && action == "password_reset" {
+		data.Message = base.T("email.password_reset.temp_message")
+		data.ButtonText = base.T("email.password_reset.temp_button")
+	}
+
+	body, err := renderEmail(compiled.tmpl, data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to render activation email: %w", err)
+	}
+
+	data.CustomData = withSchemaDefaults(values, compiled.schema)
+	text, err := renderText(compiled.text, data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to render activation email text: %w", err)
+	}
+	return body, text, nil
+}
+
+// generateEmailBody tạo nội dung HTML và phần text (nếu có) cho email
+func (s *SMTPService) generateEmailBody(compiled *compiledTemplate, code string, base emailData, values map[string]interface{}) (string, string, error) {
+	base.Title = base.T("email.code.title")
+	data := verificationEmailData{
+		emailData:     base,
+		Code:          code,
+		ExpireMinutes: s.config.Code.ExpireMinutes,
+		CustomData:    values,
+	}
+
+	body, err := renderEmail(compiled.tmpl, data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to render verification email: %w", err)
+	}
+
+	data.CustomData = withSchemaDefaults(values, compiled.schema)
+	text, err := renderText(compiled.text, data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to render verification email text: %w", err)
+	}
+	return body, text, nil
+}
+
+// resolveTemplate chọn template được quản lý (nếu có) cho system/action/locale, ngược lại dùng template dựng sẵn
+func (s *SMTPService) resolveTemplate(ctx context.Context, system, action, locale string) *compiledTemplate {
+	if s.templateService != nil {
+		if managed := s.templateService.Lookup(ctx, system, action, locale); managed != nil {
+			return managed
+		}
+	}
+
+	builtin := activationEmailTemplate
+	switch {
+	case action == TemplateActionCode:
+		builtin = verificationEmailTemplate
+	case s.config.IsNoticeTemplate(action):
+		builtin = emailChangeNoticeTemplate
+	}
+	return &compiledTemplate{tmpl: builtin, schema: builtinSchema(action)}
+}
+
+// templateActionFor trả về template của action theo cấu hình, action không còn được khai báo
+// (token tạo trước khi cấu hình thay đổi) được gửi dưới dạng email xác thực
+func (s *SMTPService) templateActionFor(action string) string {
+	if actionConfig, ok := s.config.Action(action); ok {
+		return actionConfig.Template
+	}
+	return "verification"
+}
+
+// sanitizeHeaderValue loại bỏ ký tự điều khiển khỏi giá trị dùng trong header email
+func sanitizeHeaderValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	texttemplate "text/template"
+	"unicode/utf8"
+
+	"mrs_sendemail_be/internal/i18n"
+	"mrs_sendemail_be/internal/models"
+)
+
+// maxSubjectLength là độ dài tối đa (ký tự) của template tiêu đề email
+const maxSubjectLength = 200
+
+var ErrInvalidSubject = errors.New("invalid subject template")
+
+// subjectData dữ liệu render cho tiêu đề email
+type subjectData struct {
+	i18n.Localizer
+	System     string
+	Action     string
+	CustomData map[string]interface{}
+}
+
+// defaultSubjectTemplate là tiêu đề mặc định của action, lấy từ catalog i18n
+func defaultSubjectTemplate(templateAction string) *texttemplate.Template {
+	return texttemplate.Must(parseSubjectTemplate(fmt.Sprintf(`{{.T %q .System}}`, actionTextKey(templateAction, "subject"))))
+}
+
+// parseSubjectTemplate parse template tiêu đề email (text/template, giá trị được làm sạch khi render)
+func parseSubjectTemplate(text string) (*texttemplate.Template, error) {
+	if utf8.RuneCountInString(text) > maxSubjectLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidSubject, maxSubjectLength)
+	}
+	tmpl, err := texttemplate.New("subject").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSubject, err)
+	}
+	return tmpl, nil
+}
+
+// validateSubjectTemplate parse và render thử tiêu đề với dữ liệu mẫu theo schema,
+// customData không khai báo trong schema bị từ chối
+func validateSubjectTemplate(text, action, locale string, schema []models.TemplateField) (*texttemplate.Template, error) {
+	tmpl, err := parseSubjectTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := testRenderSubject(tmpl, action, locale, schema); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// testRenderSubject render thử tiêu đề đã parse với missingkey=error trên bản sao của template
+func testRenderSubject(tmpl *texttemplate.Template, action, locale string, schema []models.TemplateField) error {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+
+	data := subjectData{
+		Localizer:  i18n.NewLocalizer(locale),
+		System:     "Sample System",
+		Action:     action,
+		CustomData: sampleCustomData(schema),
+	}
+	if err := clone.Option("missingkey=error").Execute(&bytes.Buffer{}, data); err != nil {
+		return fmt.Errorf("%w: test render failed: %v", ErrInvalidSubject, err)
+	}
+	return nil
+}
+
+// renderSubject render tiêu đề email, fallback về tiêu đề mặc định khi template lỗi hoặc kết quả rỗng
+func renderSubject(tmpl *texttemplate.Template, templateAction string, data subjectData, schema []models.TemplateField) string {
+	data.CustomData = withSchemaDefaults(data.CustomData, schema)
+
+	if tmpl != nil {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			log.Printf("Error rendering subject template: %v", err)
+		} else if subject := strings.TrimSpace(sanitizeHeaderValue(buf.String())); subject != "" {
+			return subject
+		}
+	}
+
+	var buf bytes.Buffer
+	_ = defaultSubjectTemplate(templateAction).Execute(&buf, data)
+	return strings.TrimSpace(sanitizeHeaderValue(buf.String()))
+}
+
+// withSchemaDefaults điền giá trị rỗng cho field khai báo trong schema nhưng không được gửi,
+// để text/template hiển thị rỗng thay vì "<no value>"
+func withSchemaDefaults(customData map[string]interface{}, schema []models.TemplateField) map[string]interface{} {
+	values := make(map[string]interface{}, len(schema)+len(customData))
+	for _, field := range schema {
+		values[field.Name] = ""
+	}
+	for name, value := range customData {
+		values[name] = value
+	}
+	return values
+}
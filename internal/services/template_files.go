@@ -0,0 +1,192 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mrs_sendemail_be/internal/models"
+)
+
+const (
+	templateFileExt     = ".html"
+	templateMarkdownExt = ".md"
+	templateSchemaExt   = ".schema.json"
+	templateSubjectExt  = ".subject.txt"
+)
+
+// templateFile là một template đọc từ thư mục template.
+// Bố cục thư mục:
+//
+//	<dir>/<action>.<locale>.html               template mặc định cho mọi system
+//	<dir>/<system>/<action>.<locale>.html      template riêng của system
+//	<dir>/.../<action>.<locale>.md             template Markdown (thay cho file .html cùng tên)
+//	<dir>/.../<action>.<locale>.schema.json    schema customData (tùy chọn, mặc định dùng schema dựng sẵn)
+//	<dir>/.../<action>.<locale>.subject.txt    template tiêu đề (tùy chọn)
+type templateFile struct {
+	path     string
+	system   string
+	action   string
+	locale   string
+	content  []byte
+	markdown bool // content là Markdown thay vì HTML
+	schema   []byte
+	subject  []byte
+}
+
+// templateFileSet là bộ template đã compile từ thư mục, được thay thế nguyên khối khi reload
+type templateFileSet struct {
+	revision  string
+	loadedAt  time.Time
+	templates map[string]*compiledTemplate // key: templateID(system, action, locale)
+}
+
+// readTemplateDir đọc mọi template trong thư mục và tính revision từ tên file + nội dung
+func readTemplateDir(dir string) ([]templateFile, string, error) {
+	var files []templateFile
+
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+
+		if entry.IsDir() {
+			// Chỉ hỗ trợ một cấp thư mục con (theo system), bỏ qua thư mục ẩn
+			if path != dir && (len(parts) > 1 || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if ext != templateFileExt && ext != templateMarkdownExt {
+			return nil
+		}
+		nameParts := strings.Split(strings.TrimSuffix(name, ext), ".")
+		if len(nameParts) != 2 {
+			return fmt.Errorf("%s: file name must be <action>.<locale>%s", rel, ext)
+		}
+
+		file := templateFile{
+			path:     rel,
+			action:   nameParts[0],
+			locale:   nameParts[1],
+			markdown: ext == templateMarkdownExt,
+		}
+		if len(parts) == 2 {
+			file.system = parts[0]
+		}
+
+		if file.content, err = os.ReadFile(path); err != nil {
+			return err
+		}
+		basePath := strings.TrimSuffix(path, ext)
+		if file.schema, err = readOptionalFile(basePath + templateSchemaExt); err != nil {
+			return err
+		}
+		if file.subject, err = readOptionalFile(basePath + templateSubjectExt); err != nil {
+			return err
+		}
+
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read template directory: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+
+	hash := sha256.New()
+	for _, file := range files {
+		fmt.Fprintf(hash, "%s\x00%d\x00", file.path, len(file.content))
+		hash.Write(file.content)
+		fmt.Fprintf(hash, "\x00%d\x00", len(file.schema))
+		hash.Write(file.schema)
+		fmt.Fprintf(hash, "\x00%d\x00", len(file.subject))
+		hash.Write(file.subject)
+	}
+
+	return files, hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
+
+// readOptionalFile đọc file, trả về nil nếu file không tồn tại
+func readOptionalFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// compileTemplateFiles kiểm tra và compile mọi template, trả về lỗi nếu có bất kỳ template nào không hợp lệ
+func compileTemplateFiles(files []templateFile, revision string, actions []string) (*templateFileSet, error) {
+	set := &templateFileSet{
+		revision:  revision,
+		loadedAt:  time.Now(),
+		templates: make(map[string]*compiledTemplate, len(files)),
+	}
+
+	var errs []error
+	for _, file := range files {
+		id := templateID(file.system, file.action, file.locale)
+		if _, exists := set.templates[id]; exists {
+			errs = append(errs, fmt.Errorf("%s: duplicate template, both .html and .md exist", file.path))
+			continue
+		}
+
+		schema := builtinSchema(file.action)
+		if file.schema != nil {
+			schema = nil
+			if err := json.Unmarshal(file.schema, &schema); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid schema: %v", file.path, err))
+				continue
+			}
+		}
+
+		tmpl := models.EmailTemplate{
+			System:  file.system,
+			Action:  file.action,
+			Locale:  file.locale,
+			Subject: strings.TrimSpace(string(file.subject)),
+			Schema:  schema,
+		}
+		if file.markdown {
+			tmpl.Markdown = string(file.content)
+		} else {
+			tmpl.HTML = string(file.content)
+		}
+		if err := validateTemplate(tmpl, actions); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", file.path, err))
+			continue
+		}
+
+		compiled, err := compileTemplate(tmpl)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", file.path, err))
+			continue
+		}
+		set.templates[id] = compiled
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return set, nil
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"mrs_sendemail_be/internal/i18n"
+	"mrs_sendemail_be/internal/utils"
+)
+
+// TemplateIssue là lỗi phát hiện khi kiểm tra template
+type TemplateIssue struct {
+	Template string // File/thư mục, template trong Redis hoặc tổ hợp system:action:locale
+	Message  string
+}
+
+func (i TemplateIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Template, i.Message)
+}
+
+// LintTemplates kiểm tra toàn bộ template trước khi phục vụ request: parse lại template trong thư mục
+// và Redis, sau đó render mọi tổ hợp system/action/locale (kể cả variant A/B) với branding thật và
+// dữ liệu mẫu, kiểm tra biến thiếu, link hỏng và kích thước nội dung.
+func (s *SMTPService) LintTemplates(ctx context.Context) []TemplateIssue {
+	var issues []TemplateIssue
+	systems := []string{s.config.Code.DefaultSystemName}
+
+	if s.templateService != nil {
+		sourceIssues, templateSystems, err := s.templateService.lintSources(ctx)
+		if err != nil {
+			log.Printf("Warning: skipping templates stored in Redis: %v", err)
+		}
+		issues = append(issues, sourceIssues...)
+		systems = append(systems, templateSystems...)
+	}
+	if s.brandingService != nil {
+		systems = append(systems, s.brandingService.Systems()...)
+	}
+	systems = append(systems, s.config.Templates.LintSystems...)
+	for system := range s.config.I18n.SystemLocales {
+		systems = append(systems, system)
+	}
+
+	for _, system := range uniqueSorted(systems) {
+		for _, action := range s.config.TemplateActions() {
+			for _, locale := range i18n.Locales() {
+				compiled := s.resolveTemplate(ctx, system, action, locale)
+
+				variants := []string{""}
+				for _, variant := range compiled.variants {
+					variants = append(variants, variant.name)
+				}
+				for _, variant := range variants {
+					name := templateID(system, action, locale)
+					if variant != "" {
+						name += " variant " + variant
+					}
+					for _, problem := range s.lintRender(ctx, compiled.withVariant(variant), system, action, locale) {
+						issues = append(issues, TemplateIssue{Template: name, Message: problem})
+					}
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+// lintRender render template như khi gửi thật với customData mẫu và trả về các vấn đề phát hiện được
+func (s *SMTPService) lintRender(ctx context.Context, compiled *compiledTemplate, system, action, locale string) []string {
+	var problems []string
+
+	base := s.newEmailData(ctx, system, locale)
+	values := sampleCustomData(compiled.schema)
+
+	subject, err := s.generateSubject(compiled, action, action, "", base, values)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("subject: %v", err))
+	} else if strings.Contains(subject, "<no value>") {
+		problems = append(problems, fmt.Sprintf("subject has missing variables: %q", subject))
+	}
+
+	var body, text string
+	if action == TemplateActionCode {
+		body, text, err = s.generateEmailBody(compiled, "123456", base, values)
+	} else {
+		activationURL := utils.GenerateActivationURL("https://example.com", "/verify.html", "sample-token")
+		body, text, err = s.generateActivationEmailBody(compiled, activationURL, action, 30, sampleActivationDetails, base, values)
+	}
+	if err != nil {
+		return append(problems, err.Error())
+	}
+
+	if strings.Contains(body, "&lt;no value&gt;") || strings.Contains(body, "<no value>") {
+		problems = append(problems, "HTML body has missing variables")
+	}
+	if strings.Contains(text, "<no value>") {
+		problems = append(problems, "text part has missing variables")
+	}
+	if limit := s.config.Templates.MaxBodyKB; limit > 0 && len(body) > limit*1024 {
+		problems = append(problems, fmt.Sprintf("HTML body is %d KB, larger than the %d KB limit", (len(body)+1023)/1024, limit))
+	}
+
+	return append(problems, checkLinks(body)...)
+}
+
+// lintSources parse và render thử lại template trong thư mục và template đang dùng trong Redis,
+// trả về các system có template riêng. Lỗi trả về khi không đọc được template trong Redis.
+func (t *TemplateService) lintSources(ctx context.Context) ([]TemplateIssue, []string, error) {
+	var issues []TemplateIssue
+	var systems []string
+
+	if dir := t.config.Templates.Dir; dir != "" {
+		if err := t.LoadTemplateDir(); err != nil {
+			for _, err := range splitErrors(err) {
+				issues = append(issues, TemplateIssue{Template: dir, Message: err.Error()})
+			}
+		}
+
+		t.mu.RLock()
+		if t.files != nil {
+			for id := range t.files.templates {
+				systems = append(systems, templateSystem(id))
+			}
+		}
+		t.mu.RUnlock()
+	}
+
+	ids, err := t.redisService.ListTemplateIDs(ctx)
+	if err != nil {
+		return issues, systems, err
+	}
+	for _, id := range ids {
+		tmpl, err := t.activeTemplate(ctx, id)
+		if err != nil {
+			return issues, systems, err
+		}
+		if tmpl == nil {
+			continue
+		}
+
+		systems = append(systems, templateSystem(id))
+		if err := validateTemplate(*tmpl, t.config.TemplateActions()); err != nil {
+			issues = append(issues, TemplateIssue{Template: fmt.Sprintf("stored %s v%d", id, tmpl.Version), Message: err.Error()})
+		}
+	}
+
+	return issues, systems, nil
+}
+
+// checkLinks kiểm tra link và ảnh trong email: URL phải tuyệt đối (email không có base URL)
+// và không bị html/template thay bằng #ZgotmplZ do không an toàn
+func checkLinks(body string) []string {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return []string{fmt.Sprintf("failed to parse HTML: %v", err)}
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	report := func(problem string) {
+		if !seen[problem] {
+			seen[problem] = true
+			problems = append(problems, problem)
+		}
+	}
+
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			attr := ""
+			switch node.Data {
+			case "a", "area":
+				attr = "href"
+			case "img":
+				attr = "src"
+			}
+			for _, a := range node.Attr {
+				if attr == "" || a.Key != attr {
+					continue
+				}
+				if problem := checkLink(node.Data, a.Val); problem != "" {
+					report(problem)
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	return problems
+}
+
+func checkLink(tag, link string) string {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return fmt.Sprintf("<%s> has an empty URL", tag)
+	}
+	if strings.Contains(link, "ZgotmplZ") {
+		return fmt.Sprintf("<%s> URL was rejected as unsafe by html/template", tag)
+	}
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return fmt.Sprintf("<%s> has a malformed URL %q", tag, link)
+	}
+
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		if parsed.Host == "" {
+			return fmt.Sprintf("<%s> has a malformed URL %q", tag, link)
+		}
+	case "mailto", "tel":
+		if tag == "img" {
+			return fmt.Sprintf("<img> has an unsupported URL %q", link)
+		}
+	case "cid", "data":
+		if tag != "img" {
+			return fmt.Sprintf("<%s> has an unsupported URL %q", tag, link)
+		}
+	default:
+		return fmt.Sprintf("<%s> has a relative or unsupported URL %q (email links must be absolute)", tag, link)
+	}
+	return ""
+}
+
+// templateSystem lấy system từ id template, rỗng với template mặc định
+func templateSystem(id string) string {
+	system := strings.SplitN(id, ":", 2)[0]
+	if system == "*" {
+		return ""
+	}
+	return system
+}
+
+// splitErrors tách lỗi được gộp bằng errors.Join thành từng lỗi
+func splitErrors(err error) []error {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,534 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/i18n"
+	"mrs_sendemail_be/internal/models"
+)
+
+// TemplateActionCode là action của email mã xác thực (/generate)
+const TemplateActionCode = "code"
+
+var (
+	ErrInvalidTemplate  = errors.New("invalid template")
+	ErrTemplateExists   = errors.New("template already exists")
+	ErrTemplateNotFound = errors.New("template not found")
+)
+
+// compiledTemplate là template đã parse kèm tiêu đề, schema customData và các variant A/B
+type compiledTemplate struct {
+	tmpl     *template.Template
+	text     *texttemplate.Template // Phần text/plain, nil = chỉ gửi HTML
+	subject  *texttemplate.Template // nil = tiêu đề mặc định
+	schema   []models.TemplateField
+	variants []compiledVariant
+}
+
+// TemplateService quản lý template email lưu trong Redis (có lịch sử version) và template
+// đọc từ thư mục TEMPLATE_DIR, cache các template đã parse trong bộ nhớ.
+// Thứ tự ưu tiên: Redis > thư mục template > template dựng sẵn.
+type TemplateService struct {
+	config       *config.Config
+	redisService *RedisService
+
+	mu        sync.RWMutex
+	cache     map[string]*compiledTemplate // nil = không có template được quản lý, dùng template mặc định
+	files     *templateFileSet
+	reloadErr string
+	rejected  string // revision bị từ chối gần nhất, không compile lại cho tới khi file thay đổi
+}
+
+func NewTemplateService(cfg *config.Config, redisService *RedisService) *TemplateService {
+	return &TemplateService{
+		config:       cfg,
+		redisService: redisService,
+		cache:        make(map[string]*compiledTemplate),
+	}
+}
+
+// templateID tạo id template từ system/action/locale, system rỗng là template mặc định
+func templateID(system, action, locale string) string {
+	if system == "" {
+		system = "*"
+	}
+	return fmt.Sprintf("%s:%s:%s", system, action, locale)
+}
+
+// Create tạo template mới (version 1)
+func (t *TemplateService) Create(ctx context.Context, tmpl models.EmailTemplate) (*models.EmailTemplate, error) {
+	return t.save(ctx, tmpl, false)
+}
+
+// Update lưu version mới cho template đã tồn tại
+func (t *TemplateService) Update(ctx context.Context, tmpl models.EmailTemplate) (*models.EmailTemplate, error) {
+	return t.save(ctx, tmpl, true)
+}
+
+func (t *TemplateService) save(ctx context.Context, tmpl models.EmailTemplate, mustExist bool) (*models.EmailTemplate, error) {
+	if err := validateTemplate(tmpl, t.config.TemplateActions()); err != nil {
+		return nil, err
+	}
+
+	id := templateID(tmpl.System, tmpl.Action, tmpl.Locale)
+	tmpl.CreatedAt = time.Now().Unix()
+	if err := t.redisService.StoreTemplateVersion(ctx, id, &tmpl, mustExist); err != nil {
+		if errors.Is(err, ErrTemplateExists) || errors.Is(err, ErrTemplateNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to store template: %w", err)
+	}
+	tmpl.Active = true
+
+	t.notifyChange(ctx, id)
+	return &tmpl, nil
+}
+
+// Rollback đặt lại một version cũ làm version đang dùng. Version được kiểm tra lại với cấu hình
+// hiện tại (action, locale, placeholder) vì cấu hình có thể đã thay đổi kể từ khi version được lưu.
+func (t *TemplateService) Rollback(ctx context.Context, system, action, locale string, version int) (*models.EmailTemplate, error) {
+	id := templateID(system, action, locale)
+
+	tmpl, err := t.redisService.GetTemplateVersion(ctx, id, version)
+	if err != nil {
+		return nil, ErrTemplateNotFound
+	}
+	if err := validateTemplate(*tmpl, t.config.TemplateActions()); err != nil {
+		return nil, fmt.Errorf("version %d cannot be restored: %w", version, err)
+	}
+
+	if err := t.redisService.SetActiveTemplateVersion(ctx, id, version); err != nil {
+		return nil, fmt.Errorf("failed to activate template version: %w", err)
+	}
+	tmpl.Active = true
+
+	t.notifyChange(ctx, id)
+	return tmpl, nil
+}
+
+// List trả về version đang dùng của mọi template được quản lý
+func (t *TemplateService) List(ctx context.Context) ([]models.EmailTemplate, error) {
+	ids, err := t.redisService.ListTemplateIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	sort.Strings(ids)
+
+	templates := make([]models.EmailTemplate, 0, len(ids))
+	for _, id := range ids {
+		tmpl, err := t.activeTemplate(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl != nil {
+			templates = append(templates, *tmpl)
+		}
+	}
+
+	return templates, nil
+}
+
+// Versions trả về lịch sử version của template, mới nhất trước
+func (t *TemplateService) Versions(ctx context.Context, system, action, locale string) ([]models.EmailTemplate, error) {
+	id := templateID(system, action, locale)
+
+	versions, err := t.redisService.GetTemplateVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrTemplateNotFound
+	}
+
+	active, err := t.redisService.GetActiveTemplateVersion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range versions {
+		versions[i].Active = versions[i].Version == active
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version > versions[j].Version
+	})
+
+	return versions, nil
+}
+
+// Lookup tìm template được quản lý cho system/action/locale, fallback về template mặc định (system rỗng).
+// Với mỗi mức, template trong Redis được ưu tiên hơn template trong thư mục.
+// Trả về nil nếu không có template nào, khi đó dùng template dựng sẵn.
+func (t *TemplateService) Lookup(ctx context.Context, system, action, locale string) *compiledTemplate {
+	cacheKey := templateID(system, action, locale)
+
+	t.mu.RLock()
+	cached, ok := t.cache[cacheKey]
+	files := t.files
+	t.mu.RUnlock()
+	if ok {
+		return cached
+	}
+
+	var compiled *compiledTemplate
+	cacheable := true
+	for _, id := range []string{cacheKey, templateID("", action, locale)} {
+		tmpl, err := t.activeTemplate(ctx, id)
+		if err != nil {
+			// Lỗi Redis: dùng template trong thư mục/dựng sẵn nhưng không cache để thử lại lần sau
+			log.Printf("Error loading template %s: %v", id, err)
+			cacheable = false
+		} else if tmpl != nil {
+			parsed, err := compileTemplate(*tmpl)
+			if err == nil {
+				compiled = parsed
+				break
+			}
+			log.Printf("Error parsing stored template %s v%d: %v", id, tmpl.Version, err)
+		}
+
+		if files != nil {
+			if fileTemplate, ok := files.templates[id]; ok {
+				compiled = fileTemplate
+				break
+			}
+		}
+	}
+
+	if !cacheable {
+		return compiled
+	}
+
+	t.mu.Lock()
+	// Không ghi cache nếu bộ template thư mục vừa được thay thế trong lúc tra cứu
+	if t.files == files {
+		t.cache[cacheKey] = compiled
+	}
+	t.mu.Unlock()
+
+	return compiled
+}
+
+// LoadTemplateDir đọc và compile template từ thư mục cấu hình.
+// Bộ template chỉ được thay thế khi mọi template đều hợp lệ, ngược lại giữ nguyên bộ đang dùng.
+func (t *TemplateService) LoadTemplateDir() error {
+	dir := t.config.Templates.Dir
+	if dir == "" {
+		return nil
+	}
+
+	files, revision, err := readTemplateDir(dir)
+	if err == nil {
+		t.mu.RLock()
+		current, rejected, reloadErr := t.files, t.rejected, t.reloadErr
+		t.mu.RUnlock()
+		if current != nil && current.revision == revision {
+			return nil
+		}
+		if rejected == revision {
+			return errors.New(reloadErr)
+		}
+
+		var set *templateFileSet
+		if set, err = compileTemplateFiles(files, revision, t.config.TemplateActions()); err == nil {
+			t.mu.Lock()
+			t.files = set
+			t.reloadErr = ""
+			t.rejected = ""
+			t.cache = make(map[string]*compiledTemplate)
+			t.mu.Unlock()
+
+			log.Printf("Loaded %d templates from %s (revision %s)", len(set.templates), dir, revision)
+			return nil
+		}
+		err = fmt.Errorf("revision %s rejected: %w", revision, err)
+		t.mu.Lock()
+		t.rejected = revision
+		t.mu.Unlock()
+	}
+
+	t.mu.Lock()
+	t.reloadErr = err.Error()
+	t.mu.Unlock()
+	return err
+}
+
+// WatchTemplateDir định kỳ kiểm tra thư mục template và reload khi có thay đổi
+func (t *TemplateService) WatchTemplateDir(ctx context.Context) {
+	if t.config.Templates.Dir == "" {
+		return
+	}
+
+	interval := time.Duration(t.config.Templates.ReloadInterval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.LoadTemplateDir(); err != nil {
+				// Chỉ log khi lỗi thay đổi để tránh lặp log mỗi chu kỳ
+				if err.Error() != lastErr {
+					log.Printf("Error reloading templates from %s: %v", t.config.Templates.Dir, err)
+				}
+				lastErr = err.Error()
+			} else {
+				lastErr = ""
+			}
+		}
+	}
+}
+
+// Revision trả về thông tin bộ template đang dùng từ thư mục, nil nếu không cấu hình thư mục
+func (t *TemplateService) Revision() *models.TemplateRevision {
+	if t.config.Templates.Dir == "" {
+		return nil
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	revision := &models.TemplateRevision{
+		LastError: t.reloadErr,
+	}
+	if t.files != nil {
+		revision.Revision = t.files.revision
+		revision.Files = len(t.files.templates)
+		revision.LoadedAt = t.files.loadedAt.Unix()
+	}
+	return revision
+}
+
+// WatchChanges lắng nghe thông báo thay đổi template từ các instance khác để xóa cache
+func (t *TemplateService) WatchChanges(ctx context.Context) {
+	for range t.redisService.SubscribeTemplateChanges(ctx) {
+		t.invalidate()
+	}
+}
+
+func (t *TemplateService) activeTemplate(ctx context.Context, id string) (*models.EmailTemplate, error) {
+	version, err := t.redisService.GetActiveTemplateVersion(ctx, id)
+	if err != nil || version == 0 {
+		return nil, err
+	}
+
+	tmpl, err := t.redisService.GetTemplateVersion(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Active = true
+	return tmpl, nil
+}
+
+func (t *TemplateService) notifyChange(ctx context.Context, id string) {
+	t.invalidate()
+	if err := t.redisService.PublishTemplateChange(ctx, id); err != nil {
+		log.Printf("Error publishing template change for %s: %v", id, err)
+	}
+}
+
+func (t *TemplateService) invalidate() {
+	t.mu.Lock()
+	t.cache = make(map[string]*compiledTemplate)
+	t.mu.Unlock()
+}
+
+// parseManagedTemplate parse template được quản lý, có sẵn các partial branding.
+// Template là tài liệu HTML đầy đủ được dùng nguyên bản, ngược lại được coi là phần nội dung
+// và đặt vào layout dùng chung.
+func parseManagedTemplate(text string) (*template.Template, error) {
+	if !isFullDocument(text) {
+		return newLayoutTemplate(text)
+	}
+
+	clone, err := brandingPartials.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return clone.New("managed").Parse(text)
+}
+
+// compileTemplate parse nội dung (HTML hoặc Markdown), tiêu đề và variant của template được quản lý
+func compileTemplate(tmpl models.EmailTemplate) (*compiledTemplate, error) {
+	var compiled *compiledTemplate
+	if tmpl.Markdown != "" {
+		markdown, err := compileMarkdown(tmpl.Markdown)
+		if err != nil {
+			return nil, err
+		}
+		compiled = markdown
+	} else {
+		parsed, err := parseManagedTemplate(tmpl.HTML)
+		if err != nil {
+			return nil, err
+		}
+		compiled = &compiledTemplate{tmpl: parsed}
+	}
+	compiled.schema = tmpl.Schema
+
+	var err error
+	// Subject khai báo riêng được ưu tiên hơn subject trong front-matter
+	if tmpl.Subject != "" {
+		if compiled.subject, err = parseSubjectTemplate(tmpl.Subject); err != nil {
+			return nil, err
+		}
+	}
+	if compiled.variants, err = compileVariants(tmpl.Variants); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// isFullDocument kiểm tra template có tự khai báo <html> hay không
+func isFullDocument(text string) bool {
+	lower := strings.ToLower(text)
+	return strings.Contains(lower, "<!doctype") || strings.Contains(lower, "<html")
+}
+
+// validateTemplate kiểm tra action/locale và render thử template với dữ liệu mẫu,
+// actions là các action có template (xem config.TemplateActions)
+func validateTemplate(tmpl models.EmailTemplate, actions []string) error {
+	if !containsString(actions, tmpl.Action) {
+		return fmt.Errorf("%w: unsupported action %q (allowed: %s)", ErrInvalidTemplate, tmpl.Action, strings.Join(actions, ", "))
+	}
+	if !i18n.Supported(tmpl.Locale) {
+		return fmt.Errorf("%w: unsupported locale %q", ErrInvalidTemplate, tmpl.Locale)
+	}
+
+	if err := validateSchema(tmpl.Schema); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+
+	if (tmpl.HTML == "") == (tmpl.Markdown == "") {
+		return fmt.Errorf("%w: exactly one of html or markdown is required", ErrInvalidTemplate)
+	}
+	if tmpl.Markdown != "" {
+		if err := validateMarkdown(tmpl); err != nil {
+			return err
+		}
+	} else if err := validateContent(tmpl.HTML, tmpl.Subject, tmpl); err != nil {
+		return err
+	}
+
+	if err := validateVariants(tmpl); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	for _, variant := range tmpl.Variants {
+		if err := validateContent(variant.HTML, variant.Subject, tmpl); err != nil {
+			return fmt.Errorf("variant %q: %w", variant.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateContent parse và render thử nội dung, tiêu đề theo action/locale/schema của template
+func validateContent(html, subject string, tmpl models.EmailTemplate) error {
+	parsed, err := parseManagedTemplate(html)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+
+	// Render thử với missingkey=error để phát hiện customData chưa được khai báo trong schema
+	parsed.Option("missingkey=error")
+	if _, err := renderEmail(parsed, sampleTemplateData(tmpl.Action, tmpl.Locale, tmpl.Schema)); err != nil {
+		return fmt.Errorf("%w: test render failed: %v", ErrInvalidTemplate, err)
+	}
+
+	if subject != "" {
+		if _, err := validateSubjectTemplate(subject, tmpl.Action, tmpl.Locale, tmpl.Schema); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+	}
+
+	return nil
+}
+
+// validateMarkdown biên dịch template Markdown và render thử phần HTML, text và tiêu đề
+func validateMarkdown(tmpl models.EmailTemplate) error {
+	compiled, err := compileTemplate(models.EmailTemplate{Markdown: tmpl.Markdown, Subject: tmpl.Subject, Schema: tmpl.Schema})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+
+	data := sampleTemplateData(tmpl.Action, tmpl.Locale, tmpl.Schema)
+	if _, err := renderEmail(compiled.tmpl.Option("missingkey=error"), data); err != nil {
+		return fmt.Errorf("%w: test render failed: %v", ErrInvalidTemplate, err)
+	}
+	if err := compiled.text.Option("missingkey=error").Execute(io.Discard, data); err != nil {
+		return fmt.Errorf("%w: test render of text part failed: %v", ErrInvalidTemplate, err)
+	}
+	if compiled.subject != nil {
+		if err := testRenderSubject(compiled.subject, tmpl.Action, tmpl.Locale, tmpl.Schema); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+	}
+
+	return nil
+}
+
+// sampleActivationDetails là thông tin đổi email và lời mời mẫu khi render thử template
+var sampleActivationDetails = ActivationDetails{
+	OldEmail: "old@example.com",
+	NewEmail: "new@example.com",
+	Invitation: &models.Invitation{
+		InviterName:      "Sample Inviter",
+		InviterEmail:     "inviter@example.com",
+		OrganizationID:   "sample-org",
+		OrganizationName: "Sample Organization",
+		Role:             "member",
+	},
+}
+
+// sampleTemplateData tạo dữ liệu mẫu để render thử template của action
+func sampleTemplateData(action, locale string, schema []models.TemplateField) interface{} {
+	base := emailData{
+		Localizer: i18n.NewLocalizer(locale),
+		System:    "Sample System",
+		Brand: models.BrandingProfile{
+			LogoURL:      "https://example.com/logo.png",
+			PrimaryColor: "#007bff",
+			FooterText:   "Sample footer",
+			SupportEmail: "support@example.com",
+			FromName:     "Sample System",
+			LegalAddress: "1 Sample Street",
+		},
+	}
+
+	if action == TemplateActionCode {
+		base.Title = base.T("email.code.title")
+		return verificationEmailData{
+			emailData:     base,
+			Code:          "123456",
+			ExpireMinutes: 30,
+			CustomData:    sampleCustomData(schema),
+		}
+	}
+
+	base.Title = base.T(actionTextKey(action, "title"))
+	return activationEmailData{
+		emailData:         base,
+		ActivationDetails: sampleActivationDetails,
+		Message:           base.T(actionTextKey(action, "message")),
+		ButtonText:        base.T(actionTextKey(action, "button")),
+		ActivationURL:     "https://example.com/activate.html?token=sample",
+		ExpireMinutes:     30,
+		CustomData:        sampleCustomData(schema),
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+)
+
+func newTestTemplateService(t *testing.T) (*TemplateService, *RedisService, *config.Config) {
+	t.Helper()
+	redisService, _, cfg := newTestRedisService(t)
+	cfg.Actions = map[string]config.ActionConfig{
+		"registration": {Template: "registration", TTLMinutes: 30},
+	}
+	return NewTemplateService(cfg, redisService), redisService, cfg
+}
+
+func testTemplate(comment string) models.EmailTemplate {
+	return models.EmailTemplate{
+		Action:  "registration",
+		Locale:  "en",
+		HTML:    `<p>{{.Message}}</p><a href="{{.ActivationURL}}">{{.ButtonText}}</a>`,
+		Comment: comment,
+	}
+}
+
+func TestTemplateConcurrentCreate(t *testing.T) {
+	service, _, _ := newTestTemplateService(t)
+	ctx := context.Background()
+
+	const writers = 10
+	errs := make([]error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = service.Create(ctx, testTemplate("create"))
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrTemplateExists):
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("%d concurrent creates succeeded, want 1", created)
+	}
+
+	versions, err := service.Versions(ctx, "", "registration", "en")
+	if err != nil || len(versions) != 1 || versions[0].Version != 1 {
+		t.Fatalf("Versions = %+v, %v", versions, err)
+	}
+}
+
+func TestTemplateConcurrentUpdate(t *testing.T) {
+	service, _, _ := newTestTemplateService(t)
+	ctx := context.Background()
+
+	if _, err := service.Update(ctx, testTemplate("update")); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("Update before Create = %v, want ErrTemplateNotFound", err)
+	}
+	if _, err := service.Create(ctx, testTemplate("create")); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers = 3
+	errs := make([]error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = service.Update(ctx, testTemplate("update"))
+		}(i)
+	}
+	wg.Wait()
+
+	updated := 0
+	for _, err := range errs {
+		if err == nil {
+			updated++
+		}
+	}
+	versions, err := service.Versions(ctx, "", "registration", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Mỗi update thành công có version riêng, không update nào ghi đè version của update khác
+	if len(versions) != updated+1 || versions[0].Version != updated+1 || !versions[0].Active {
+		t.Fatalf("%d updates succeeded, versions = %+v", updated, versions)
+	}
+}
+
+func TestTemplateRollbackValidatesVersion(t *testing.T) {
+	service, redisService, cfg := newTestTemplateService(t)
+	ctx := context.Background()
+	id := templateID("", "registration", "en")
+
+	if _, err := service.Create(ctx, testTemplate("v1")); err != nil {
+		t.Fatal(err)
+	}
+	// Version 2 dùng customData không khai báo trong schema (lưu thẳng vào Redis, bỏ qua kiểm tra)
+	invalid := testTemplate("v2")
+	invalid.HTML = `<p>{{.CustomData.undeclared}}</p>`
+	if err := redisService.StoreTemplateVersion(ctx, id, &invalid, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Update(ctx, testTemplate("v3")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.Rollback(ctx, "", "registration", "en", 2); !errors.Is(err, ErrInvalidTemplate) {
+		t.Fatalf("Rollback to invalid version = %v, want ErrInvalidTemplate", err)
+	}
+	if active, _ := redisService.GetActiveTemplateVersion(ctx, id); active != 3 {
+		t.Fatalf("active version = %d after rejected rollback, want 3", active)
+	}
+
+	if tmpl, err := service.Rollback(ctx, "", "registration", "en", 1); err != nil || tmpl.Version != 1 {
+		t.Fatalf("Rollback to version 1 = %+v, %v", tmpl, err)
+	}
+
+	// Action không còn được khai báo trong cấu hình hiện tại
+	delete(cfg.Actions, "registration")
+	if _, err := service.Rollback(ctx, "", "registration", "en", 3); !errors.Is(err, ErrInvalidTemplate) {
+		t.Fatalf("Rollback after action removed = %v, want ErrInvalidTemplate", err)
+	}
+	if active, _ := redisService.GetActiveTemplateVersion(ctx, id); active != 1 {
+		t.Fatalf("active version = %d after rejected rollback, want 1", active)
+	}
+
+	if _, err := service.Rollback(ctx, "", "registration", "en", 9); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("Rollback to missing version = %v, want ErrTemplateNotFound", err)
+	}
+}
+
+func TestLoadTemplateDirKeepsSetWhenAFileFails(t *testing.T) {
+	service, _, cfg := newTestTemplateService(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg.Templates.Dir = dir
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	valid := testTemplate("").HTML
+	write("registration.en.html", valid)
+	if err := service.LoadTemplateDir(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := service.Revision()
+	english := service.Lookup(ctx, "", "registration", "en")
+	if english == nil || loaded.Files != 1 || loaded.LastError != "" {
+		t.Fatalf("Revision = %+v after the first load", loaded)
+	}
+
+	// Một file hợp lệ được sửa, một file mới lỗi cú pháp: cả bộ mới bị từ chối
+	write("registration.en.html", "<p>changed</p>"+valid)
+	write("registration.vi.html", "<p>{{.Message</p>")
+	err := service.LoadTemplateDir()
+	if err == nil || !strings.Contains(err.Error(), "registration.vi.html") {
+		t.Fatalf("LoadTemplateDir = %v, want error naming registration.vi.html", err)
+	}
+
+	rejected := service.Revision()
+	if rejected.Revision != loaded.Revision || rejected.Files != 1 || rejected.LoadedAt != loaded.LoadedAt {
+		t.Fatalf("Revision = %+v after a rejected reload, want %+v", rejected, loaded)
+	}
+	if !strings.Contains(rejected.LastError, "registration.vi.html") {
+		t.Fatalf("LastError = %q", rejected.LastError)
+	}
+	if service.Lookup(ctx, "", "registration", "en") != english {
+		t.Fatal("rejected reload replaced the template in use")
+	}
+	if service.Lookup(ctx, "", "registration", "vi") != nil {
+		t.Fatal("rejected template is in use")
+	}
+
+	// File lỗi được sửa: bộ mới được áp dụng và lỗi được xóa
+	write("registration.vi.html", valid)
+	if err := service.LoadTemplateDir(); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded := service.Revision(); reloaded.Revision == loaded.Revision || reloaded.Files != 2 || reloaded.LastError != "" {
+		t.Fatalf("Revision = %+v after the fixed reload", reloaded)
+	}
+}
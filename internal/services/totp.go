@@ -0,0 +1,414 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/utils"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+var (
+	ErrTOTPDisabled       = errors.New("TOTP is not configured")
+	ErrTOTPNotEnrolled    = errors.New("TOTP enrollment not found")
+	ErrTOTPInvalidCode    = errors.New("invalid TOTP code")
+	ErrTOTPCodeReused     = errors.New("TOTP code has already been used")
+	ErrTOTPReauthRequired = errors.New("current TOTP code or recovery code required")
+)
+
+const (
+	totpSecretSize     = 20 // 160 bit, độ dài khuyến nghị cho HMAC-SHA1 (RFC 4226)
+	recoveryCodeLength = 10
+	recoveryGroupSize  = 5
+	totpQRCodeSize     = 256
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPEnrollmentResult là thông tin trả về khi đăng ký authenticator, secret gốc chỉ xuất hiện ở đây
+type TOTPEnrollmentResult struct {
+	Secret    string // Base32, để nhập tay vào ứng dụng
+	URI       string // otpauth://totp/...
+	QRCode    []byte // PNG của URI
+	ExpiresAt int64
+}
+
+// TOTPService quản lý mã TOTP (RFC 6238, HMAC-SHA1) của ứng dụng authenticator: đăng ký, xác nhận,
+// xác thực mã có dung sai lệch giờ và chống dùng lại, recovery code dùng một lần.
+// Secret được mã hóa bằng TOTP_ENCRYPTION_KEYS trước khi lưu vào Redis.
+type TOTPService struct {
+	config       *config.Config
+	redisService *RedisService
+	cipher       *SecretCipher
+	now          func() time.Time // Đồng hồ dùng để tính chu kỳ mã, thay được khi kiểm thử
+}
+
+func NewTOTPService(cfg *config.Config, redisService *RedisService) (*TOTPService, error) {
+	cipher, err := NewSecretCipher(cfg.TOTP.EncryptionKeyID, cfg.TOTP.EncryptionKeys)
+	if err != nil {
+		return nil, fmt.Errorf("TOTP_ENCRYPTION_KEYS: %w", err)
+	}
+	return &TOTPService{
+		config:       cfg,
+		redisService: redisService,
+		cipher:       cipher,
+		now:          time.Now,
+	}, nil
+}
+
+// Enabled kiểm tra khóa mã hóa secret đã được cấu hình hay chưa
+func (s *TOTPService) Enabled() bool {
+	return s != nil && s.cipher.Enabled()
+}
+
+// Enroll sinh secret mới và lưu dưới dạng đăng ký đang chờ, secret chỉ có hiệu lực sau khi Confirm.
+// Email đã có đăng ký được xác nhận phải gửi kèm mã hiện tại hoặc recovery code (xem Reauthenticate);
+// đăng ký cũ vẫn được dùng tới khi đăng ký mới được xác nhận.
+func (s *TOTPService) Enroll(ctx context.Context, scope models.CodeScope, email, accountName, code, recoveryCode string) (*TOTPEnrollmentResult, error) {
+	if !s.Enabled() {
+		return nil, ErrTOTPDisabled
+	}
+
+	current, err := s.redisService.GetTOTPEnrollment(ctx, scope, email)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		if err := s.prove(ctx, scope, current, code, recoveryCode); err != nil {
+			return nil, err
+		}
+	}
+
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+
+	now := s.now()
+	enrollment := &models.TOTPEnrollment{
+		Email:     email,
+		System:    scope.System,
+		CreatedAt: now.Unix(),
+		Replaces:  current != nil,
+	}
+	if err := s.encrypt(enrollment, scope, secret); err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(s.config.TOTP.EnrollTTL) * time.Minute
+	if err := s.redisService.StorePendingTOTPEnrollment(ctx, scope, enrollment, ttl); err != nil {
+		return nil, err
+	}
+
+	if accountName == "" {
+		accountName = email
+	}
+	encoded := totpEncoding.EncodeToString(secret)
+	uri := s.otpauthURI(accountName, encoded)
+	png, err := qrcode.Encode(uri, qrcode.Medium, totpQRCodeSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render QR code: %w", err)
+	}
+
+	return &TOTPEnrollmentResult{
+		Secret:    encoded,
+		URI:       uri,
+		QRCode:    png,
+		ExpiresAt: now.Add(ttl).Unix(),
+	}, nil
+}
+
+// Confirm kiểm tra mã đầu tiên từ ứng dụng với đăng ký đang chờ, kích hoạt đăng ký và trả về recovery code mới
+func (s *TOTPService) Confirm(ctx context.Context, scope models.CodeScope, email, code string) ([]string, error) {
+	if !s.Enabled() {
+		return nil, ErrTOTPDisabled
+	}
+
+	enrollment, err := s.redisService.GetPendingTOTPEnrollment(ctx, scope, email)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment == nil {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	// Đăng ký đang chờ bắt đầu khi email chưa có đăng ký không được thay đăng ký đã xác nhận sau đó
+	if !enrollment.Replaces {
+		current, err := s.redisService.GetTOTPEnrollment(ctx, scope, email)
+		if err != nil {
+			return nil, err
+		}
+		if current != nil {
+			return nil, ErrTOTPReauthRequired
+		}
+	}
+
+	if err := s.checkCode(ctx, scope, enrollment, code); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	enrollment.ConfirmedAt = s.now().Unix()
+	if err := s.redisService.ActivateTOTPEnrollment(ctx, scope, enrollment, normalizeAll(recoveryCodes)); err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+// Verify xác thực mã TOTP của email đã đăng ký
+func (s *TOTPService) Verify(ctx context.Context, scope models.CodeScope, email, code string) error {
+	if !s.Enabled() {
+		return ErrTOTPDisabled
+	}
+
+	enrollment, err := s.redisService.GetTOTPEnrollment(ctx, scope, email)
+	if err != nil {
+		return err
+	}
+	if enrollment == nil {
+		return ErrTOTPNotEnrolled
+	}
+
+	if err := s.checkCode(ctx, scope, enrollment, code); err != nil {
+		return err
+	}
+
+	// Secret được mã hóa bằng khóa cũ: mã hóa lại bằng khóa hiện tại để có thể gỡ khóa cũ khỏi cấu hình
+	if enrollment.KeyID != s.cipher.CurrentKeyID() {
+		s.reencrypt(ctx, scope, enrollment)
+	}
+	return nil
+}
+
+// VerifyRecoveryCode xác thực bằng recovery code (dùng một lần), trả về số code còn lại
+func (s *TOTPService) VerifyRecoveryCode(ctx context.Context, scope models.CodeScope, email, recoveryCode string) (int, error) {
+	if !s.Enabled() {
+		return 0, ErrTOTPDisabled
+	}
+
+	enrollment, err := s.redisService.GetTOTPEnrollment(ctx, scope, email)
+	if err != nil {
+		return 0, err
+	}
+	if enrollment == nil {
+		return 0, ErrTOTPNotEnrolled
+	}
+
+	consumed, remaining, err := s.redisService.ConsumeTOTPRecoveryCode(ctx, scope, email, utils.NormalizeCode(recoveryCode))
+	if err != nil {
+		return 0, err
+	}
+	if !consumed {
+		return 0, ErrTOTPInvalidCode
+	}
+	return int(remaining), nil
+}
+
+// Reauthenticate kiểm tra mã TOTP hiện tại hoặc recovery code (dùng một lần) của email đã đăng ký,
+// bắt buộc trước khi đăng ký lại, tạo lại recovery code hoặc tắt TOTP
+func (s *TOTPService) Reauthenticate(ctx context.Context, scope models.CodeScope, email, code, recoveryCode string) error {
+	if !s.Enabled() {
+		return ErrTOTPDisabled
+	}
+
+	enrollment, err := s.redisService.GetTOTPEnrollment(ctx, scope, email)
+	if err != nil {
+		return err
+	}
+	if enrollment == nil {
+		return ErrTOTPNotEnrolled
+	}
+	return s.prove(ctx, scope, enrollment, code, recoveryCode)
+}
+
+// RegenerateRecoveryCodes thay toàn bộ recovery code của email đã đăng ký sau khi Reauthenticate
+func (s *TOTPService) RegenerateRecoveryCodes(ctx context.Context, scope models.CodeScope, email, code, recoveryCode string) ([]string, error) {
+	if err := s.Reauthenticate(ctx, scope, email, code, recoveryCode); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.redisService.ReplaceTOTPRecoveryCodes(ctx, scope, email, normalizeAll(recoveryCodes)); err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+// Disable xóa đăng ký TOTP và recovery code của email sau khi Reauthenticate
+func (s *TOTPService) Disable(ctx context.Context, scope models.CodeScope, email, code, recoveryCode string) error {
+	if err := s.Reauthenticate(ctx, scope, email, code, recoveryCode); err != nil {
+		return err
+	}
+
+	deleted, err := s.redisService.DeleteTOTPEnrollment(ctx, scope, email)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrTOTPNotEnrolled
+	}
+	return nil
+}
+
+// prove kiểm tra mã TOTP của đăng ký, hoặc tiêu thụ recovery code nếu được gửi thay mã
+func (s *TOTPService) prove(ctx context.Context, scope models.CodeScope, enrollment *models.TOTPEnrollment, code, recoveryCode string) error {
+	switch {
+	case recoveryCode != "":
+		consumed, _, err := s.redisService.ConsumeTOTPRecoveryCode(ctx, scope, enrollment.Email, utils.NormalizeCode(recoveryCode))
+		if err != nil {
+			return err
+		}
+		if !consumed {
+			return ErrTOTPInvalidCode
+		}
+		return nil
+	case code != "":
+		return s.checkCode(ctx, scope, enrollment, code)
+	default:
+		return ErrTOTPReauthRequired
+	}
+}
+
+// checkCode so sánh mã với secret của đăng ký trong khoảng ±TOTP_SKEW chu kỳ,
+// mỗi mã chỉ được chấp nhận một lần kể cả khi vẫn còn trong khoảng dung sai
+func (s *TOTPService) checkCode(ctx context.Context, scope models.CodeScope, enrollment *models.TOTPEnrollment, code string) error {
+	code = strings.Join(strings.Fields(code), "")
+	if len(code) != s.config.TOTP.Digits {
+		return ErrTOTPInvalidCode
+	}
+
+	secret, err := s.cipher.Decrypt(enrollment.KeyID, enrollment.Secret, totpAssociatedData(scope, enrollment.Email))
+	if err != nil {
+		return err
+	}
+
+	period := int64(s.config.TOTP.Period)
+	current := s.now().Unix() / period
+	skew := int64(s.config.TOTP.Skew)
+
+	matched := int64(-1)
+	for step := current - skew; step <= current+skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step, s.config.TOTP.Digits)), []byte(code)) == 1 {
+			matched = step
+		}
+	}
+	if matched < 0 {
+		return ErrTOTPInvalidCode
+	}
+
+	// Mã còn được chấp nhận tới hết chu kỳ current+skew, đánh dấu giữ lâu hơn khoảng đó
+	ttl := time.Duration((2*skew+2)*period) * time.Second
+	fresh, err := s.redisService.MarkTOTPStepUsed(ctx, scope, enrollment.Email, matched, ttl)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrTOTPCodeReused
+	}
+	return nil
+}
+
+func (s *TOTPService) encrypt(enrollment *models.TOTPEnrollment, scope models.CodeScope, secret []byte) error {
+	keyID, ciphertext, err := s.cipher.Encrypt(secret, totpAssociatedData(scope, enrollment.Email))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+	}
+	enrollment.KeyID, enrollment.Secret = keyID, ciphertext
+	return nil
+}
+
+func (s *TOTPService) reencrypt(ctx context.Context, scope models.CodeScope, enrollment *models.TOTPEnrollment) {
+	secret, err := s.cipher.Decrypt(enrollment.KeyID, enrollment.Secret, totpAssociatedData(scope, enrollment.Email))
+	if err == nil {
+		err = s.encrypt(enrollment, scope, secret)
+	}
+	if err == nil {
+		err = s.redisService.UpdateTOTPEnrollment(ctx, scope, enrollment)
+	}
+	if err != nil {
+		log.Printf("Error re-encrypting TOTP secret for %s: %v", enrollment.Email, err)
+	}
+}
+
+// otpauthURI tạo URI theo định dạng Key Uri Format của Google Authenticator
+func (s *TOTPService) otpauthURI(accountName, secret string) string {
+	issuer := s.config.TOTP.Issuer
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", strconv.Itoa(s.config.TOTP.Digits))
+	params.Set("period", strconv.Itoa(s.config.TOTP.Period))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(accountName)
+	// Một số ứng dụng authenticator không giải mã "+" thành khoảng trắng
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(params.Encode(), "+", "%20")
+}
+
+// generateRecoveryCodes sinh TOTP_RECOVERY_CODES recovery code dạng XXXXX-XXXXX
+func (s *TOTPService) generateRecoveryCodes() ([]string, error) {
+	alphabet := config.CodeFormat{Type: config.CodeTypeAlphanumeric}.Characters()
+
+	codes := make([]string, s.config.TOTP.RecoveryCodes)
+	for i := range codes {
+		code, err := utils.GenerateVerificationCode(alphabet, recoveryCodeLength)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = utils.FormatCode(code, recoveryGroupSize, "-")
+	}
+	return codes, nil
+}
+
+func normalizeAll(codes []string) []string {
+	normalized := make([]string, len(codes))
+	for i, code := range codes {
+		normalized[i] = utils.NormalizeCode(code)
+	}
+	return normalized
+}
+
+// totpAssociatedData gắn secret đã mã hóa với tenant, system và email của đăng ký
+func totpAssociatedData(scope models.CodeScope, email string) string {
+	return strings.Join([]string{"totp", scope.Tenant, scope.System, email}, "\x00")
+}
+
+// totpCode tính mã HOTP (RFC 4226) của chu kỳ step
+func totpCode(secret []byte, step int64, digits int) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
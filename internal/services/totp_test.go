@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"mrs_sendemail_be/internal/models"
+)
+
+// rfc6238Secret là secret SHA1 của bộ test vector trong RFC 6238 Appendix B
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	vectors := []struct {
+		time int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		if got := totpCode(rfc6238Secret, v.time/30, 8); got != v.code {
+			t.Errorf("totpCode(T=%d) = %s, want %s", v.time, got, v.code)
+		}
+	}
+}
+
+// newTestTOTPService tạo TOTPService (8 chữ số, chu kỳ 30 giây, lệch ±1 chu kỳ) với đồng hồ cố định,
+// email đã đăng ký bằng secret của RFC 6238 và các recovery code cho trước
+func newTestTOTPService(t *testing.T, now *time.Time, recoveryCodes []string) (*TOTPService, models.CodeScope) {
+	t.Helper()
+	redisService, _, cfg := newTestRedisService(t)
+	cfg.TOTP.Issuer = "Fix4Home"
+	cfg.TOTP.Digits = 8
+	cfg.TOTP.Period = 30
+	cfg.TOTP.Skew = 1
+	cfg.TOTP.EncryptionKeyID = "k1"
+	cfg.TOTP.EncryptionKeys = map[string]string{"k1": base64.StdEncoding.EncodeToString(make([]byte, 32))}
+
+	service, err := NewTOTPService(cfg, redisService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.now = func() time.Time { return *now }
+
+	scope := models.CodeScope{Tenant: "default", System: "Fix4Home"}
+	enrollment := &models.TOTPEnrollment{Email: "user@example.com", System: scope.System, CreatedAt: now.Unix(), ConfirmedAt: now.Unix()}
+	if err := service.encrypt(enrollment, scope, rfc6238Secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := redisService.ActivateTOTPEnrollment(context.Background(), scope, enrollment, normalizeAll(recoveryCodes)); err != nil {
+		t.Fatal(err)
+	}
+	return service, scope
+}
+
+func TestTOTPVerifyWithClock(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	service, scope := newTestTOTPService(t, &now, nil)
+	ctx := context.Background()
+	current := now.Unix() / 30
+
+	verify := func(step int64) error {
+		return service.Verify(ctx, scope, "user@example.com", totpCode(rfc6238Secret, step, 8))
+	}
+
+	// Mã của RFC 6238 tại T=1111111109, người dùng nhập có khoảng trắng
+	if err := service.Verify(ctx, scope, "user@example.com", "0708 1804"); err != nil {
+		t.Fatalf("RFC 6238 code: %v", err)
+	}
+	if err := verify(current); !errors.Is(err, ErrTOTPCodeReused) {
+		t.Fatalf("second use of the current step = %v, want ErrTOTPCodeReused", err)
+	}
+
+	// Lệch ±1 chu kỳ được chấp nhận, mỗi chu kỳ một lần
+	for _, step := range []int64{current - 1, current + 1} {
+		if err := verify(step); err != nil {
+			t.Fatalf("step %+d: %v", step-current, err)
+		}
+		if err := verify(step); !errors.Is(err, ErrTOTPCodeReused) {
+			t.Fatalf("second use of step %+d = %v, want ErrTOTPCodeReused", step-current, err)
+		}
+	}
+
+	// Ngoài khoảng lệch bị từ chối
+	for _, step := range []int64{current - 2, current + 2} {
+		if err := verify(step); !errors.Is(err, ErrTOTPInvalidCode) {
+			t.Fatalf("step %+d = %v, want ErrTOTPInvalidCode", step-current, err)
+		}
+	}
+
+	// Đồng hồ chạy thêm hai chu kỳ: mã current+2, current+3 hợp lệ, mã current đã quá khoảng lệch
+	now = now.Add(60 * time.Second)
+	if err := verify(current + 2); err != nil {
+		t.Fatalf("step +2 after two periods: %v", err)
+	}
+	if err := verify(current + 3); err != nil {
+		t.Fatalf("step +3 after two periods: %v", err)
+	}
+	if err := verify(current); !errors.Is(err, ErrTOTPInvalidCode) {
+		t.Fatalf("old step after two periods = %v, want ErrTOTPInvalidCode", err)
+	}
+
+	if err := service.Verify(ctx, scope, "user@example.com", "1234567"); !errors.Is(err, ErrTOTPInvalidCode) {
+		t.Fatalf("code with wrong length = %v, want ErrTOTPInvalidCode", err)
+	}
+}
+
+func TestTOTPRecoveryCodesAreSingleUse(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	service, scope := newTestTOTPService(t, &now, []string{"ABCDE-FGHJK", "MNPQR-STUVW"})
+	ctx := context.Background()
+
+	remaining, err := service.VerifyRecoveryCode(ctx, scope, "user@example.com", "ABCDE-FGHJK")
+	if err != nil || remaining != 1 {
+		t.Fatalf("first use = %d, %v", remaining, err)
+	}
+	if _, err := service.VerifyRecoveryCode(ctx, scope, "user@example.com", "ABCDE-FGHJK"); !errors.Is(err, ErrTOTPInvalidCode) {
+		t.Fatalf("second use = %v, want ErrTOTPInvalidCode", err)
+	}
+
+	// Code được chuẩn hóa: không phân biệt hoa thường, bỏ dấu "-"
+	remaining, err = service.VerifyRecoveryCode(ctx, scope, "user@example.com", "mnpqrstuvw")
+	if err != nil || remaining != 0 {
+		t.Fatalf("normalized code = %d, %v", remaining, err)
+	}
+	if _, err := service.VerifyRecoveryCode(ctx, scope, "user@example.com", "MNPQR-STUVW"); !errors.Is(err, ErrTOTPInvalidCode) {
+		t.Fatalf("reuse of normalized code = %v, want ErrTOTPInvalidCode", err)
+	}
+}
+
+func TestTOTPChangesRequireReauthentication(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	service, scope := newTestTOTPService(t, &now, []string{"ABCDE-FGHJK", "MNPQR-STUVW"})
+	service.config.TOTP.RecoveryCodes = 2
+	ctx := context.Background()
+	current := now.Unix() / 30
+	email := "user@example.com"
+
+	// Không có mã hiện tại hoặc mã sai: đăng ký đã xác nhận không bị thay, recovery code giữ nguyên
+	if _, err := service.Enroll(ctx, scope, email, "", "", ""); !errors.Is(err, ErrTOTPReauthRequired) {
+		t.Fatalf("Enroll without code = %v, want ErrTOTPReauthRequired", err)
+	}
+	if _, err := service.RegenerateRecoveryCodes(ctx, scope, email, "1234567", ""); !errors.Is(err, ErrTOTPInvalidCode) {
+		t.Fatalf("RegenerateRecoveryCodes with wrong code = %v, want ErrTOTPInvalidCode", err)
+	}
+	if err := service.Disable(ctx, scope, email, "", "ZZZZZ-ZZZZZ"); !errors.Is(err, ErrTOTPInvalidCode) {
+		t.Fatalf("Disable with wrong recovery code = %v, want ErrTOTPInvalidCode", err)
+	}
+	if err := service.Disable(ctx, scope, email, "", ""); !errors.Is(err, ErrTOTPReauthRequired) {
+		t.Fatalf("Disable without code = %v, want ErrTOTPReauthRequired", err)
+	}
+
+	// Mã hiện tại cho phép đăng ký lại, đăng ký mới thay đăng ký cũ sau khi xác nhận
+	result, err := service.Enroll(ctx, scope, email, "", totpCode(rfc6238Secret, current, 8), "")
+	if err != nil {
+		t.Fatalf("Enroll with current code: %v", err)
+	}
+	secret, err := totpEncoding.DecodeString(result.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Confirm(ctx, scope, email, totpCode(secret, current+1, 8)); err != nil {
+		t.Fatalf("Confirm re-enrollment: %v", err)
+	}
+	if err := service.Verify(ctx, scope, email, totpCode(rfc6238Secret, current-1, 8)); !errors.Is(err, ErrTOTPInvalidCode) {
+		t.Fatalf("old secret after re-enrollment = %v, want ErrTOTPInvalidCode", err)
+	}
+
+	// Mỗi chu kỳ chỉ dùng được một lần kể cả với secret mới. Recovery code mới thay code cũ
+	// và bị tiêu thụ khi dùng để tắt TOTP
+	recoveryCodes, err := service.RegenerateRecoveryCodes(ctx, scope, email, totpCode(secret, current-1, 8), "")
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes with current code: %v", err)
+	}
+	if err := service.Disable(ctx, scope, email, "", "ABCDE-FGHJK"); !errors.Is(err, ErrTOTPInvalidCode) {
+		t.Fatalf("Disable with replaced recovery code = %v, want ErrTOTPInvalidCode", err)
+	}
+	if err := service.Disable(ctx, scope, email, "", recoveryCodes[0]); err != nil {
+		t.Fatalf("Disable with recovery code: %v", err)
+	}
+	if err := service.Verify(ctx, scope, email, totpCode(secret, current-1, 8)); !errors.Is(err, ErrTOTPNotEnrolled) {
+		t.Fatalf("Verify after Disable = %v, want ErrTOTPNotEnrolled", err)
+	}
+}
+
+func TestTOTPPendingEnrollmentCannotReplaceLaterEnrollment(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	service, scope := newTestTOTPService(t, &now, nil)
+	ctx := context.Background()
+	email := "other@example.com"
+
+	// Đăng ký bắt đầu khi email chưa có đăng ký, sau đó email được đăng ký bằng secret khác
+	result, err := service.Enroll(ctx, scope, email, "", "", "")
+	if err != nil {
+		t.Fatalf("first Enroll: %v", err)
+	}
+	confirmed := &models.TOTPEnrollment{Email: email, System: scope.System, CreatedAt: now.Unix(), ConfirmedAt: now.Unix()}
+	if err := service.encrypt(confirmed, scope, rfc6238Secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.redisService.UpdateTOTPEnrollment(ctx, scope, confirmed); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := totpEncoding.DecodeString(result.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Confirm(ctx, scope, email, totpCode(secret, now.Unix()/30, 8)); !errors.Is(err, ErrTOTPReauthRequired) {
+		t.Fatalf("Confirm stale pending enrollment = %v, want ErrTOTPReauthRequired", err)
+	}
+	if err := service.Verify(ctx, scope, email, totpCode(rfc6238Secret, now.Unix()/30, 8)); err != nil {
+		t.Fatalf("confirmed enrollment replaced: %v", err)
+	}
+}
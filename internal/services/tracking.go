@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+
+	"mrs_sendemail_be/internal/config"
+	"mrs_sendemail_be/internal/models"
+	"mrs_sendemail_be/internal/utils"
+)
+
+// TrackingService theo dõi việc mở email và click link kích hoạt theo message ID.
+// Link trong email trỏ về endpoint click của service. Link kích hoạt thật chứa token nên chỉ được lưu
+// dưới dạng mã hóa (khóa dẫn xuất từ TOKEN_HASH_SECRETS) và hết hạn cùng token, thông tin message
+// và sự kiện được giữ theo TRACKING_RETENTION_DAYS.
+type TrackingService struct {
+	config       *config.Config
+	redisService *RedisService
+	cipher       *SecretCipher
+}
+
+func NewTrackingService(cfg *config.Config, redisService *RedisService) *TrackingService {
+	return &TrackingService{
+		config:       cfg,
+		redisService: redisService,
+		cipher:       redisService.hasher.Cipher(hashPurposeTracking),
+	}
+}
+
+// Enabled kiểm tra tracking có được bật cho system hay không
+func (t *TrackingService) Enabled(system string) bool {
+	return t != nil && t.config.Tracking.TrackingEnabled(system)
+}
+
+// Start tạo message được theo dõi cho email kích hoạt, expiresAt là thời điểm hết hạn của token trong link
+func (t *TrackingService) Start(ctx context.Context, email, system, action, activationURL string, expiresAt int64) (*models.TrackedMessage, error) {
+	ttl := time.Until(time.Unix(expiresAt, 0))
+	if ttl <= 0 {
+		return nil, fmt.Errorf("activation token has expired")
+	}
+
+	messageID, err := utils.GenerateActivationToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate message id: %w", err)
+	}
+
+	kid, ciphertext, err := t.cipher.Encrypt([]byte(activationURL), messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt activation url: %w", err)
+	}
+
+	message := &models.TrackedMessage{
+		MessageID: messageID,
+		Email:     email,
+		System:    system,
+		Action:    action,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := t.redisService.StoreTrackedMessage(ctx, message, t.retention()); err != nil {
+		return nil, err
+	}
+	if err := t.redisService.StoreTrackedTarget(ctx, messageID, kid+":"+ciphertext, ttl); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// RecordSent ghi nhận email đã được gửi thành công
+func (t *TrackingService) RecordSent(ctx context.Context, messageID string) {
+	t.record(ctx, messageID, models.TrackingEventSent)
+}
+
+// ClickURL trả về link click-through thay thế cho link kích hoạt trong email
+func (t *TrackingService) ClickURL(messageID string) string {
+	return fmt.Sprintf("%s/track/click/%s", t.config.Tracking.BaseURL, messageID)
+}
+
+// PixelURL trả về link ảnh 1x1 dùng để ghi nhận email đã được mở
+func (t *TrackingService) PixelURL(messageID string) string {
+	return fmt.Sprintf("%s/track/open/%s", t.config.Tracking.BaseURL, messageID)
+}
+
+// RecordOpen ghi nhận email đã được mở, bỏ qua message không tồn tại
+func (t *TrackingService) RecordOpen(ctx context.Context, messageID string) {
+	if _, err := t.redisService.GetTrackedMessage(ctx, messageID); err != nil {
+		return
+	}
+	t.record(ctx, messageID, models.TrackingEventOpen)
+}
+
+// RecordClick ghi nhận click và trả về link kích hoạt thật để redirect, trả về lỗi khi token đã hết hạn
+func (t *TrackingService) RecordClick(ctx context.Context, messageID string) (string, error) {
+	message, err := t.redisService.GetTrackedMessage(ctx, messageID)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := t.targetURL(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	t.record(ctx, messageID, models.TrackingEventClick)
+	return target, nil
+}
+
+// targetURL giải mã link kích hoạt của message
+func (t *TrackingService) targetURL(ctx context.Context, message *models.TrackedMessage) (string, error) {
+	stored, err := t.redisService.GetTrackedTarget(ctx, message.MessageID)
+	if err != nil {
+		return "", err
+	}
+	if stored == "" {
+		// Message tạo trước khi link được mã hóa vẫn giữ link trong bản ghi tới khi hết hạn
+		if message.URL != "" {
+			return message.URL, nil
+		}
+		return "", fmt.Errorf("activation link of message %s has expired", message.MessageID)
+	}
+
+	kid, ciphertext, ok := strings.Cut(stored, ":")
+	if !ok {
+		return "", fmt.Errorf("malformed tracked target of message %s", message.MessageID)
+	}
+	target, err := t.cipher.Decrypt(kid, ciphertext, message.MessageID)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt activation url of message %s: %w", message.MessageID, err)
+	}
+	return string(target), nil
+}
+
+// Events trả về thông tin message (không kèm link kích hoạt) và các sự kiện đã ghi nhận
+func (t *TrackingService) Events(ctx context.Context, messageID string) (*models.TrackedMessage, []models.TrackingEvent, error) {
+	message, err := t.redisService.GetTrackedMessage(ctx, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	message.URL = ""
+
+	events, err := t.redisService.GetTrackingEvents(ctx, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return message, events, nil
+}
+
+func (t *TrackingService) record(ctx context.Context, messageID, eventType string) {
+	event := models.TrackingEvent{Type: eventType, At: time.Now().Unix()}
+	if err := t.redisService.AddTrackingEvent(ctx, messageID, event, t.retention()); err != nil {
+		log.Printf("Error recording %s event for message %s: %v", eventType, messageID, err)
+	}
+}
+
+func (t *TrackingService) retention() time.Duration {
+	days := t.config.Tracking.RetentionDays
+	if days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// insertTrackingPixel chèn ảnh theo dõi 1x1 vào cuối <body> của email
+func insertTrackingPixel(body, pixelURL string) string {
+	pixel := fmt.Sprintf(`<img src="%s" width="1" height="1" alt="" style="display: block; border: 0; width: 1px; height: 1px;"/>`, template.HTMLEscapeString(pixelURL))
+
+	idx := strings.LastIndex(strings.ToLower(body), "</body>")
+	if idx < 0 {
+		return body + pixel
+	}
+	return body[:idx] + pixel + body[idx:]
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"mrs_sendemail_be/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisService(t *testing.T) (*RedisService, *miniredis.Miniredis, *config.Config) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	cfg := &config.Config{}
+	cfg.Redis.Host, cfg.Redis.Port = mr.Host(), mr.Port()
+	cfg.Security.HashSecrets = []string{"test-secret"}
+	return NewRedisService(cfg), mr, cfg
+}
+
+func TestTrackingTargetIsEncryptedAndExpiresWithToken(t *testing.T) {
+	redisService, mr, cfg := newTestRedisService(t)
+	cfg.Tracking.RetentionDays = 30
+	tracking := NewTrackingService(cfg, redisService)
+	ctx := context.Background()
+
+	const activationURL = "https://app.example.com/verify.html?token=raw-activation-token"
+	message, err := tracking.Start(ctx, "user@example.com", "Fix4Home", "registration", activationURL, time.Now().Add(10*time.Minute).Unix())
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	for _, key := range mr.Keys() {
+		value, _ := mr.Get(key)
+		if strings.Contains(value, "raw-activation-token") {
+			t.Fatalf("%s stores the raw token: %s", key, value)
+		}
+	}
+
+	targetTTL := mr.TTL("track:url:" + message.MessageID)
+	if targetTTL <= 0 || targetTTL > 10*time.Minute {
+		t.Fatalf("target TTL = %v, want capped at token expiry", targetTTL)
+	}
+	if messageTTL := mr.TTL("track:msg:" + message.MessageID); messageTTL < 24*time.Hour {
+		t.Fatalf("message TTL = %v, want retention period", messageTTL)
+	}
+
+	target, err := tracking.RecordClick(ctx, message.MessageID)
+	if err != nil || target != activationURL {
+		t.Fatalf("RecordClick = %q, %v", target, err)
+	}
+
+	mr.FastForward(11 * time.Minute)
+	if _, err := tracking.RecordClick(ctx, message.MessageID); err == nil {
+		t.Fatal("RecordClick succeeded after the token expired")
+	}
+	if _, _, err := tracking.Events(ctx, message.MessageID); err != nil {
+		t.Fatalf("Events after token expiry: %v", err)
+	}
+}
+
+func TestTrackingStartRejectsExpiredToken(t *testing.T) {
+	redisService, _, cfg := newTestRedisService(t)
+	tracking := NewTrackingService(cfg, redisService)
+
+	if _, err := tracking.Start(context.Background(), "user@example.com", "Fix4Home", "registration", "https://x/?token=t", time.Now().Add(-time.Second).Unix()); err == nil {
+		t.Fatal("Start accepted an expired token")
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"html/template"
+	"math/rand"
+	texttemplate "text/template"
+
+	"mrs_sendemail_be/internal/models"
+)
+
+// Các bộ đếm thống kê A/B theo variant
+const (
+	VariantStatIssued    = "issued"    // Token mới được tạo
+	VariantStatSent      = "sent"      // Email được gửi (kể cả gửi lại)
+	VariantStatConverted = "converted" // Token được xác thực thành công
+)
+
+// compiledVariant là variant A/B đã parse của template
+type compiledVariant struct {
+	name    string
+	weight  int
+	tmpl    *template.Template
+	subject *texttemplate.Template // nil = dùng tiêu đề của template
+}
+
+// validateVariants kiểm tra tên và trọng số các variant, tổng trọng số không vượt quá 100%
+func validateVariants(tmpl models.EmailTemplate) error {
+	if len(tmpl.Variants) == 0 {
+		return nil
+	}
+	if tmpl.Action == TemplateActionCode {
+		return fmt.Errorf("variants are only supported for activation actions")
+	}
+	// Variant chỉ có nội dung HTML, template Markdown sẽ mất phần text/plain khi gửi variant
+	if tmpl.Markdown != "" {
+		return fmt.Errorf("variants are only supported for html templates")
+	}
+
+	seen := map[string]bool{models.TemplateVariantControl: true}
+	total := 0
+	for _, variant := range tmpl.Variants {
+		if !fieldNamePattern.MatchString(variant.Name) {
+			return fmt.Errorf("invalid variant name %q", variant.Name)
+		}
+		if seen[variant.Name] {
+			return fmt.Errorf("duplicate variant %q", variant.Name)
+		}
+		seen[variant.Name] = true
+
+		if variant.Weight < 0 || variant.Weight > 100 {
+			return fmt.Errorf("variant %q has invalid weight %d", variant.Name, variant.Weight)
+		}
+		total += variant.Weight
+	}
+	if total > 100 {
+		return fmt.Errorf("variant weights add up to %d%%, must not exceed 100%%", total)
+	}
+
+	return nil
+}
+
+func compileVariants(variants []models.TemplateVariant) ([]compiledVariant, error) {
+	compiled := make([]compiledVariant, 0, len(variants))
+	for _, variant := range variants {
+		parsed, err := parseManagedTemplate(variant.HTML)
+		if err != nil {
+			return nil, fmt.Errorf("variant %q: %w", variant.Name, err)
+		}
+
+		cv := compiledVariant{name: variant.Name, weight: variant.Weight, tmpl: parsed}
+		if variant.Subject != "" {
+			if cv.subject, err = parseSubjectTemplate(variant.Subject); err != nil {
+				return nil, fmt.Errorf("variant %q: %w", variant.Name, err)
+			}
+		}
+		compiled = append(compiled, cv)
+	}
+	return compiled, nil
+}
+
+// chooseVariant chọn ngẫu nhiên một variant theo trọng số, phần còn lại thuộc về variant "control".
+// Trả về rỗng nếu template không có variant.
+func (c *compiledTemplate) chooseVariant() string {
+	if len(c.variants) == 0 {
+		return ""
+	}
+
+	n := rand.Intn(100)
+	for _, variant := range c.variants {
+		if n < variant.weight {
+			return variant.name
+		}
+		n -= variant.weight
+	}
+	return models.TemplateVariantControl
+}
+
+// withVariant trả về template dùng nội dung/tiêu đề của variant, hoặc chính template nếu variant
+// là "control" hoặc không còn tồn tại (template đã được cập nhật sau khi token được tạo)
+func (c *compiledTemplate) withVariant(name string) *compiledTemplate {
+	for _, variant := range c.variants {
+		if variant.name != name {
+			continue
+		}
+
+		selected := *c
+		selected.tmpl = variant.tmpl
+		if variant.subject != nil {
+			selected.subject = variant.subject
+		}
+		return &selected
+	}
+	return c
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+
+	"mrs_sendemail_be/internal/models"
+)
+
+func TestValidateVariants(t *testing.T) {
+	variant := func(name string, weight int) models.TemplateVariant {
+		return models.TemplateVariant{Name: name, Weight: weight, HTML: "<p>{{.Message}}</p>"}
+	}
+
+	tests := []struct {
+		name     string
+		action   string
+		markdown string
+		variants []models.TemplateVariant
+		wantErr  string
+	}{
+		{name: "none"},
+		{name: "weights up to 100", variants: []models.TemplateVariant{variant("a", 60), variant("b", 40)}},
+		{name: "zero weight", variants: []models.TemplateVariant{variant("a", 0)}},
+		{name: "negative weight", variants: []models.TemplateVariant{variant("a", -1)}, wantErr: "invalid weight -1"},
+		{name: "weight over 100", variants: []models.TemplateVariant{variant("a", 101)}, wantErr: "invalid weight 101"},
+		{name: "total over 100", variants: []models.TemplateVariant{variant("a", 60), variant("b", 41)}, wantErr: "add up to 101%"},
+		{name: "duplicate", variants: []models.TemplateVariant{variant("a", 10), variant("a", 10)}, wantErr: `duplicate variant "a"`},
+		{name: "control is reserved", variants: []models.TemplateVariant{variant(models.TemplateVariantControl, 10)}, wantErr: "duplicate variant"},
+		{name: "invalid name", variants: []models.TemplateVariant{variant("New Design", 10)}, wantErr: "invalid variant name"},
+		{name: "code action", action: TemplateActionCode, variants: []models.TemplateVariant{variant("a", 10)}, wantErr: "activation actions"},
+		{name: "markdown template", markdown: "Hello", variants: []models.TemplateVariant{variant("a", 10)}, wantErr: "html templates"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := tt.action
+			if action == "" {
+				action = "registration"
+			}
+			err := validateVariants(models.EmailTemplate{Action: action, Markdown: tt.markdown, Variants: tt.variants})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("validateVariants: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("validateVariants = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChooseVariantFallsBackToControl(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []compiledVariant
+		want     string
+	}{
+		{name: "no variants", want: ""},
+		{name: "zero weight", variants: []compiledVariant{{name: "a", weight: 0}}, want: models.TemplateVariantControl},
+		{name: "full weight", variants: []compiledVariant{{name: "a", weight: 0}, {name: "b", weight: 100}}, want: "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled := &compiledTemplate{variants: tt.variants}
+			for i := 0; i < 100; i++ {
+				if got := compiled.chooseVariant(); got != tt.want {
+					t.Fatalf("chooseVariant = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// Variant "control" dùng nội dung chính của template
+	compiled := &compiledTemplate{variants: []compiledVariant{{name: "a", weight: 50}}}
+	if compiled.withVariant(models.TemplateVariantControl) != compiled {
+		t.Fatal("control variant does not use the template content")
+	}
+}
+
+func TestWithVariantKeepsTextPart(t *testing.T) {
+	text := texttemplate.Must(texttemplate.New("text").Parse("plain"))
+	variant := compiledVariant{name: "a", weight: 50, tmpl: mustLayoutTemplate("<p>variant</p>")}
+	compiled := &compiledTemplate{tmpl: mustLayoutTemplate("<p>control</p>"), text: text, variants: []compiledVariant{variant}}
+
+	selected := compiled.withVariant("a")
+	if selected.tmpl != variant.tmpl || selected.text != text {
+		t.Fatalf("withVariant = %+v, want variant HTML with the template text part", selected)
+	}
+}
+
+func TestStaleVariantAfterTemplateUpdate(t *testing.T) {
+	service, _, _ := newTestTemplateService(t)
+	ctx := context.Background()
+
+	withVariant := testTemplate("v1")
+	withVariant.Variants = []models.TemplateVariant{{
+		Name:    "new_design",
+		Weight:  100,
+		HTML:    `<p>New {{.Message}}</p><a href="{{.ActivationURL}}">{{.ButtonText}}</a>`,
+		Subject: "New design",
+	}}
+	if _, err := service.Create(ctx, withVariant); err != nil {
+		t.Fatal(err)
+	}
+
+	compiled := service.Lookup(ctx, "", "registration", "en")
+	if compiled == nil || compiled.chooseVariant() != "new_design" {
+		t.Fatalf("Lookup = %+v, want template with the new_design variant", compiled)
+	}
+	if selected := compiled.withVariant("new_design"); selected.tmpl == compiled.tmpl || selected.subject == compiled.subject {
+		t.Fatal("new_design variant does not use its own content and subject")
+	}
+
+	// Token tạo trước khi variant bị xóa vẫn mang tên variant cũ: gửi lại dùng nội dung hiện tại
+	if _, err := service.Update(ctx, testTemplate("v2")); err != nil {
+		t.Fatal(err)
+	}
+	updated := service.Lookup(ctx, "", "registration", "en")
+	if updated == nil || updated == compiled {
+		t.Fatal("Lookup returned the template cached before the update")
+	}
+	if updated.withVariant("new_design") != updated {
+		t.Fatal("removed variant still selected after the template update")
+	}
+	if updated.chooseVariant() != "" {
+		t.Fatal("updated template without variants still chooses one")
+	}
+}
@@ -2,30 +2,59 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"math/big"
 	"net"
 	"strings"
+	"unicode"
 
 	"github.com/google/uuid"
 )
 
-// GenerateVerificationCode sinh mã xác thực ngẫu nhiên
-func GenerateVerificationCode(length int) (string, error) {
-	const digits = "0123456789"
-
+// GenerateVerificationCode sinh mã xác thực ngẫu nhiên gồm length ký tự lấy từ alphabet
+func GenerateVerificationCode(alphabet string, length int) (string, error) {
 	code := make([]byte, length)
 	for i := range code {
-		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(digits))))
+		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
 		if err != nil {
 			return "", fmt.Errorf("failed to generate random number: %w", err)
 		}
-		code[i] = digits[num.Int64()]
+		code[i] = alphabet[num.Int64()]
 	}
 
 	return string(code), nil
 }
 
+// FormatCode chia mã thành các nhóm groupSize ký tự để dễ đọc, ví dụ ABCDEF -> ABC-DEF
+func FormatCode(code string, groupSize int, separator string) string {
+	if groupSize <= 0 || groupSize >= len(code) {
+		return code
+	}
+
+	var groups []string
+	for start := 0; start < len(code); start += groupSize {
+		end := start + groupSize
+		if end > len(code) {
+			end = len(code)
+		}
+		groups = append(groups, code[start:end])
+	}
+	return strings.Join(groups, separator)
+}
+
+// NormalizeCode chuẩn hóa mã người dùng nhập trước khi so sánh: bỏ khoảng trắng và dấu "-", chuyển thành chữ hoa
+func NormalizeCode(input string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, input)
+}
+
 // GetClientIP lấy IP address của client từ request
 func GetClientIP(remoteAddr, xForwardedFor, xRealIP string) string {
 	// Kiểm tra X-Forwarded-For header (có thể chứa nhiều IP)
@@ -65,14 +94,27 @@ func GenerateActivationToken() (string, error) {
 	return token.String(), nil
 }
 
-// GenerateActivationURL tạo URL activation từ base URL và token
-func GenerateActivationURL(baseURL, action, token string) string {
-	switch action {
-	case "registration":
-		return fmt.Sprintf("%s/activate.html?token=%s", strings.TrimRight(baseURL, "/"), token)
-	case "password_reset":
-		return fmt.Sprintf("%s/reset-password.html?token=%s", strings.TrimRight(baseURL, "/"), token)
-	default:
-		return fmt.Sprintf("%s/verify.html?token=%s", strings.TrimRight(baseURL, "/"), token)
+// GenerateNonce sinh chuỗi ngẫu nhiên 256 bit (base64url) dùng để gắn token với trình duyệt
+func GenerateNonce() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
 	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashNonce băm nonce (SHA-256, hex) để lưu trữ thay cho giá trị gốc
+func HashNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenFingerprint trả về 12 ký tự đầu của SHA-256 của token, dùng để ghi log thay cho token gốc
+func TokenFingerprint(token string) string {
+	return HashNonce(token)[:12]
+}
+
+// GenerateActivationURL tạo URL activation từ base URL, đường dẫn trang frontend của action và token
+func GenerateActivationURL(baseURL, path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", strings.TrimRight(baseURL, "/"), path, token)
 }